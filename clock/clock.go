@@ -0,0 +1,44 @@
+// Package clock abstracts the time the block production is paced with, so that a chain can
+// run on the system clock or on a virtual one moved by the program (see Virtual).
+package clock
+
+import "time"
+
+// Clock tells the time and creates the tickers pacing the block production.
+//
+// The work triggered by a tick is bracketed by Hold and Release: the consumer of a tick
+// releases it once handled, and holds the clock while handing produced items over to another
+// goroutine, which releases it once done with them. A virtual clock only fires its next
+// ticker once everything is released, the real clock ignores them.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	Hold()
+	Release()
+}
+
+// Ticker delivers ticks on C every period, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+func (realClock) Hold() {}
+
+func (realClock) Release() {}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
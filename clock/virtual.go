@@ -0,0 +1,272 @@
+package clock
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Virtual is a clock whose time only moves when it's stepped or advanced. Its tickers fire in
+// deadline order, the one created first on ties, and a tick is only delivered once the tick
+// before it and the work it triggered were released, so that the program goes through the
+// same sequence of events whatever the real time it takes.
+type Virtual struct {
+	lock    sync.Mutex
+	idle    *sync.Cond
+	now     time.Time
+	held    int
+	tickers []*virtualTicker
+
+	// added is closed when a ticker is added, nil when nobody waits for one
+	added chan struct{}
+}
+
+// NewVirtual creates a virtual clock starting at now.
+func NewVirtual(now time.Time) *Virtual {
+	clock := &Virtual{now: now}
+	clock.idle = sync.NewCond(&clock.lock)
+
+	return clock
+}
+
+func (c *Virtual) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// NewTicker creates a ticker firing every d from now on, d must be positive.
+func (c *Virtual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for clock.Virtual.NewTicker")
+	}
+
+	ticker := &virtualTicker{clock: c, c: make(chan time.Time)}
+	ticker.Reset(d)
+
+	return ticker
+}
+
+func (c *Virtual) Hold() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.held++
+}
+
+func (c *Virtual) Release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.held == 0 {
+		panic("clock.Virtual released more than held")
+	}
+
+	c.held--
+	if c.held == 0 {
+		c.idle.Broadcast()
+	}
+}
+
+// Next returns the time at which the next ticker fires, false when there's no ticker.
+func (c *Virtual) Next() (time.Time, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ticker := c.nextTicker()
+	if ticker == nil {
+		return time.Time{}, false
+	}
+
+	return ticker.deadline, true
+}
+
+// Step moves the time to the next ticker deadline and fires it, returning once the tick and
+// the work it triggered were released. It returns false when there's no ticker to fire.
+func (c *Virtual) Step() bool {
+	fired, _ := c.step(nil)
+	return fired
+}
+
+// step fires the next ticker like Step, unless its deadline is after until. It returns whether
+// a ticker fired and whether there's any.
+func (c *Virtual) step(until *time.Time) (fired bool, found bool) {
+	c.lock.Lock()
+	for c.held > 0 {
+		c.idle.Wait()
+	}
+
+	ticker := c.nextTicker()
+	if ticker == nil || (until != nil && ticker.deadline.After(*until)) {
+		c.lock.Unlock()
+		return false, ticker != nil
+	}
+
+	tick := ticker.deadline
+	c.now = later(c.now, tick)
+	ticker.deadline = tick.Add(ticker.period)
+	stopped := ticker.stopped
+
+	// The tick is held on behalf of its receiver until it releases it
+	c.held++
+	c.lock.Unlock()
+
+	select {
+	case ticker.c <- tick:
+	case <-stopped:
+		c.Release()
+	}
+
+	c.lock.Lock()
+	for c.held > 0 {
+		c.idle.Wait()
+	}
+	c.lock.Unlock()
+
+	return true, true
+}
+
+// Advance moves the time by d, firing the tickers due meanwhile in order like Step.
+func (c *Virtual) Advance(d time.Duration) {
+	target := c.Now().Add(d)
+	for {
+		if fired, _ := c.step(&target); !fired {
+			break
+		}
+	}
+
+	c.lock.Lock()
+	c.now = later(c.now, target)
+	c.lock.Unlock()
+}
+
+// Run fires the tickers in order as fast as possible, like calling Step in a loop, until ctx
+// is done. It waits for a ticker to be created when there's none, e.g. while the program is
+// starting, and always returns an error, ctx's one.
+func (c *Virtual) Run(ctx context.Context) error {
+	return c.run(ctx, nil)
+}
+
+// RunUntil fires the tickers due until t in order as fast as possible, then moves the time to
+// t. It waits for a ticker to be created when there's none, and returns early with ctx's
+// error if ctx is done.
+func (c *Virtual) RunUntil(ctx context.Context, t time.Time) error {
+	return c.run(ctx, &t)
+}
+
+func (c *Virtual) run(ctx context.Context, until *time.Time) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fired, found := c.step(until)
+		if fired {
+			continue
+		}
+
+		if found {
+			c.lock.Lock()
+			c.now = later(c.now, *until)
+			c.lock.Unlock()
+
+			return nil
+		}
+
+		if err := c.waitTicker(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// waitTicker waits until the clock has a ticker or ctx is done.
+func (c *Virtual) waitTicker(ctx context.Context) error {
+	c.lock.Lock()
+	if len(c.tickers) > 0 {
+		c.lock.Unlock()
+		return nil
+	}
+
+	if c.added == nil {
+		c.added = make(chan struct{})
+	}
+	added := c.added
+	c.lock.Unlock()
+
+	select {
+	case <-added:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nextTicker returns the ticker with the earliest deadline, nil if there's none.
+func (c *Virtual) nextTicker() *virtualTicker {
+	var next *virtualTicker
+	for _, ticker := range c.tickers {
+		if next == nil || ticker.deadline.Before(next.deadline) {
+			next = ticker
+		}
+	}
+
+	return next
+}
+
+type virtualTicker struct {
+	clock    *Virtual
+	c        chan time.Time
+	period   time.Duration
+	deadline time.Time
+
+	// stopped is closed when the ticker is stopped, unblocking a tick being delivered
+	stopped chan struct{}
+}
+
+func (t *virtualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Reset makes the ticker fire every d from now on, restarting it if it was stopped.
+func (t *virtualTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for clock.Virtual ticker Reset")
+	}
+
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t.period = d
+	t.deadline = c.now.Add(d)
+	if !slices.Contains(c.tickers, t) {
+		t.stopped = make(chan struct{})
+		c.tickers = append(c.tickers, t)
+
+		if c.added != nil {
+			close(c.added)
+			c.added = nil
+		}
+	}
+}
+
+func (t *virtualTicker) Stop() {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if i := slices.Index(c.tickers, t); i >= 0 {
+		c.tickers = slices.Delete(c.tickers, i, i+1)
+		close(t.stopped)
+	}
+}
+
+func later(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+
+	return a
+}
@@ -0,0 +1,172 @@
+package clock_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dummy-blockchain/clock"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// consume records the ticks of ticker as name@elapsed, releasing each one once recorded, until
+// the test ends.
+func consume(t *testing.T, c *clock.Virtual, ticker clock.Ticker, name string, events *[]string) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		for {
+			select {
+			case tick := <-ticker.C():
+				*events = append(*events, fmt.Sprintf("%s@%s", name, tick.Sub(start)))
+				c.Release()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func TestVirtual_StepOrder(t *testing.T) {
+	c := clock.NewVirtual(start)
+
+	var events []string
+	consume(t, c, c.NewTicker(2*time.Second), "a", &events)
+	consume(t, c, c.NewTicker(3*time.Second), "b", &events)
+
+	for range 5 {
+		if !c.Step() {
+			t.Fatal("no ticker fired")
+		}
+	}
+
+	// a was created first, it fires first when both are due at 6s
+	expected := []string{"a@2s", "b@3s", "a@4s", "a@6s", "b@6s"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("fired %v, expected %v", events, expected)
+	}
+
+	if now := c.Now(); !now.Equal(start.Add(6 * time.Second)) {
+		t.Errorf("now is %s, expected %s", now, start.Add(6*time.Second))
+	}
+}
+
+func TestVirtual_StepWaitsForRelease(t *testing.T) {
+	c := clock.NewVirtual(start)
+	ticker := c.NewTicker(time.Second)
+
+	// The tick is handed over to another goroutine holding the clock, which only releases it
+	// once done with it
+	handled := make(chan time.Time)
+	var events []string
+	go func() {
+		for tick := range handled {
+			time.Sleep(10 * time.Millisecond)
+			events = append(events, fmt.Sprintf("handled@%s", tick.Sub(start)))
+			c.Release()
+		}
+	}()
+	defer close(handled)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case tick := <-ticker.C():
+				c.Hold()
+				handled <- tick
+				c.Release()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for i := range 3 {
+		c.Step()
+
+		if len(events) != i+1 {
+			t.Fatalf("step %d returned before the tick was handled, events %v", i+1, events)
+		}
+	}
+
+	expected := []string{"handled@1s", "handled@2s", "handled@3s"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("handled %v, expected %v", events, expected)
+	}
+}
+
+func TestVirtual_StepWithoutTicker(t *testing.T) {
+	c := clock.NewVirtual(start)
+	if c.Step() {
+		t.Error("stepped a clock without ticker")
+	}
+
+	ticker := c.NewTicker(time.Second)
+	ticker.Stop()
+	if c.Step() {
+		t.Error("stepped a clock whose ticker is stopped")
+	}
+}
+
+func TestVirtual_RunUntil(t *testing.T) {
+	c := clock.NewVirtual(start)
+
+	var events []string
+	consume(t, c, c.NewTicker(time.Second), "a", &events)
+
+	until := start.Add(3500 * time.Millisecond)
+	if err := c.RunUntil(context.Background(), until); err != nil {
+		t.Fatalf("run until: %s", err)
+	}
+
+	expected := []string{"a@1s", "a@2s", "a@3s"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("fired %v, expected %v", events, expected)
+	}
+
+	if now := c.Now(); !now.Equal(until) {
+		t.Errorf("now is %s, expected %s", now, until)
+	}
+
+	// The next tick is still due at 4s
+	if next, _ := c.Next(); !next.Equal(start.Add(4 * time.Second)) {
+		t.Errorf("next tick at %s, expected %s", next, start.Add(4*time.Second))
+	}
+}
+
+func TestVirtual_RunUntilWaitsForTicker(t *testing.T) {
+	c := clock.NewVirtual(start)
+
+	var events []string
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		consume(t, c, c.NewTicker(time.Second), "a", &events)
+	}()
+
+	if err := c.RunUntil(context.Background(), start.Add(2*time.Second)); err != nil {
+		t.Fatalf("run until: %s", err)
+	}
+
+	expected := []string{"a@1s", "a@2s"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("fired %v, expected %v", events, expected)
+	}
+}
+
+func TestVirtual_RunUntilCanceled(t *testing.T) {
+	c := clock.NewVirtual(start)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.RunUntil(ctx, start.Add(time.Second)); !errors.Is(err, context.Canceled) {
+		t.Errorf("run until returned %v, expected context.Canceled", err)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -14,29 +17,46 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/streamingfast/dummy-blockchain/clock"
 	"github.com/streamingfast/dummy-blockchain/core"
 	"github.com/streamingfast/dummy-blockchain/tracer"
-)
-
-const (
-	GenesisHash   string = "0x0000000000000000000000000000000000000000000000000000000000000000"
-	GenesisHeight uint64 = 0
+	"github.com/streamingfast/dummy-blockchain/types"
 )
 
 type Flags struct {
-	GenesisBlockBurst    uint64
-	LogLevel             string
-	StoreDir             string
-	BlockRate            int
-	BlockSize            string
-	ServerAddr           string
-	WithCommitmentSignal bool
-	WithSkippedBlocks    bool
-	WithReorgs           bool
-	WithFlashBlocks      bool
-	Purge                bool
-	Tracer               string
-	StopHeight           uint64
+	GenesisBlockBurst         uint64
+	LogLevel                  string
+	StoreDir                  string
+	BlockRate                 int
+	BlockSize                 string
+	BlockWorkers              int
+	BlockLookahead            int
+	ServerAddr                string
+	ShutdownTimeout           time.Duration
+	WithCommitmentSignal      bool
+	SignalLevels              string
+	WithSkippedBlocks         bool
+	WithReorgs                bool
+	WithFlashBlocks           bool
+	FlashBlockPartials        int
+	FlashBlockInterval        time.Duration
+	FlashBlockContent         string
+	FlashBlockInvalidateEvery uint64
+	Purge                     bool
+	Retention                 string
+	ArchiveDir                string
+	ArchiveFormat             string
+	Tracer                    string
+	TracerPayloadCompression  string
+	TracerChaos               string
+	TracerChaosSeed           uint64
+	MergedBlocksDir           string
+	Upgrades                  string
+	TimestampMode             string
+	TimestampReplayFile       string
+	WithPropagationTime       bool
+	StopHeight                uint64
+	SimulatedClock            bool
 
 	Deprecated struct {
 		GenesisHeight  uint64
@@ -63,6 +83,10 @@ func Main(version string) {
 		makeInitCommand(),
 		makeResetCommand(),
 		makeStartComand(),
+		makeValidateCommand(),
+		makeConformanceCommand(),
+		makeBenchTracerCommand(),
+		makeGenerateCommand(),
 	)
 
 	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
@@ -75,21 +99,41 @@ func Main(version string) {
 func initFlags(root *cobra.Command) error {
 	flags := root.PersistentFlags()
 
-	flags.Uint64Var(&cliOpts.Deprecated.GenesisHeight, "genesis-height", 0, "Deprecated: The height of the genesis block, ignored, hard-coded to 0")
-	flags.StringVar(&cliOpts.Deprecated.GenesisTimeRaw, "genesis-time", "", "Deprecated: The time of the genesis block, ignored, hard-coded to current time")
+	flags.Uint64Var(&cliOpts.Deprecated.GenesisHeight, "genesis-height", 0, "Deprecated: The height of the genesis block, ignored, use 'init --genesis=<file>' instead")
+	flags.StringVar(&cliOpts.Deprecated.GenesisTimeRaw, "genesis-time", "", "Deprecated: The time of the genesis block, ignored, use 'init --genesis=<file>' instead")
 	flags.Uint64Var(&cliOpts.GenesisBlockBurst, "genesis-block-burst", 0, "The amount of block to produce when initially starting from genesis block")
 	flags.StringVar(&cliOpts.LogLevel, "log-level", "info", "Logging level")
 	flags.StringVar(&cliOpts.StoreDir, "store-dir", "./data", "Directory for storing blockchain state")
 	flags.IntVar(&cliOpts.BlockRate, "block-rate", 60, "Block production rate (per minute)")
-	flags.StringVar(&cliOpts.BlockSize, "block-size", "64 KiB", "Approximate block size (in bytes) to produce, accepts integere (with _) or human-readable sizes (e.g. 64KiB, 2 MiB)")
+	flags.StringVar(&cliOpts.BlockSize, "block-size", "64 KiB", "Block size (in bytes, as encoded in Protobuf) to produce, accepts integer (with _) or human-readable sizes (e.g. 64KiB, 2 MiB)")
+	flags.IntVar(&cliOpts.BlockWorkers, "block-workers", runtime.NumCPU(), "Amount of goroutines generating the transactions of a block, has no impact on the generated content")
+	flags.IntVar(&cliOpts.BlockLookahead, "block-lookahead", 2, "Amount of upcoming blocks whose transactions are generated in advance of the block ticker")
 	flags.Uint64Var(&cliOpts.StopHeight, "stop-height", 0, "Stop block production at this height")
+	flags.BoolVar(&cliOpts.SimulatedClock, "simulated-clock", false, "Pace the block production with a simulated clock running as fast as possible instead of the system clock, blocks, flash blocks and signals being produced in the same order as in real time, the wall-clock timestamps following the simulated time")
 	flags.StringVar(&cliOpts.ServerAddr, "server-addr", "0.0.0.0:8080", "Server address")
-	flags.StringVar(&cliOpts.Tracer, "tracer", "", "The tracer to use, either <empty>, none or firehose")
-	flags.BoolVar(&cliOpts.WithCommitmentSignal, "with-signal", false, "Whether we produce BlockCommitmentLevel signals on top of blocks")
-	flags.BoolVar(&cliOpts.WithFlashBlocks, "with-flash-blocks", false, "Whether we produce 4 flash blocks per block, skipping number 2 every 11 slots")
+	flags.DurationVar(&cliOpts.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "On shutdown, how long to wait for the blocks being produced to be stored and traced and for the server requests in progress, 0 waits as long as needed")
+	flags.StringVar(&cliOpts.Tracer, "tracer", "", "The tracer to use, either <empty>, none, firehose, merged-blocks or a comma-separated list of them (e.g. firehose,merged-blocks)")
+	flags.StringVar(&cliOpts.TracerPayloadCompression, "tracer-payload-compression", "none", "Compression applied to block payloads by the firehose tracer, either none or zstd (announced in 'FIRE INIT', the reader must support it)")
+	flags.StringVar(&cliOpts.TracerChaos, "tracer-chaos", "", "Corruptions injected in the firehose tracer output to test readers against bad input, a comma-separated list of <kind>=<trigger> (e.g. bad-prev-hash=0.01,duplicate-height=every:100,unknown-signal=at:42:84), see README for the kinds")
+	flags.Uint64Var(&cliOpts.TracerChaosSeed, "tracer-chaos-seed", 0, "Seed of the random --tracer-chaos injections, the same seed corrupts the same lines")
+	flags.StringVar(&cliOpts.MergedBlocksDir, "merged-blocks-dir", "", "Directory where the merged-blocks tracer writes Firehose merged blocks files, defaults to <store-dir>/merged-blocks")
+	flags.BoolVar(&cliOpts.WithCommitmentSignal, "with-signal", false, "Whether we produce BlockCommitmentLevel signals on top of blocks, one per block for each level of --signal-levels")
+	flags.StringVar(&cliOpts.SignalLevels, "signal-levels", core.DefaultCommitmentLevels().String(), "Commitment pipeline of the signals, a comma-separated list of <name>:<delay> levels numbered from 1, the delay being the amount of blocks built on top of a block after the previous level or 'final' for the last level reached when blocks become final, a block reorged out after a delayed level is signalled at level -1 (dropped)")
+	flags.BoolVar(&cliOpts.WithFlashBlocks, "with-flash-blocks", false, "Whether we produce flash blocks ahead of each block, see --flash-block-* flags (upgrades can enable or disable them at given heights)")
+	flags.IntVar(&cliOpts.FlashBlockPartials, "flash-block-partials", 3, "Amount of partial flash blocks produced before each block, followed by the final flash block indexed 1000 + partials + 1")
+	flags.DurationVar(&cliOpts.FlashBlockInterval, "flash-block-interval", 0, "Time between two flash blocks, the first one coming this long after the previous block, 0 spreads them evenly over the block interval")
+	flags.StringVar(&cliOpts.FlashBlockContent, "flash-block-content", "prefix", "Transactions of the upcoming block held by flash blocks, either prefix (all of them so far) or delta (the ones added since the previous flash block, the final one holding the remainder)")
+	flags.Uint64Var(&cliOpts.FlashBlockInvalidateEvery, "flash-block-invalidate-every", 11, "With reorgs, invalidate the flash blocks of the heights multiple of this: no final flash block is sent and the produced block differs from the partials, 0 disables it")
 	flags.BoolVar(&cliOpts.WithSkippedBlocks, "with-skipped-blocks", true, "Whether we skip a block number every 13 slots")
 	flags.BoolVar(&cliOpts.WithReorgs, "with-reorgs", true, "Whether we produce reorgs every 17 slots")
-	flags.BoolVar(&cliOpts.Purge, "purge", true, "Purge block groups not containing genesis, final, or head heights")
+	flags.StringVar(&cliOpts.Upgrades, "upgrades", "", "Protocol upgrade schedule applied after the genesis one, a JSON file or inline JSON array of upgrades (e.g. '[{\"height\": 1000, \"flash_blocks\": true, \"block_rate\": 120}]')")
+	flags.StringVar(&cliOpts.TimestampMode, "timestamp-mode", "slot", "How block timestamps are computed, either slot (genesis time plus the block interval of each height), wall-clock (time of production) or replay (read from --timestamp-replay-file)")
+	flags.StringVar(&cliOpts.TimestampReplayFile, "timestamp-replay-file", "", "File of '<height> <timestamp>' lines (RFC3339 or Unix nanoseconds) used by the replay timestamp mode, unlisted heights are placed relative to the closest listed one")
+	flags.BoolVar(&cliOpts.WithPropagationTime, "with-propagation-time", false, "Whether the wall-clock production time is carried in the block header 'propagation_time' field, whatever the timestamp mode")
+	flags.BoolVar(&cliOpts.Purge, "purge", true, "Purge block groups not containing genesis, final, or head heights, same as --retention=groups (false is --retention=all), ignored when --retention is set")
+	flags.StringVar(&cliOpts.Retention, "retention", "", "Blocks kept by the store, either all, groups (genesis, final and head block groups), last=<blocks>, age=<duration> (e.g. 48h, from block timestamps) or since=<height>, purged in groups of 1000 heights in the background, defaults to --purge")
+	flags.StringVar(&cliOpts.ArchiveDir, "archive-dir", "", "If set, block groups purged by the retention policy are archived to this directory instead of being deleted")
+	flags.StringVar(&cliOpts.ArchiveFormat, "archive-format", "tar.gz", "Format of archived block groups, either tar.gz (one <group>.tar.gz file per group) or dir (group directories moved as is)")
 
 	return nil
 }
@@ -108,23 +152,41 @@ func initLogger() error {
 }
 
 func makeInitCommand() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:          "init",
 		Short:        "Initialize local blockchain state",
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			warnDeprecatedFlags()
 
-			genesisTime := time.Now()
+			genesis := types.NewGenesis(time.Now())
+			if genesisFile, _ := cmd.Flags().GetString("genesis"); genesisFile != "" {
+				var err error
+				if genesis, err = types.ReadGenesisFile(genesisFile, time.Now()); err != nil {
+					return err
+				}
+			}
 
 			logrus.
 				WithField("dir", cliOpts.StoreDir).
+				WithField("genesis_height", genesis.Height).
+				WithField("genesis_hash", genesis.Hash).
+				WithField("genesis_time", genesis.Time).
+				WithField("genesis_alloc", len(genesis.Alloc)).
 				Info("initializing chain store")
 
-			store := core.NewStore(cliOpts.StoreDir, GenesisHash, GenesisHeight, genesisTime, false)
+			store := core.NewStore(cliOpts.StoreDir, genesis, core.Retention{})
+			if store.Exists() && cmd.Flags().Changed("genesis") {
+				return fmt.Errorf("chain store %q is already initialized, run 'reset' first to use another genesis", cliOpts.StoreDir)
+			}
+
 			return store.Initialize()
 		},
 	}
+
+	cmd.Flags().String("genesis", "", "Genesis JSON file defining the genesis block 'height', 'hash', 'time' (RFC3339) and initial account balances 'alloc' ({\"<address>\": <amount>}), defaults to height 0 at the current time")
+
+	return cmd
 }
 
 func makeResetCommand() *cobra.Command {
@@ -146,7 +208,7 @@ func makeResetCommand() *cobra.Command {
 }
 
 func makeStartComand() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:          "start",
 		Short:        "Start blockchain service",
 		SilenceUsage: true,
@@ -157,15 +219,42 @@ func makeStartComand() *cobra.Command {
 				return errors.New("block rate option must be greater than 1")
 			}
 
-			genesisTime := time.Now()
+			if chainsFile, _ := cmd.Flags().GetString("chains"); chainsFile != "" {
+				return startChains(chainsFile)
+			}
 
 			logrus.
 				WithField("dir", cliOpts.StoreDir).
 				Info("starting chain service")
 
-			var blockTracer tracer.Tracer
-			if cliOpts.Tracer == "firehose" {
-				blockTracer = &tracer.FirehoseTracer{}
+			blockTracer, err := newTracer(cliOpts.Tracer, os.Stdout, mergedBlocksDir())
+			if err != nil {
+				return err
+			}
+
+			upgrades, err := cliUpgrades()
+			if err != nil {
+				return err
+			}
+
+			timestamps, err := cliTimestamps()
+			if err != nil {
+				return err
+			}
+
+			retention, err := cliRetention(cliOpts.Retention, cliOpts.ArchiveDir)
+			if err != nil {
+				return err
+			}
+
+			flashBlocks, err := cliFlashBlocks()
+			if err != nil {
+				return err
+			}
+
+			commitmentLevels, err := core.ParseCommitmentLevels(cliOpts.SignalLevels)
+			if err != nil {
+				return err
 			}
 
 			blockSizeInBytes := 64 * 1024 // Default to 64 KiB
@@ -178,23 +267,36 @@ func makeStartComand() *cobra.Command {
 				blockSizeInBytes = int(parsedSize)
 			}
 
-			node := core.NewNode(
-				cliOpts.StoreDir,
-				cliOpts.BlockRate,
-				blockSizeInBytes,
-				GenesisHash,
-				GenesisHeight,
-				genesisTime,
-				cliOpts.GenesisBlockBurst,
-				cliOpts.StopHeight,
-				cliOpts.ServerAddr,
-				blockTracer,
-				cliOpts.WithCommitmentSignal,
-				cliOpts.WithSkippedBlocks,
-				cliOpts.WithReorgs,
-				cliOpts.WithFlashBlocks,
-				cliOpts.Purge,
-			)
+			node := core.NewNode(core.NodeConfig{
+				EngineConfig: core.EngineConfig{
+					BlockRate:         cliOpts.BlockRate,
+					BlockSizeInBytes:  blockSizeInBytes,
+					BlockWorkers:      cliOpts.BlockWorkers,
+					BlockLookahead:    cliOpts.BlockLookahead,
+					Upgrades:          upgrades,
+					Timestamps:        timestamps,
+					GenesisBlockBurst: cliOpts.GenesisBlockBurst,
+					StopHeight:        cliOpts.StopHeight,
+					WithSkippedBlocks: cliOpts.WithSkippedBlocks,
+					WithReorgs:        cliOpts.WithReorgs,
+					WithFlashBlocks:   cliOpts.WithFlashBlocks,
+					FlashBlocks:       flashBlocks,
+					CommitmentLevels:  commitmentLevels,
+				},
+				// Only used by a fresh store, an initialized one keeps its own genesis
+				Genesis:              types.NewGenesis(time.Now()),
+				StoreDir:             cliOpts.StoreDir,
+				Retention:            retention,
+				ServerAddr:           cliOpts.ServerAddr,
+				ShutdownTimeout:      cliOpts.ShutdownTimeout,
+				Tracer:               blockTracer,
+				WithCommitmentSignal: cliOpts.WithCommitmentSignal,
+			})
+
+			simulated := newSimulatedClock()
+			if simulated != nil {
+				node.SetClock(simulated)
+			}
 
 			if err := node.Initialize(); err != nil {
 				logrus.WithError(err).Fatal("node failed to initialize")
@@ -204,6 +306,10 @@ func makeStartComand() *cobra.Command {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
+			if simulated != nil {
+				go simulated.Run(ctx)
+			}
+
 			go func() {
 				sig := waitForSignal()
 				logrus.WithField("signal", sig).Info("shutting down")
@@ -219,15 +325,134 @@ func makeStartComand() *cobra.Command {
 			return nil
 		},
 	}
+
+	cmd.Flags().String("chains", "", "JSON file describing multiple chains to run side by side in this process, served under /chains/<name> (see README), the global flags are the defaults of each chain")
+
+	return cmd
+}
+
+// newSimulatedClock returns the clock run as fast as possible with --simulated-clock, starting
+// now, nil otherwise.
+func newSimulatedClock() *clock.Virtual {
+	if !cliOpts.SimulatedClock {
+		return nil
+	}
+
+	logrus.Info("pacing the block production with a simulated clock")
+	return clock.NewVirtual(time.Now())
+}
+
+// newTracer creates the tracer(s) listed in spec, the firehose one writing to output, nil is
+// returned when none is requested.
+func newTracer(spec string, output io.Writer, mergedBlocksDir string) (tracer.Tracer, error) {
+	var tracers tracer.MultiTracer
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "none":
+		case "firehose":
+			compression, err := tracer.ParsePayloadCompression(cliOpts.TracerPayloadCompression)
+			if err != nil {
+				return nil, err
+			}
+
+			chaos, err := tracer.ParseChaos(cliOpts.TracerChaos, cliOpts.TracerChaosSeed)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --tracer-chaos: %w", err)
+			}
+
+			firehoseTracer := tracer.NewFirehoseTracer(output, compression)
+			firehoseTracer.SetChaos(chaos)
+			tracers = append(tracers, firehoseTracer)
+		case "merged-blocks":
+			tracers = append(tracers, tracer.NewMergedBlocksTracer(mergedBlocksDir))
+		default:
+			return nil, fmt.Errorf("unknown tracer %q, valid values are none, firehose and merged-blocks", name)
+		}
+	}
+
+	switch len(tracers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return tracers[0], nil
+	}
+
+	return tracers, nil
+}
+
+// cliUpgrades returns the upgrades given with --upgrades, if any.
+func cliUpgrades() ([]types.Upgrade, error) {
+	if cliOpts.Upgrades == "" {
+		return nil, nil
+	}
+
+	return types.ReadUpgrades(cliOpts.Upgrades)
+}
+
+// cliTimestamps returns the block timestamps configured with --timestamp-mode.
+func cliTimestamps() (*core.Timestamps, error) {
+	mode, err := core.ParseTimestampMode(cliOpts.TimestampMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.NewTimestamps(mode, cliOpts.TimestampReplayFile, cliOpts.WithPropagationTime)
+}
+
+// cliFlashBlocks returns the flash blocks configured with the --flash-block-* flags.
+func cliFlashBlocks() (core.FlashBlockConfig, error) {
+	content, err := core.ParseFlashBlockContent(cliOpts.FlashBlockContent)
+	if err != nil {
+		return core.FlashBlockConfig{}, err
+	}
+
+	config := core.FlashBlockConfig{
+		Partials:        cliOpts.FlashBlockPartials,
+		Interval:        cliOpts.FlashBlockInterval,
+		Content:         content,
+		InvalidateEvery: cliOpts.FlashBlockInvalidateEvery,
+	}
+
+	return config, config.Validate()
+}
+
+// cliRetention returns the store retention of policy (--purge when empty), archiving purged
+// groups to archiveDir if set.
+func cliRetention(policy string, archiveDir string) (core.Retention, error) {
+	if policy == "" {
+		policy = string(core.RetentionAll)
+		if cliOpts.Purge {
+			policy = string(core.RetentionGroups)
+		}
+	}
+
+	retention, err := core.ParseRetention(policy)
+	if err != nil {
+		return core.Retention{}, err
+	}
+
+	if archiveDir == "" {
+		return retention, nil
+	}
+
+	return retention.WithArchive(archiveDir, core.ArchiveFormat(cliOpts.ArchiveFormat))
+}
+
+func mergedBlocksDir() string {
+	if cliOpts.MergedBlocksDir != "" {
+		return cliOpts.MergedBlocksDir
+	}
+
+	return filepath.Join(cliOpts.StoreDir, "merged-blocks")
 }
 
 func warnDeprecatedFlags() {
 	if cliOpts.Deprecated.GenesisHeight != 0 {
-		logrus.Warn("the --genesis-height flag is deprecated and ignored, the genesis height is hard-coded to 0")
+		logrus.Warn("the --genesis-height flag is deprecated and ignored, use 'init --genesis=<file>' to configure the genesis block")
 	}
 
 	if cliOpts.Deprecated.GenesisTimeRaw != "" {
-		logrus.Warn("the --genesis-time flag is deprecated and ignored, the genesis time is hard-coded to current time")
+		logrus.Warn("the --genesis-time flag is deprecated and ignored, use 'init --genesis=<file>' to configure the genesis block")
 	}
 }
 
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+)
+
+func makeBenchTracerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "bench-tracer",
+		Short:        "Benchmark the firehose tracer encoding of blocks of various sizes",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rawSizes, _ := cmd.Flags().GetStringSlice("sizes")
+			rawCompressions, _ := cmd.Flags().GetStringSlice("compressions")
+			iterations, _ := cmd.Flags().GetInt("iterations")
+
+			if iterations < 1 {
+				return fmt.Errorf("iterations must be greater than 0")
+			}
+
+			for _, rawSize := range rawSizes {
+				size, err := parseByteSize(strings.TrimSpace(rawSize))
+				if err != nil {
+					return err
+				}
+
+				block := core.NewSampleBlock(1, int(size))
+
+				for _, rawCompression := range rawCompressions {
+					compression, err := tracer.ParsePayloadCompression(strings.TrimSpace(rawCompression))
+					if err != nil {
+						return err
+					}
+
+					output := &countingWriter{}
+					blockTracer := tracer.NewFirehoseTracer(output, compression)
+					if err := blockTracer.Initialize("3.0"); err != nil {
+						return err
+					}
+
+					// Warm-up so that re-used buffers are sized
+					if err := tracer.TraceBlock(blockTracer, block, block.Header); err != nil {
+						return err
+					}
+					output.count = 0
+
+					var before, after runtime.MemStats
+					runtime.GC()
+					runtime.ReadMemStats(&before)
+
+					start := time.Now()
+					for range iterations {
+						if err := tracer.TraceBlock(blockTracer, block, block.Header); err != nil {
+							return err
+						}
+					}
+					elapsed := time.Since(start)
+
+					runtime.ReadMemStats(&after)
+
+					perBlock := elapsed / time.Duration(iterations)
+					fmt.Printf("size=%-10s compression=%-5s %12s/block %10s/s output=%-10s alloc=%s/block\n",
+						humanize.IBytes(size),
+						compression,
+						perBlock,
+						humanize.IBytes(uint64(float64(size)/perBlock.Seconds())),
+						humanize.IBytes(output.count/uint64(iterations)),
+						humanize.IBytes((after.TotalAlloc-before.TotalAlloc)/uint64(iterations)),
+					)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice("sizes", []string{"1MiB", "10MiB", "50MiB", "100MiB"}, "Block sizes to benchmark")
+	cmd.Flags().StringSlice("compressions", []string{"none", "zstd"}, "Payload compressions to benchmark")
+	cmd.Flags().Int("iterations", 5, "Amount of blocks traced per size and compression")
+
+	return cmd
+}
+
+type countingWriter struct {
+	count uint64
+}
+
+var _ io.Writer = (*countingWriter)(nil)
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += uint64(len(p))
+	return len(p), nil
+}
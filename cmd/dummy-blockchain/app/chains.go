@@ -0,0 +1,435 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// chainsConfig is the JSON file given to `start --chains`, describing the chains to run side
+// by side in the same process.
+type chainsConfig struct {
+	// ServerAddr is the address of the HTTP server shared by the chains, defaults to --server-addr
+	ServerAddr *string       `json:"server_addr,omitempty"`
+	Chains     []chainConfig `json:"chains"`
+}
+
+// chainConfig describes one chain, unset fields default to the value of the matching flag.
+type chainConfig struct {
+	Name string `json:"name"`
+
+	// StoreDir defaults to <store-dir>/<name>
+	StoreDir string `json:"store_dir,omitempty"`
+
+	// Genesis is the path of a genesis file (see 'init --genesis'), only used when the store
+	// is not initialized yet.
+	Genesis string `json:"genesis,omitempty"`
+
+	BlockRate         int             `json:"block_rate,omitempty"`
+	BlockSize         string          `json:"block_size,omitempty"`
+	GenesisBlockBurst uint64          `json:"genesis_block_burst,omitempty"`
+	StopHeight        uint64          `json:"stop_height,omitempty"`
+	Upgrades          []types.Upgrade `json:"upgrades,omitempty"`
+
+	WithSignal        *bool `json:"with_signal,omitempty"`
+	WithSkippedBlocks *bool `json:"with_skipped_blocks,omitempty"`
+	WithReorgs        *bool `json:"with_reorgs,omitempty"`
+	WithFlashBlocks   *bool `json:"with_flash_blocks,omitempty"`
+
+	// SignalLevels has the same format as --signal-levels.
+	SignalLevels string `json:"signal_levels,omitempty"`
+
+	// FlashBlockPartials, FlashBlockInterval (a duration, e.g. "250ms"), FlashBlockContent
+	// and FlashBlockInvalidateEvery have the same meaning as the --flash-block-* flags.
+	FlashBlockPartials        *int    `json:"flash_block_partials,omitempty"`
+	FlashBlockInterval        string  `json:"flash_block_interval,omitempty"`
+	FlashBlockContent         string  `json:"flash_block_content,omitempty"`
+	FlashBlockInvalidateEvery *uint64 `json:"flash_block_invalidate_every,omitempty"`
+
+	// TimestampMode and TimestampReplayFile have the same meaning as the flags, the replay
+	// file flag is only inherited when the mode is not set.
+	TimestampMode       string `json:"timestamp_mode,omitempty"`
+	TimestampReplayFile string `json:"timestamp_replay_file,omitempty"`
+	WithPropagationTime *bool  `json:"with_propagation_time,omitempty"`
+
+	// Retention has the same format as --retention, ArchiveDir defaults to <archive-dir>/<name>
+	// when --archive-dir is set.
+	Retention  string `json:"retention,omitempty"`
+	ArchiveDir string `json:"archive_dir,omitempty"`
+
+	// Tracer has the same format as --tracer, TracerOutput is the file the firehose tracer
+	// appends to (stdout when empty, only one chain can use it), MergedBlocksDir defaults to
+	// <store_dir>/merged-blocks.
+	Tracer          *string `json:"tracer,omitempty"`
+	TracerOutput    string  `json:"tracer_output,omitempty"`
+	MergedBlocksDir string  `json:"merged_blocks_dir,omitempty"`
+
+	// Bridges are the names of the chains whose final blocks are referenced by bridge
+	// transactions in this chain's blocks.
+	Bridges []string `json:"bridges,omitempty"`
+}
+
+var chainNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func readChainsConfig(path string) (*chainsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &chainsConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("decode chains config %q: %w", path, err)
+	}
+
+	if len(config.Chains) == 0 {
+		return nil, fmt.Errorf("chains config %q has no chains", path)
+	}
+
+	names := map[string]bool{}
+	for _, chain := range config.Chains {
+		if !chainNameRegex.MatchString(chain.Name) {
+			return nil, fmt.Errorf("chain name %q must only contain letters, digits, '-' and '_'", chain.Name)
+		}
+
+		if names[chain.Name] {
+			return nil, fmt.Errorf("chain %q is defined more than once", chain.Name)
+		}
+		names[chain.Name] = true
+	}
+
+	stdoutChain := ""
+	for _, chain := range config.Chains {
+		for _, remote := range chain.Bridges {
+			if !names[remote] {
+				return nil, fmt.Errorf("chain %q bridges to unknown chain %q", chain.Name, remote)
+			}
+
+			if remote == chain.Name {
+				return nil, fmt.Errorf("chain %q cannot bridge to itself", chain.Name)
+			}
+		}
+
+		if strings.Contains(chain.tracer(), "firehose") && chain.TracerOutput == "" {
+			if stdoutChain != "" {
+				return nil, fmt.Errorf("chains %q and %q both write firehose logs to stdout, set 'tracer_output' on one of them", stdoutChain, chain.Name)
+			}
+			stdoutChain = chain.Name
+		}
+	}
+
+	return config, nil
+}
+
+func (c *chainConfig) tracer() string {
+	if c.Tracer != nil {
+		return *c.Tracer
+	}
+
+	return cliOpts.Tracer
+}
+
+func (c *chainConfig) flashBlocks() (core.FlashBlockConfig, error) {
+	config, err := cliFlashBlocks()
+	if err != nil {
+		return config, err
+	}
+
+	if c.FlashBlockPartials != nil {
+		config.Partials = *c.FlashBlockPartials
+	}
+
+	if c.FlashBlockInterval != "" {
+		if config.Interval, err = time.ParseDuration(c.FlashBlockInterval); err != nil {
+			return config, fmt.Errorf("invalid flash block interval: %w", err)
+		}
+	}
+
+	if c.FlashBlockContent != "" {
+		if config.Content, err = core.ParseFlashBlockContent(c.FlashBlockContent); err != nil {
+			return config, err
+		}
+	}
+
+	if c.FlashBlockInvalidateEvery != nil {
+		config.InvalidateEvery = *c.FlashBlockInvalidateEvery
+	}
+
+	return config, config.Validate()
+}
+
+func (c *chainConfig) storeDir() string {
+	if c.StoreDir != "" {
+		return c.StoreDir
+	}
+
+	return filepath.Join(cliOpts.StoreDir, c.Name)
+}
+
+// newNode creates the node of the chain, the closer releases the tracer output.
+func (c *chainConfig) newNode() (node *core.Node, closer io.Closer, err error) {
+	blockRate := cliOpts.BlockRate
+	if c.BlockRate != 0 {
+		blockRate = c.BlockRate
+	}
+
+	if blockRate < 1 {
+		return nil, nil, errors.New("block rate must be greater than 1")
+	}
+
+	blockSizeInBytes, err := parseByteSize(valueOr(c.BlockSize, cliOpts.BlockSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upgrades, err := cliUpgrades()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Upgrades != nil {
+		upgrades = c.Upgrades
+	}
+
+	replayFile := c.TimestampReplayFile
+	if c.TimestampMode == "" && replayFile == "" {
+		replayFile = cliOpts.TimestampReplayFile
+	}
+
+	mode, err := core.ParseTimestampMode(valueOr(c.TimestampMode, cliOpts.TimestampMode))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timestamps, err := core.NewTimestamps(mode, replayFile, boolOr(c.WithPropagationTime, cliOpts.WithPropagationTime))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archiveDir := c.ArchiveDir
+	if archiveDir == "" && cliOpts.ArchiveDir != "" {
+		archiveDir = filepath.Join(cliOpts.ArchiveDir, c.Name)
+	}
+
+	retention, err := cliRetention(valueOr(c.Retention, cliOpts.Retention), archiveDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flashBlocks, err := c.flashBlocks()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitmentLevels, err := core.ParseCommitmentLevels(valueOr(c.SignalLevels, cliOpts.SignalLevels))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only used by a fresh store, an initialized one keeps its own genesis
+	genesis := types.NewGenesis(time.Now())
+	if c.Genesis != "" {
+		if genesis, err = types.ReadGenesisFile(c.Genesis, time.Now()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var output io.WriteCloser = nopCloser{os.Stdout}
+	if c.TracerOutput != "" {
+		if output, err = os.OpenFile(c.TracerOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return nil, nil, fmt.Errorf("open tracer output: %w", err)
+		}
+	}
+
+	blockTracer, err := newTracer(c.tracer(), output, valueOr(c.MergedBlocksDir, filepath.Join(c.storeDir(), "merged-blocks")))
+	if err != nil {
+		output.Close()
+		return nil, nil, err
+	}
+
+	node = core.NewNode(core.NodeConfig{
+		EngineConfig: core.EngineConfig{
+			BlockRate:         blockRate,
+			BlockSizeInBytes:  int(blockSizeInBytes),
+			BlockWorkers:      cliOpts.BlockWorkers,
+			BlockLookahead:    cliOpts.BlockLookahead,
+			Upgrades:          upgrades,
+			Timestamps:        timestamps,
+			GenesisBlockBurst: valueOr(c.GenesisBlockBurst, cliOpts.GenesisBlockBurst),
+			StopHeight:        valueOr(c.StopHeight, cliOpts.StopHeight),
+			WithSkippedBlocks: boolOr(c.WithSkippedBlocks, cliOpts.WithSkippedBlocks),
+			WithReorgs:        boolOr(c.WithReorgs, cliOpts.WithReorgs),
+			WithFlashBlocks:   boolOr(c.WithFlashBlocks, cliOpts.WithFlashBlocks),
+			FlashBlocks:       flashBlocks,
+			CommitmentLevels:  commitmentLevels,
+		},
+		Genesis:   genesis,
+		StoreDir:  c.storeDir(),
+		Retention: retention,
+		// No server address, the chains are served by the shared multi-chain server
+		ShutdownTimeout:      cliOpts.ShutdownTimeout,
+		Tracer:               blockTracer,
+		WithCommitmentSignal: boolOr(c.WithSignal, cliOpts.WithCommitmentSignal),
+	})
+
+	return node, output, nil
+}
+
+// startChains runs the chains described in the config file until interrupted, the first
+// chain failing stops all of them.
+func startChains(configFile string) error {
+	config, err := readChainsConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	// The chains share the simulated clock, their blocks being produced in the same order as
+	// in real time
+	simulated := newSimulatedClock()
+
+	nodes := make(map[string]*core.Node, len(config.Chains))
+	stores := make(map[string]*core.Store, len(config.Chains))
+	for _, chain := range config.Chains {
+		logrus.WithField("chain", chain.Name).WithField("dir", chain.storeDir()).Info("starting chain service")
+
+		node, closer, err := chain.newNode()
+		if err != nil {
+			return fmt.Errorf("chain %q: %w", chain.Name, err)
+		}
+		defer closer.Close()
+
+		if simulated != nil {
+			node.SetClock(simulated)
+		}
+
+		if err := node.Initialize(); err != nil {
+			return fmt.Errorf("chain %q: initialize node: %w", chain.Name, err)
+		}
+
+		nodes[chain.Name] = node
+		stores[chain.Name] = node.Store()
+	}
+
+	for _, chain := range config.Chains {
+		for _, remote := range chain.Bridges {
+			logrus.WithField("chain", chain.Name).WithField("remote_chain", remote).Info("bridging chain")
+			nodes[chain.Name].BridgeTo(remote, nodes[remote])
+		}
+	}
+
+	serverAddr := cliOpts.ServerAddr
+	if config.ServerAddr != nil {
+		serverAddr = *config.ServerAddr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		sig := waitForSignal()
+		logrus.WithField("signal", sig).Info("shutting down")
+		cancel()
+	}()
+
+	if simulated != nil {
+		go simulated.Run(ctx)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs []error
+	)
+
+	if serverAddr != "" {
+		server := core.NewMultiChainServer(stores, serverAddr)
+		defer shutdownServer(&server)
+
+		go func() {
+			if err := server.Start(); err != nil {
+				logrus.WithError(err).Error("server terminated with error, stopping all chains")
+
+				lock.Lock()
+				errs = append(errs, fmt.Errorf("server: %w", err))
+				lock.Unlock()
+
+				cancel()
+			}
+		}()
+	}
+
+	for name, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := node.Start(ctx); err != nil {
+				logrus.WithError(err).WithField("chain", name).Error("chain terminated with error, stopping all chains")
+
+				lock.Lock()
+				errs = append(errs, fmt.Errorf("chain %q: %w", name, err))
+				lock.Unlock()
+
+				cancel()
+				return
+			}
+
+			logrus.WithField("chain", name).Info("chain terminated")
+		}()
+	}
+
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// shutdownServer waits for the server requests in progress, at most --shutdown-timeout.
+func shutdownServer(server *core.Server) {
+	ctx := context.Background()
+	if cliOpts.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cliOpts.ShutdownTimeout)
+		defer cancel()
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Warn("server shutdown did not complete")
+	}
+}
+
+func valueOr[T comparable](value T, def T) T {
+	var zero T
+	if value == zero {
+		return def
+	}
+
+	return value
+}
+
+func boolOr(value *bool, def bool) bool {
+	if value == nil {
+		return def
+	}
+
+	return *value
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+func makeGenerateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "generate",
+		Short:        "Generate historical blocks as fast as possible straight to the store, back-dating a fresh store so 'start' continues from the generated head",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			warnDeprecatedFlags()
+
+			if cliOpts.BlockRate < 1 {
+				return errors.New("block rate option must be greater than 1")
+			}
+
+			from, _ := cmd.Flags().GetUint64("from")
+			to, _ := cmd.Flags().GetUint64("to")
+			workers, _ := cmd.Flags().GetInt("workers")
+			output, _ := cmd.Flags().GetString("output")
+
+			toStore, toMergedBlocks := false, false
+			for _, name := range strings.Split(output, ",") {
+				switch strings.TrimSpace(name) {
+				case "store":
+					toStore = true
+				case "merged-blocks":
+					toMergedBlocks = true
+				default:
+					return fmt.Errorf("unknown output %q, valid values are store and merged-blocks", name)
+				}
+			}
+
+			blockSizeInBytes, err := parseByteSize(cliOpts.BlockSize)
+			if err != nil {
+				return err
+			}
+
+			upgrades, err := cliUpgrades()
+			if err != nil {
+				return err
+			}
+
+			timestamps, err := cliTimestamps()
+			if err != nil {
+				return err
+			}
+
+			if timestamps.Mode() == core.TimestampModeWallClock {
+				return errors.New("wall-clock timestamp mode cannot be used to generate history, blocks would all be timestamped now")
+			}
+
+			// Flash blocks are never part of the history, they are replaced by their full block
+			engine := core.NewEngine(core.EngineConfig{
+				BlockRate:         cliOpts.BlockRate,
+				BlockSizeInBytes:  int(blockSizeInBytes),
+				BlockWorkers:      1,
+				Upgrades:          upgrades,
+				Timestamps:        timestamps,
+				WithSkippedBlocks: cliOpts.WithSkippedBlocks,
+				WithReorgs:        cliOpts.WithReorgs,
+			})
+
+			// Only used by a fresh store, stores initialized with a genesis file keep their own.
+			// It's back-dated so that block `to` is produced now.
+			genesis := types.NewGenesis(time.Time{})
+			if err := engine.SetGenesis(genesis); err != nil {
+				return err
+			}
+			genesis.Time = time.Now().Add(-engine.Schedule().Timestamp(time.Time{}, to).Sub(time.Time{}))
+
+			store := core.NewStore(cliOpts.StoreDir, genesis, core.Retention{})
+			if err := store.Initialize(); err != nil {
+				return err
+			}
+
+			genesis = store.Genesis()
+			if err := engine.SetGenesis(genesis); err != nil {
+				return err
+			}
+
+			if to <= genesis.Height {
+				return fmt.Errorf("--to must be greater than genesis height %d", genesis.Height)
+			}
+
+			if !cmd.Flags().Changed("from") {
+				from = store.HeadHeight() + 1
+			}
+
+			// Genesis block is never written, it's implied by the store meta
+			from = max(from, genesis.Height+1)
+
+			if from > store.HeadHeight()+1 {
+				return fmt.Errorf("--from %d would leave a gap after the store head %d", from, store.HeadHeight())
+			}
+
+			if from > to {
+				return fmt.Errorf("--from %d is above --to %d", from, to)
+			}
+
+			if lastTime := engine.Schedule().Timestamp(genesis.Time, to); lastTime.After(time.Now().Add(time.Minute)) {
+				logrus.WithField("last_block_time", lastTime).Warn("store genesis time is not back-dated enough, generated blocks will be in the future")
+			}
+
+			parent, final, err := historyParent(store, engine.Schedule(), from)
+			if err != nil {
+				return err
+			}
+
+			if err := engine.Initialize(parent, final); err != nil {
+				return err
+			}
+			engine.SetProducerKey(store.ProducerKey())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go func() {
+				sig := waitForSignal()
+				logrus.WithField("signal", sig).Info("interrupting generation")
+				cancel()
+			}()
+
+			var mergedBlocks *tracer.MergedBlocksTracer
+			if toMergedBlocks {
+				mergedBlocks = tracer.NewMergedBlocksTracer(mergedBlocksDir())
+				if err := mergedBlocks.Initialize("3.0"); err != nil {
+					return err
+				}
+
+				// The first bundle is only complete if it starts with the genesis block
+				if parent.Header.Height == genesis.Height {
+					if err := tracer.TraceBlock(mergedBlocks, parent, parent.Header); err != nil {
+						return err
+					}
+				}
+			}
+
+			write := func(block *types.Block) error {
+				if toStore {
+					if err := store.WriteHistoricalBlock(block); err != nil {
+						return err
+					}
+				}
+
+				if mergedBlocks != nil {
+					if err := tracer.TraceBlock(mergedBlocks, block, nil); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}
+
+			logrus.
+				WithField("from", parent.Header.Height+1).
+				WithField("to", to).
+				WithField("workers", workers).
+				WithField("size", blockSizeInBytes).
+				WithField("output", output).
+				Info("generating historical blocks")
+
+			last, err := engine.GenerateHistory(ctx, to, workers, write)
+
+			if toMergedBlocks && last != nil {
+				logrus.
+					WithField("dir", mergedBlocksDir()).
+					WithField("final", last.Header.FinalNum).
+					Info("merged blocks written up to the last irreversible bundle, heights above the final block are not included")
+			}
+
+			// Even when interrupted, blocks written so far form a valid chain, so the head is
+			// moved to the last one to allow resuming.
+			if toStore && last != nil {
+				if err := store.SetHead(last.Header.Height, last.Header.FinalNum); err != nil {
+					return fmt.Errorf("set store head: %w", err)
+				}
+
+				logrus.WithField("head", last.Header.Height).WithField("final", last.Header.FinalNum).Info("store head updated")
+			}
+
+			return err
+		},
+	}
+
+	cmd.Flags().Uint64("from", 0, "First height to generate, defaults to the store head + 1, lower values re-generate (identically) already stored blocks")
+	cmd.Flags().Uint64("to", 0, "Last height to generate (inclusive), required")
+	cmd.Flags().Int("workers", runtime.NumCPU(), "Amount of blocks generated in parallel")
+	cmd.Flags().String("output", "store", "Where generated blocks are written, either store, merged-blocks (to --merged-blocks-dir, only bundles below the final block) or both comma-separated")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// historyParent finds the stored block right before from, skipping the heights that were
+// never produced, along with the final block the engine had when producing it.
+func historyParent(store *core.Store, schedule *types.Schedule, from uint64) (parent *types.Block, final *types.Block, err error) {
+	genesisHeight := store.Genesis().Height
+	for height := from - 1; parent == nil; height-- {
+		if height <= genesisHeight {
+			parent, err = store.ReadBlock(genesisHeight)
+			if err != nil {
+				return nil, nil, fmt.Errorf("read genesis block: %w", err)
+			}
+			break
+		}
+
+		block, err := store.ReadBlock(height)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, nil, fmt.Errorf("read block #%d: %w", height, err)
+		}
+
+		parent = block
+	}
+
+	if schedule.Rules(parent.Header.Height).IsFinal(parent.Header.Height) {
+		return parent, parent, nil
+	}
+
+	final, err = store.ReadBlock(parent.Header.FinalNum)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read final block #%d: %w", parent.Header.FinalNum, err)
+	}
+
+	return parent, final, nil
+}
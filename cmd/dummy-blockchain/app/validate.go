@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dummy-blockchain/conformance"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/firehose"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+)
+
+func makeValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "validate [<file>]",
+		Short:        "Validate a Firehose protocol stream read from a file or from standard input",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var input io.Reader = os.Stdin
+			if len(args) == 1 {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+
+				input = file
+			}
+
+			var decoder firehose.PayloadDecoder
+			if decodePayload, _ := cmd.Flags().GetBool("decode-payload"); decodePayload {
+				decoder = conformance.DecodeAcmeBlock
+			}
+
+			report, err := firehose.Validate(input, decoder)
+			if err != nil {
+				return err
+			}
+
+			return printReport(report)
+		},
+	}
+
+	cmd.Flags().Bool("decode-payload", true, "Decode block payloads as 'sf.acme.type.v1.Block' and cross-check them with line fields, disable for other chains")
+
+	return cmd
+}
+
+func makeConformanceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "conformance",
+		Short:        "Run an in-process chain with reorgs, skipped blocks, flash blocks and signals and validate its Firehose stream",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := conformance.DefaultConfig()
+			blocks, _ := cmd.Flags().GetUint64("blocks")
+			config.GenesisHeight, _ = cmd.Flags().GetUint64("first-block")
+			config.StopHeight = config.GenesisHeight + blocks
+			config.BlockRate, _ = cmd.Flags().GetInt("rate")
+			config.Restarts, _ = cmd.Flags().GetInt("restarts")
+			config.RestartSeed, _ = cmd.Flags().GetUint64("restart-seed")
+			config.Crash, _ = cmd.Flags().GetBool("crash")
+			config.SimulatedClock = cliOpts.SimulatedClock
+
+			compression, err := tracer.ParsePayloadCompression(cliOpts.TracerPayloadCompression)
+			if err != nil {
+				return err
+			}
+			config.PayloadCompression = compression
+
+			if config.Timestamps, err = cliTimestamps(); err != nil {
+				return err
+			}
+
+			if config.Upgrades, err = cliUpgrades(); err != nil {
+				return err
+			}
+
+			if config.FlashBlocks, err = cliFlashBlocks(); err != nil {
+				return err
+			}
+
+			if config.CommitmentLevels, err = core.ParseCommitmentLevels(cliOpts.SignalLevels); err != nil {
+				return err
+			}
+
+			if output, _ := cmd.Flags().GetString("output"); output != "" {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+
+				config.Output = file
+			}
+
+			logrus.WithField("genesis_height", config.GenesisHeight).WithField("stop_height", config.StopHeight).WithField("rate", config.BlockRate).WithField("restarts", config.Restarts).Info("running conformance suite")
+
+			report, err := conformance.Run(context.Background(), config)
+			if err != nil {
+				return err
+			}
+
+			return printReport(report)
+		},
+	}
+
+	cmd.Flags().Uint64("blocks", 60, "Amount of heights after genesis at which the conformance run stops")
+	cmd.Flags().Uint64("first-block", 0, "Genesis height of the conformance chain, to exercise streams not starting at 0")
+	cmd.Flags().Int("rate", 600, "Block production rate (per minute) of the conformance run")
+	cmd.Flags().String("output", "", "If set, also write the raw Firehose stream to this file")
+	cmd.Flags().Int("restarts", 0, "Amount of times the node is stopped at an arbitrary point and restarted on the same store during the run")
+	cmd.Flags().Uint64("restart-seed", 1, "Seed drawing the points at which the node is restarted, to reproduce a run")
+	cmd.Flags().Bool("crash", false, "Abort the node at each restart like a crash, right after an arbitrary traced block, flash block or signal, instead of stopping it gracefully")
+
+	return cmd
+}
+
+func printReport(report *firehose.Report) error {
+	for _, violation := range report.Violations {
+		fmt.Println(violation.String())
+	}
+
+	fmt.Println(report.String())
+
+	if !report.Valid() {
+		return fmt.Errorf("stream has %d protocol violations", len(report.Violations))
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+// Package conformance runs a dummy chain node in-process and validates the Firehose
+// protocol stream it emits, see firehose.Validator for the checked invariants.
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/clock"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/firehose"
+	pbacme "github.com/streamingfast/dummy-blockchain/pb/sf/acme/type/v1"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+	"github.com/streamingfast/dummy-blockchain/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Config controls the chain features exercised by a conformance run.
+type Config struct {
+	// GenesisHeight is the height of the first block of the chain.
+	GenesisHeight uint64
+
+	// StopHeight is the last block height produced before the run ends.
+	StopHeight uint64
+
+	// BlockRate is the amount of blocks per minute, keep it high for runs to complete quickly.
+	BlockRate int
+
+	// BlockSizeInBytes is the approximate size of each produced block.
+	BlockSizeInBytes int
+
+	WithReorgs           bool
+	WithSkippedBlocks    bool
+	WithFlashBlocks      bool
+	WithCommitmentSignal bool
+
+	// FlashBlocks configures the flash blocks when WithFlashBlocks is set.
+	FlashBlocks core.FlashBlockConfig
+
+	// CommitmentLevels is the commitment pipeline of the signals when WithCommitmentSignal is set.
+	CommitmentLevels core.CommitmentLevels
+
+	// Upgrades is the protocol upgrade schedule applied to the chain.
+	Upgrades []types.Upgrade
+
+	// Timestamps computes the block timestamps, slot mode when nil.
+	Timestamps *core.Timestamps
+
+	// PayloadCompression is the codec used by the tracer on block payloads.
+	PayloadCompression tracer.PayloadCompression
+
+	// Output receives a copy of the raw Firehose stream when non-nil.
+	Output io.Writer
+
+	// Restarts is the amount of times the node is stopped at an arbitrary point and restarted
+	// on the same store, the stream of all the runs being validated as one. The points are
+	// drawn from RestartSeed so that a run can be reproduced.
+	Restarts    int
+	RestartSeed uint64
+
+	// Crash aborts the node at each restart instead of stopping it gracefully, like a crash
+	// would, right after an arbitrary block, flash block or signal was traced. The amount of
+	// items traced before the crash is drawn from RestartSeed.
+	Crash bool
+
+	// SimulatedClock paces the node with a virtual clock running as fast as possible instead
+	// of the system clock, the block rate then only sets the block timestamps. The restart
+	// points are drawn in the simulated time, the whole run being reproduced by RestartSeed.
+	SimulatedClock bool
+}
+
+// DefaultConfig exercises every chain feature over a range covering a few reorgs, skipped
+// heights and flash blocks.
+func DefaultConfig() Config {
+	return Config{
+		StopHeight:           60,
+		BlockRate:            600,
+		BlockSizeInBytes:     4 * 1024,
+		WithReorgs:           true,
+		WithSkippedBlocks:    true,
+		WithFlashBlocks:      true,
+		WithCommitmentSignal: true,
+		FlashBlocks:          core.DefaultFlashBlockConfig(),
+		CommitmentLevels:     core.DefaultCommitmentLevels(),
+	}
+}
+
+// Run produces blocks with the given configuration until config.StopHeight is reached and
+// validates the emitted Firehose stream, restarting the node config.Restarts times along.
+func Run(ctx context.Context, config Config) (*firehose.Report, error) {
+	storeDir, err := os.MkdirTemp("", "dummy-blockchain-conformance-")
+	if err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+	defer os.RemoveAll(storeDir)
+
+	reader, writer := io.Pipe()
+
+	var output io.Writer = writer
+	if config.Output != nil {
+		output = io.MultiWriter(writer, config.Output)
+	}
+
+	validated := make(chan *firehose.Report, 1)
+	go func() {
+		report, err := firehose.Validate(bufio.NewReader(reader), DecodeAcmeBlock)
+		if err != nil {
+			reader.CloseWithError(err)
+		}
+
+		validated <- report
+	}()
+
+	genesis := &types.Genesis{Height: config.GenesisHeight, Hash: types.DefaultGenesisHash, Time: time.Now()}
+	random := rand.New(rand.NewPCG(config.RestartSeed, config.RestartSeed))
+
+	// Each run is stopped after about the time to produce its share of the heights, or
+	// crashed after about its share of the traced items
+	runDuration := time.Duration(config.StopHeight-config.GenesisHeight+1) * time.Minute / time.Duration(config.BlockRate*(config.Restarts+1))
+	runItems := int(config.StopHeight-config.GenesisHeight+1) * config.itemsPerHeight() / (config.Restarts + 1)
+
+	var simulated *clock.Virtual
+	if config.SimulatedClock {
+		simulated = clock.NewVirtual(genesis.Time)
+	}
+
+	nodeErr := func() error {
+		defer writer.Close()
+
+		for run := 0; run <= config.Restarts && ctx.Err() == nil; run++ {
+			runCtx, cancel := context.WithCancel(ctx)
+			restart := run < config.Restarts
+
+			var stopAfter time.Duration
+			var crashAfter int
+			switch {
+			case restart && config.Crash:
+				crashAfter = random.IntN(2*runItems) + 1
+				logrus.WithField("run", run+1).WithField("crash_after", crashAfter).Info("node will be crashed and restarted")
+			case restart:
+				stopAfter = time.Duration(random.Int64N(int64(2*runDuration) + 1))
+				logrus.WithField("run", run+1).WithField("stop_after", stopAfter).Info("node will be stopped and restarted")
+			}
+
+			var nodeClock clock.Clock = clock.Real
+			clocked := make(chan struct{})
+			switch {
+			case simulated != nil && crashAfter > 0:
+				nodeClock = simulated
+				go func() {
+					defer close(clocked)
+					simulated.Run(runCtx)
+				}()
+			case simulated != nil:
+				// The simulated time runs as fast as possible, the node being stopped once
+				// stopAfter of it elapsed
+				nodeClock = simulated
+				go func() {
+					defer close(clocked)
+					if !restart {
+						simulated.Run(runCtx)
+					} else if simulated.RunUntil(runCtx, simulated.Now().Add(stopAfter)) == nil {
+						cancel()
+					}
+				}()
+			case restart && crashAfter == 0:
+				time.AfterFunc(stopAfter, cancel)
+				close(clocked)
+			default:
+				close(clocked)
+			}
+
+			err := runNode(runCtx, storeDir, genesis, nodeClock, output, crashAfter, config)
+			cancel()
+			<-clocked
+			if err != nil && !(crashAfter > 0 && errors.Is(err, core.ErrAborted)) {
+				return fmt.Errorf("run %d: %w", run+1, err)
+			}
+		}
+
+		return nil
+	}()
+
+	report := <-validated
+	if nodeErr != nil {
+		return report, fmt.Errorf("node: %w", nodeErr)
+	}
+
+	return report, nil
+}
+
+// itemsPerHeight returns about how many blocks, flash blocks and signals are traced per height.
+func (config Config) itemsPerHeight() int {
+	items := 1
+	if config.WithFlashBlocks {
+		items += config.FlashBlocks.Partials + 1
+	}
+	if config.WithCommitmentSignal {
+		items += len(config.CommitmentLevels)
+	}
+
+	return items
+}
+
+// runNode runs a node on storeDir paced by nodeClock, tracing to output, until ctx is done or
+// the stop height is reached. The node is aborted once crashAfter items were traced, never
+// when it's zero.
+func runNode(ctx context.Context, storeDir string, genesis *types.Genesis, nodeClock clock.Clock, output io.Writer, crashAfter int, config Config) error {
+	var nodeTracer tracer.Tracer = tracer.NewFirehoseTracer(output, config.PayloadCompression)
+
+	var crashing *crashingTracer
+	if crashAfter > 0 {
+		crashing = &crashingTracer{Tracer: nodeTracer, remaining: crashAfter}
+		nodeTracer = crashing
+	}
+
+	node := core.NewNode(core.NodeConfig{
+		EngineConfig: core.EngineConfig{
+			BlockRate:         config.BlockRate,
+			BlockSizeInBytes:  config.BlockSizeInBytes,
+			BlockWorkers:      runtime.NumCPU(),
+			BlockLookahead:    1,
+			Upgrades:          config.Upgrades,
+			Timestamps:        config.Timestamps,
+			StopHeight:        config.StopHeight,
+			WithSkippedBlocks: config.WithSkippedBlocks,
+			WithReorgs:        config.WithReorgs,
+			WithFlashBlocks:   config.WithFlashBlocks,
+			FlashBlocks:       config.FlashBlocks,
+			CommitmentLevels:  config.CommitmentLevels,
+		},
+		Genesis:              genesis,
+		StoreDir:             storeDir,
+		Tracer:               nodeTracer,
+		WithCommitmentSignal: config.WithCommitmentSignal,
+	})
+	node.SetClock(nodeClock)
+	if crashing != nil {
+		crashing.crash = node.Abort
+	}
+
+	if err := node.Initialize(); err != nil {
+		return fmt.Errorf("initialize node: %w", err)
+	}
+
+	return node.Start(ctx)
+}
+
+// crashingTracer calls crash once remaining blocks, flash blocks and signals were traced.
+type crashingTracer struct {
+	tracer.Tracer
+	remaining int
+	crash     func()
+}
+
+func (t *crashingTracer) traced() {
+	if t.remaining--; t.remaining == 0 {
+		t.crash()
+	}
+}
+
+func (t *crashingTracer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) error {
+	if err := t.Tracer.OnBlockEnd(blk, finalBlockHeader); err != nil {
+		return err
+	}
+
+	t.traced()
+	return nil
+}
+
+func (t *crashingTracer) OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, idx int32) error {
+	if err := t.Tracer.OnFlashBlockEnd(blk, finalBlockHeader, idx); err != nil {
+		return err
+	}
+
+	t.traced()
+	return nil
+}
+
+func (t *crashingTracer) OnCommitmentSignal(sig *types.Signal) error {
+	if err := t.Tracer.OnCommitmentSignal(sig); err != nil {
+		return err
+	}
+
+	t.traced()
+	return nil
+}
+
+// DecodeAcmeBlock is a firehose.PayloadDecoder for the dummy chain `sf.acme.type.v1.Block` model.
+func DecodeAcmeBlock(payload []byte) (*firehose.PayloadHeader, error) {
+	block := &pbacme.Block{}
+	if err := proto.Unmarshal(payload, block); err != nil {
+		return nil, err
+	}
+
+	if block.Header == nil {
+		return nil, fmt.Errorf("block has no header")
+	}
+
+	transactions := make([]string, len(block.Transactions))
+	for i, trx := range block.Transactions {
+		transactions[i] = trx.Hash
+	}
+
+	return &firehose.PayloadHeader{
+		Number:      block.Header.Height,
+		Hash:        block.Header.Hash,
+		PrevNumber:  block.Header.GetPreviousNum(),
+		PrevHash:    block.Header.GetPreviousHash(),
+		FinalNumber: block.Header.FinalNum,
+
+		TimestampNanos: block.Header.Timestamp,
+
+		Transactions:       transactions,
+		TransactionsOffset: block.Header.TransactionsOffset,
+	}, nil
+}
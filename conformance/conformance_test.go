@@ -0,0 +1,48 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRun_DefaultConfig(t *testing.T) {
+	report, err := Run(context.Background(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("run: %s", err)
+	}
+
+	for _, violation := range report.Violations {
+		t.Errorf("%s", violation)
+	}
+
+	if report.Blocks == 0 || report.FlashBlocks == 0 || report.Signals == 0 || report.Forks == 0 {
+		t.Errorf("stream doesn't exercise every feature: %s", report)
+	}
+}
+
+func TestRun_CrashRestarts(t *testing.T) {
+	for seed := uint64(1); seed <= 5; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			config := DefaultConfig()
+			config.StopHeight = 150
+			config.Restarts = 8
+			config.RestartSeed = seed
+			config.Crash = true
+			config.SimulatedClock = true
+
+			report, err := Run(context.Background(), config)
+			if err != nil {
+				t.Fatalf("run: %s", err)
+			}
+
+			for _, violation := range report.Violations {
+				t.Errorf("%s", violation)
+			}
+
+			if report.HighestNum != config.StopHeight {
+				t.Errorf("stream ends at #%d, expected #%d", report.HighestNum, config.StopHeight)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// bridge links the engine to another chain running in the same process, each time the
+// remote final block changes a bridge transaction referencing it is added to the next block.
+type bridge struct {
+	chain  string
+	remote *Engine
+
+	// lastHash is the hash of the remote final block referenced last
+	lastHash string
+}
+
+// BridgeTo makes the engine add a bridge transaction referencing the final block of remote
+// (named chain) each time it changes. Bridge transactions depend on the timing of both
+// chains, blocks containing them are not reproducible.
+func (e *Engine) BridgeTo(chain string, remote *Engine) {
+	e.bridges = append(e.bridges, &bridge{chain: chain, remote: remote})
+}
+
+// FinalHeader returns the header of the current final block, it's safe to call from any
+// goroutine, nil is returned until the engine is initialized.
+func (e *Engine) FinalHeader() *types.BlockHeader {
+	return e.finalHeader.Load()
+}
+
+// setFinalBlock makes block the final block of the chain.
+func (e *Engine) setFinalBlock(block *types.Block) {
+	e.finalBlock = block
+	e.finalHeader.Store(block.Header)
+}
+
+// bridgeTransactions returns the bridge transactions of the block at height, one per bridged
+// chain whose final block changed since the previous one.
+func (e *Engine) bridgeTransactions(height uint64) (out []types.Transaction) {
+	for _, bridge := range e.bridges {
+		final := bridge.remote.FinalHeader()
+		if final == nil || final.Hash == bridge.lastHash {
+			continue
+		}
+		bridge.lastHash = final.Hash
+
+		finalNum := strconv.FormatUint(final.Height, 10)
+		out = append(out, types.Transaction{
+			Type:     "bridge",
+			Hash:     types.MakeHash(fmt.Sprintf("bridge:%d:%s:%s", height, bridge.chain, final.Hash)),
+			Sender:   "bridge:" + bridge.chain,
+			Receiver: "bridge",
+			Amount:   bigZero,
+			Fee:      bigZero,
+			Success:  true,
+			Events: []types.Event{
+				{
+					Type: "bridge_block",
+					Attributes: []types.Attribute{
+						{Key: "chain", Value: bridge.chain},
+						{Key: "block_num", Value: finalNum},
+						{Key: "block_hash", Value: final.Hash},
+					},
+				},
+			},
+		})
+	}
+
+	return out
+}
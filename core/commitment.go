@@ -0,0 +1,237 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// commitmentLevelFinal is the delay of the levels reached when blocks become final.
+const commitmentLevelFinal = "final"
+
+// CommitmentLevel is a level of the commitment pipeline, each block is signalled once for each
+// level it reaches, in order. The commitment level of the signals is the position of the level
+// in the pipeline plus one.
+type CommitmentLevel struct {
+	Name string
+
+	// Delay is the amount of blocks built on top of a block, once it reached the previous
+	// level, for it to reach this one, zero reaching it with the previous level (or when the
+	// block is produced for the first level).
+	Delay uint64
+
+	// Final levels are reached when blocks become final, whatever their depth, it must be the
+	// last level.
+	Final bool
+}
+
+// CommitmentLevels is the commitment pipeline. A block reorged out once it reached a level
+// having a delay is signalled at types.CommitmentDropped.
+type CommitmentLevels []CommitmentLevel
+
+// DefaultCommitmentLevels returns processed blocks, confirmed once a block is built on top of
+// them and finalized when they become final.
+func DefaultCommitmentLevels() CommitmentLevels {
+	return CommitmentLevels{
+		{Name: "processed"},
+		{Name: "confirmed", Delay: 1},
+		{Name: "finalized", Final: true},
+	}
+}
+
+// ParseCommitmentLevels parses a comma-separated list of `<name>:<delay>`, the delay being an
+// amount of blocks or `final` for the last level (e.g. `processed:0,confirmed:2,finalized:final`).
+func ParseCommitmentLevels(in string) (CommitmentLevels, error) {
+	var levels CommitmentLevels
+	for _, entry := range strings.Split(in, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			return nil, fmt.Errorf("commitment level %q requires a delay, either an amount of blocks or %q", entry, commitmentLevelFinal)
+		}
+
+		level := CommitmentLevel{Name: name, Final: value == commitmentLevelFinal}
+		if !level.Final {
+			delay, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("commitment level %q: expected an amount of blocks or %q, got %q", name, commitmentLevelFinal, value)
+			}
+			level.Delay = delay
+		}
+
+		levels = append(levels, level)
+	}
+
+	return levels, levels.Validate()
+}
+
+func (l CommitmentLevels) Validate() error {
+	if len(l) == 0 {
+		return fmt.Errorf("commitment pipeline requires at least one level")
+	}
+
+	for i, level := range l {
+		if level.Name == "" {
+			return fmt.Errorf("commitment level %d has no name", i+1)
+		}
+
+		if slices.ContainsFunc(l[:i], func(previous CommitmentLevel) bool { return previous.Name == level.Name }) {
+			return fmt.Errorf("commitment level %q is listed twice", level.Name)
+		}
+
+		if level.Final && i != len(l)-1 {
+			return fmt.Errorf("commitment level %q is reached when blocks become final, it must be the last level", level.Name)
+		}
+	}
+
+	return nil
+}
+
+// String returns the levels in the format of ParseCommitmentLevels.
+func (l CommitmentLevels) String() string {
+	entries := make([]string, len(l))
+	for i, level := range l {
+		if level.Final {
+			entries[i] = level.Name + ":" + commitmentLevelFinal
+		} else {
+			entries[i] = level.Name + ":" + strconv.FormatUint(level.Delay, 10)
+		}
+	}
+
+	return strings.Join(entries, ",")
+}
+
+// committedBlock is a block followed by the commitment pipeline.
+type committedBlock struct {
+	header *types.BlockHeader
+
+	// reached is the amount of levels the block reached
+	reached int
+}
+
+// commitmentPipeline tracks the levels reached by the produced blocks, a block is forgotten
+// once it reached the last level or got reorged out.
+type commitmentPipeline struct {
+	levels CommitmentLevels
+
+	// depths are the amount of blocks on top of a block for it to reach each level, the final
+	// level excluded
+	depths []uint64
+
+	// blocks are the followed blocks in production order
+	blocks []*committedBlock
+}
+
+func newCommitmentPipeline(levels CommitmentLevels) *commitmentPipeline {
+	pipeline := &commitmentPipeline{levels: levels}
+
+	depth := uint64(0)
+	for _, level := range levels {
+		if !level.Final {
+			depth += level.Delay
+			pipeline.depths = append(pipeline.depths, depth)
+		}
+	}
+
+	return pipeline
+}
+
+// add follows block, the new head of the chain, and returns the signals it triggers: the
+// blocks it reorged out, then the levels reached by its ancestors and itself, final being the
+// final block of the chain.
+func (p *commitmentPipeline) add(block *types.Block, final *types.Block) (signals []*types.Signal) {
+	header := block.Header
+
+	// A block at the height of the new head or above is not one of its ancestors
+	p.blocks = slices.DeleteFunc(p.blocks, func(committed *committedBlock) bool {
+		if committed.header.Height < header.Height {
+			return false
+		}
+
+		if committed.reached > 0 && p.levelDelayed(committed.reached-1) {
+			signals = append(signals, newSignal(committed.header, types.CommitmentDropped))
+		}
+		return true
+	})
+
+	added := &committedBlock{header: header}
+	p.blocks = append(p.blocks, added)
+
+	ancestors := p.ancestors(added)
+	for i, ancestor := range slices.Backward(ancestors) {
+		signals = append(signals, p.reach(ancestor, p.levelsAtDepth(uint64(i)))...)
+	}
+
+	if p.levels[len(p.levels)-1].Final {
+		if finalized := p.find(final.Header.Hash); finalized != nil {
+			for _, ancestor := range slices.Backward(p.ancestors(finalized)) {
+				signals = append(signals, p.reach(ancestor, len(p.levels))...)
+			}
+		}
+	}
+
+	p.blocks = slices.DeleteFunc(p.blocks, func(committed *committedBlock) bool {
+		return committed.reached == len(p.levels)
+	})
+
+	return signals
+}
+
+// levelDelayed returns whether the level at index is reached after blocks are built on top of
+// a block, a final level always is.
+func (p *commitmentPipeline) levelDelayed(index int) bool {
+	return index >= len(p.depths) || p.depths[index] > 0
+}
+
+// levelsAtDepth returns the amount of levels reached by a block having depth blocks on top of
+// it, the final level excluded.
+func (p *commitmentPipeline) levelsAtDepth(depth uint64) int {
+	count := 0
+	for count < len(p.depths) && p.depths[count] <= depth {
+		count++
+	}
+
+	return count
+}
+
+// reach returns the signals of the levels block reaches up to count.
+func (p *commitmentPipeline) reach(block *committedBlock, count int) (signals []*types.Signal) {
+	for ; block.reached < count; block.reached++ {
+		signals = append(signals, newSignal(block.header, int32(block.reached+1)))
+	}
+
+	return signals
+}
+
+// ancestors returns block followed by its ancestors that are still followed.
+func (p *commitmentPipeline) ancestors(block *committedBlock) (out []*committedBlock) {
+	for block != nil {
+		out = append(out, block)
+		if block.header.PrevHash == nil {
+			break
+		}
+		block = p.find(*block.header.PrevHash)
+	}
+
+	return out
+}
+
+func (p *commitmentPipeline) find(hash string) *committedBlock {
+	for _, committed := range p.blocks {
+		if committed.header.Hash == hash {
+			return committed
+		}
+	}
+
+	return nil
+}
+
+func newSignal(header *types.BlockHeader, level int32) *types.Signal {
+	return &types.Signal{
+		BlockID:         header.Hash,
+		BlockNumber:     header.Height,
+		CommitmentLevel: level,
+	}
+}
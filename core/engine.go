@@ -2,76 +2,250 @@ package core
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/binary"
 	"fmt"
-	"math"
-	"math/big"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/clock"
 	"github.com/streamingfast/dummy-blockchain/types"
 )
 
+// DefaultProposer is the address of the node proposing the produced blocks.
+var DefaultProposer = "0x" + types.MakeHash("proposer")[:40]
+
+const (
+	// gasLimitPerByte sets the block gas limit from the block size, a transaction always uses
+	// less gas than this per byte of block space.
+	gasLimitPerByte = 128
+	minGasLimit     = 30_000_000
+
+	// maxFillRounds bounds how many times transactions are generated for a block, see
+	// fillTransactions.
+	maxFillRounds = 3
+)
+
 type Engine struct {
-	genesisHash       string
-	genesisHeight     uint64
-	genesisTime       time.Time
+	genesis           *types.Genesis
+	upgrades          []types.Upgrade
+	timestamps        *Timestamps
+	baseRules         types.Rules
+	schedule          *types.Schedule
 	genesisBlockBurst uint64
 	stopHeight        uint64
 	blockSizeInBytes  int
-	blockRate         time.Duration
+	blockLookahead    int
+	generator         *txGenerator
 	blockChan         chan *types.Block
 	flashBlockChan    chan *types.FlashBlock
 	signalChan        chan *types.Signal
-	prevBlock         *types.Block
-	finalBlock        *types.Block
-	tearedDown        bool
-	teardownOnce      sync.Once
+
+	// stateChan receives the production state once what it describes was sent, the node
+	// persists it once it processed it
+	stateChan chan *engineState
+
+	prevBlock    *types.Block
+	finalBlock   *types.Block
+	tearedDown   bool
+	teardownOnce sync.Once
+
+	// aborted is closed when the node stops receiving the produced blocks, see Abort
+	aborted   chan struct{}
+	abortOnce sync.Once
+
 	withSkippedBlocks bool
 	withReorgs        bool
+	flashBlocks       FlashBlockConfig
+	commitmentLevels  CommitmentLevels
+
+	// forcedReorg is the depth of the fork sequence requested by ForceReorg, not built yet
+	forcedReorg atomic.Uint64
+
+	clock  clock.Clock
+	logger logrus.FieldLogger
+
+	// pendingBlocks are the upcoming blocks, built ahead of time for prefix flash blocks
+	pendingBlocks []*types.Block
+
+	// stateStore persists the production state once resumed from it, see resume
+	stateStore   *Store
+	resumed      *engineState
+	resumedFlash flashProgress
+
+	// finalHeader mirrors finalBlock for bridged engines reading it concurrently
+	finalHeader atomic.Pointer[types.BlockHeader]
+	bridges     []*bridge
+
+	// proposer is the address set as the proposer of the produced blocks, derived from
+	// producerKey when it's set, the blocks being then signed by it
+	proposer    string
+	producerKey ed25519.PrivateKey
 }
 
-func NewEngine(genesisHash string, genesisHeight uint64, genesisTime time.Time, genesisBlockBurst uint64, stopHeight uint64, rate int, blockSizeInBytes int, withSkippedBlocks bool, withReorgs bool) Engine {
-	blockRate := time.Minute / time.Duration(rate)
+// EngineConfig configures the blocks produced by an engine.
+type EngineConfig struct {
+	// BlockRate is the amount of blocks produced per minute, until upgrades change it.
+	BlockRate int
+
+	// BlockSizeInBytes is the size of the produced blocks, as encoded in Protobuf.
+	BlockSizeInBytes int
+
+	// BlockWorkers is the amount of goroutines generating the transactions of a block, at
+	// least one.
+	BlockWorkers int
+
+	// BlockLookahead is the amount of upcoming blocks whose transactions are generated ahead
+	// of the block ticker.
+	BlockLookahead int
+
+	// Upgrades are the protocol upgrades applied after the ones of the genesis.
+	Upgrades []types.Upgrade
+
+	// Timestamps computes the block timestamps, slot mode when nil.
+	Timestamps *Timestamps
 
+	// GenesisBlockBurst is the amount of blocks produced as fast as possible after the
+	// genesis, before pacing the production with the block rate.
+	GenesisBlockBurst uint64
+
+	// StopHeight is the height past which no block is produced, zero never stops.
+	StopHeight uint64
+
+	// WithSkippedBlocks skips the heights multiple of 13.
+	WithSkippedBlocks bool
+
+	// WithReorgs produces a fork sequence at the heights multiple of 17.
+	WithReorgs bool
+
+	// WithFlashBlocks produces the flash blocks configured by FlashBlocks ahead of each block.
+	WithFlashBlocks bool
+	FlashBlocks     FlashBlockConfig
+
+	// CommitmentLevels is the pipeline the signals go through, when they are enabled.
+	CommitmentLevels CommitmentLevels
+}
+
+// NewEngine creates an engine producing the blocks configured by config. SetGenesis must be
+// called before initializing it.
+func NewEngine(config EngineConfig) Engine {
 	return Engine{
-		genesisHash:       genesisHash,
-		genesisHeight:     genesisHeight,
-		genesisTime:       genesisTime,
-		genesisBlockBurst: genesisBlockBurst,
-		stopHeight:        stopHeight,
-		blockRate:         blockRate,
-		blockSizeInBytes:  blockSizeInBytes,
+		upgrades:          config.Upgrades,
+		timestamps:        config.Timestamps,
+		baseRules:         types.Rules{FlashBlocks: config.WithFlashBlocks, FinalityInterval: types.DefaultFinalityInterval, BlockRate: config.BlockRate},
+		genesisBlockBurst: config.GenesisBlockBurst,
+		stopHeight:        config.StopHeight,
+		blockSizeInBytes:  config.BlockSizeInBytes,
+		blockLookahead:    config.BlockLookahead,
+		generator:         newTxGenerator(config.BlockWorkers),
 		blockChan:         make(chan *types.Block),
 		signalChan:        make(chan *types.Signal),
 		flashBlockChan:    make(chan *types.FlashBlock),
+		stateChan:         make(chan *engineState),
 		tearedDown:        false,
 		teardownOnce:      sync.Once{},
-		withSkippedBlocks: withSkippedBlocks,
-		withReorgs:        withReorgs,
+		aborted:           make(chan struct{}),
+		withSkippedBlocks: config.WithSkippedBlocks,
+		withReorgs:        config.WithReorgs,
+		flashBlocks:       config.FlashBlocks,
+		commitmentLevels:  config.CommitmentLevels,
+		clock:             clock.Real,
+		logger:            logrus.StandardLogger(),
+		proposer:          DefaultProposer,
 	}
 }
 
-func (e *Engine) Initialize(prevBlock *types.Block, finalBlock *types.Block) error {
-	e.prevBlock = prevBlock
-	e.finalBlock = finalBlock
+// SetClock sets the clock pacing the block production, the system clock by default.
+func (e *Engine) SetClock(clock clock.Clock) {
+	e.clock = clock
+}
+
+// SetLogger sets the logger of the engine, the logrus standard logger by default.
+func (e *Engine) SetLogger(logger logrus.FieldLogger) {
+	e.logger = logger
+}
+
+// ForceReorg makes the next height built start with a fork sequence of depth blocks, each one
+// on top of the previous, that the canonical block of the height then replaces. The upcoming
+// height is already built once its flash blocks are produced, the following one gets it then.
+// It's safe to call while producing.
+func (e *Engine) ForceReorg(depth int) {
+	e.forcedReorg.Store(uint64(max(depth, 1)))
+}
+
+// SetProducerKey sets the key signing the produced blocks, the proposer being its address.
+func (e *Engine) SetProducerKey(key ed25519.PrivateKey) {
+	e.producerKey = key
+	e.proposer = types.ProducerAddress(key.Public().(ed25519.PublicKey))
+}
+
+// SetGenesis sets the genesis of the chain, its upgrades followed by the engine's own ones
+// make the upgrade schedule.
+func (e *Engine) SetGenesis(genesis *types.Genesis) error {
+	schedule, err := types.NewSchedule(genesis.Height, e.baseRules, append(slices.Clone(genesis.Upgrades), e.upgrades...))
+	if err != nil {
+		return fmt.Errorf("upgrade schedule: %w", err)
+	}
 
+	e.genesis = genesis
+	e.schedule = schedule
+	e.generator.schedule = schedule
+
+	return nil
+}
+
+// Schedule returns the upgrade schedule, available once SetGenesis was called.
+func (e *Engine) Schedule() *types.Schedule {
+	return e.schedule
+}
+
+func (e *Engine) Initialize(prevBlock *types.Block, finalBlock *types.Block) error {
 	if finalBlock == nil {
 		return fmt.Errorf("final block cannot be nil")
 	}
 
+	e.prevBlock = prevBlock
+	e.setFinalBlock(finalBlock)
+
 	return nil
 }
 
-func (e *Engine) stop(reason string, tickers ...*time.Ticker) {
+// Abort stops the block production when the node stops receiving the produced blocks
+// before the engine closed its channels, unblocking a send in progress.
+func (e *Engine) Abort() {
+	e.abortOnce.Do(func() {
+		close(e.aborted)
+	})
+}
+
+// send sends value on channel unless the production was aborted, it returns whether it
+// was sent. The clock is held until the receiver is done with value.
+func send[T any](e *Engine, channel chan<- T, value T) bool {
+	e.clock.Hold()
+
+	select {
+	case channel <- value:
+		return true
+	case <-e.aborted:
+		e.clock.Release()
+		return false
+	}
+}
+
+func (e *Engine) stop(reason string, tickers ...clock.Ticker) {
 	e.teardownOnce.Do(func() {
-		logrus.Info(reason)
+		e.logger.Info(reason)
 
 		e.tearedDown = true
 
 		close(e.blockChan)
 		close(e.signalChan)
 		close(e.flashBlockChan)
+		close(e.stateChan)
 
 		for _, ticker := range tickers {
 			ticker.Stop()
@@ -79,108 +253,170 @@ func (e *Engine) stop(reason string, tickers ...*time.Ticker) {
 	})
 }
 
-func (e *Engine) StartBlockProduction(ctx context.Context, withCommitmentSignal, withFlashBlocks bool) {
-	logrus.
+// StartBlockProduction produces blocks until ctx is done or the stop height is reached, then
+// closes the channels. The blocks of a height, forks included, and their signals are all
+// sent once the first one is, ctx is only checked between heights so that the node can
+// drain them and stop on a canonical head.
+func (e *Engine) StartBlockProduction(ctx context.Context, withCommitmentSignal bool) {
+	withFlashBlocks := e.schedule.HasFlashBlocks()
+
+	headHeight := e.genesis.Height
+	if e.prevBlock != nil {
+		headHeight = e.prevBlock.Header.Height
+	}
+	blockRate := e.schedule.Rules(e.nextHeight(headHeight, false)).BlockInterval()
+
+	e.logger.
 		WithField("genesis_burst", e.genesisBlockBurst).
-		WithField("rate", e.blockRate).
+		WithField("rate", blockRate).
 		WithField("size", e.blockSizeInBytes).
+		WithField("workers", e.generator.workers).
+		WithField("lookahead", e.blockLookahead).
 		WithField("stop_height", e.stopHeight).
+		WithField("flash_block_partials", e.flashBlocks.Partials).
+		WithField("flash_block_content", e.flashBlocks.Content).
 		Info("starting block producer")
 
 	if e.prevBlock == nil {
-		genesisBlock := types.GenesisBlock(e.genesisHash, e.genesisHeight, e.genesisTime)
-		logrus.WithField("block", blockRef{genesisBlock.Header.Hash, e.genesisHeight}).WithField("burst", e.genesisBlockBurst).Info("starting from genesis block height")
+		genesisBlock := types.GenesisBlock(e.genesis)
+		e.logger.WithField("block", blockRef{genesisBlock.Header.Hash, genesisBlock.Header.Height}).WithField("burst", e.genesisBlockBurst).Info("starting from genesis block height")
 		e.prevBlock = genesisBlock
-		e.finalBlock = genesisBlock
+		e.setFinalBlock(genesisBlock)
 
-		e.blockChan <- genesisBlock
+		if !send(e, e.blockChan, genesisBlock) {
+			e.stop("block production aborted")
+			return
+		}
 
 		startBurst := time.Now()
 		for i := 0; i < int(e.genesisBlockBurst); {
+			if ctx.Err() != nil {
+				e.stop("context done during genesis burst")
+				return
+			}
+
+			// Checked before creating the blocks, which makes them the head
+			if e.hasReachedStopHeight(e.nextHeight(e.prevBlock.Header.Height, true)) {
+				e.stop("reached stop block height during genesis burst")
+				return
+			}
+
 			for _, block := range e.createBlocks(true) {
-				if e.hasReachedStopHeight(block.Header.Height) {
-					e.stop("reached stop block height during genesis burst")
+				if !send(e, e.blockChan, block) {
+					e.stop("block production aborted")
 					return
 				}
-
-				e.blockChan <- block
 				i++
 			}
 		}
-		logrus.WithField("duration", time.Since(startBurst).String()).Infof("genesis block burst of %d blocks produced", int(e.genesisBlockBurst))
+		e.logger.WithField("duration", time.Since(startBurst).String()).Infof("genesis block burst of %d blocks produced", int(e.genesisBlockBurst))
 	}
 
-	var lastBlock *types.Block
-	var lastSignal *types.Signal
-	var lastFlashBlockNum uint64
-	var lastFlashBlockIndex uint64
-
-	blockTicker := time.NewTicker(e.blockRate)
-	commitmentSignalTicker := time.NewTicker(e.blockRate)
-	flashBlockTicker := time.NewTicker(e.blockRate / 4) // we use 3 slots out of 4
+	// Flash blocks of the next height are produced right away, resuming the ones sent before
+	// a restart
+	lastBlock := e.prevBlock
+	flash := e.resumedFlash
 
+	// Blocks of the genesis burst are not signalled
+	var commitments *commitmentPipeline
 	if withCommitmentSignal {
-		<-time.After(e.blockRate / 2) // offset by half duration
-		commitmentSignalTicker.Reset(e.blockRate)
-	} else {
-		commitmentSignalTicker.Stop()
+		commitments = e.resumedCommitments(e.commitmentLevels)
 	}
 
+	blockRate = e.schedule.Rules(e.nextHeight(e.prevBlock.Header.Height, false)).BlockInterval()
+	blockTicker := e.clock.NewTicker(blockRate)
+	flashBlockTicker := e.clock.NewTicker(e.flashBlocks.interval(blockRate))
+
 	if !withFlashBlocks {
 		flashBlockTicker.Stop()
 	}
 
+	// A tick is released once handled, when the loop comes back waiting for the next one or
+	// the production stops
+	ticked := false
+	defer func() {
+		if ticked {
+			e.clock.Release()
+		}
+	}()
+
 	for {
+		if ticked {
+			e.clock.Release()
+			ticked = false
+		}
+
 		if e.tearedDown {
-			logrus.Info("block producer has been stopped")
+			e.logger.Info("block producer has been stopped")
 			return
 		}
 
 		select {
-		case <-blockTicker.C:
-			prevBlock := e.prevBlock // keep this handy for flashblock
-			for i, block := range e.createBlocks(false) {
-				if e.hasReachedStopHeight(block.Header.Height) {
-					e.stop("reached stop block height", blockTicker, commitmentSignalTicker, flashBlockTicker)
-					return
-				}
+		case <-blockTicker.C():
+			ticked = true
+
+			// Checked before creating the blocks, which makes them the head: the head and
+			// the persisted state must not move to a height that is never sent
+			if e.hasReachedStopHeight(e.nextHeight(e.prevBlock.Header.Height, false)) {
+				e.stop("reached stop block height", blockTicker, flashBlockTicker)
+				return
+			}
+
+			createStart := time.Now()
+			blocks := e.createBlocks(false)
+			if elapsed := time.Since(createStart); elapsed > blockRate {
+				e.logger.WithField("duration", elapsed).WithField("rate", blockRate).Warn("block creation took longer than the block rate, consider increasing --block-workers or --block-lookahead")
+			}
+
+			for i, block := range blocks {
+				if e.schedule.Rules(block.Header.Height).FlashBlocks && i == 0 && !e.flashBlocksInvalidated(block.Header.Height) && !e.finalFlashBlockSent(&flash, block.Header.Height) {
+					// The final flash block is sent for the first block of the height, at multiples
+					// of 17 it's the fork one, it gets replaced later with undo if we have withReorgs.
+					if !send(e, e.flashBlockChan, e.finalFlashBlock(block, &flash)) {
+						e.stop("block production aborted", blockTicker, flashBlockTicker)
+						return
+					}
 
-				if withFlashBlocks && i == 0 && (block.Header.Height%11 != 0 || !e.withReorgs) { // on normal blocks, we send the 'finalFlashBlock' with index 4. 1004 means "final + 4"
-					// if we have reorgs, at every multiple of 11, we will not send the final flash block.
-					// at every multiple of 17, we will send the 'final flash block, normally. it will get replaced later with undo if we have withReorgs
-					fb := &types.FlashBlock{
-						Block: e.newBlock(block.Header.Height, nil, prevBlock),
-						Index: 1004, // "final" flash block
+					if flash.height != block.Header.Height {
+						flash = flashProgress{height: block.Header.Height}
 					}
-					fb.Block.Header.FinalHash = prevBlock.Header.FinalHash // this may have changed on 'e.newBlock'
-					fb.Block.Header.FinalNum = prevBlock.Header.FinalNum   // this may have changed on 'e.newBlock'
-					fb.Block.Header.Hash = block.Header.Hash               // if we're on an block that will get reorg'd, we still send the partialblock of THAT HASH
-					e.addTransactions(fb.Block, e.blockSizeInBytes)
-					e.flashBlockChan <- fb
+					flash.index = e.flashBlocks.finalIndex()
 				}
 
-				e.blockChan <- block
+				if !send(e, e.blockChan, block) {
+					e.stop("block production aborted", blockTicker, flashBlockTicker)
+					return
+				}
 				lastBlock = block
+
+				if commitments != nil {
+					for _, signal := range commitments.add(block, e.finalBlock) {
+						if !send(e, e.signalChan, signal) {
+							e.stop("block production aborted", blockTicker, flashBlockTicker)
+							return
+						}
+					}
+				}
 			}
-		case <-commitmentSignalTicker.C:
-			if !withCommitmentSignal {
-				// Just ignore if a signal ticker comes in, but it actually should not be called because of the Stop(), unless there is a crazy race condition
-				continue
+			if !e.sendState(&flash, commitments) {
+				e.stop("block production aborted", blockTicker, flashBlockTicker)
+				return
 			}
-			if lastBlock != nil {
-				if lastSignal != nil && lastSignal.BlockID == lastBlock.Header.Hash {
-					continue // don't send duplicate signal
-				}
-				sig := &types.Signal{
-					BlockID:         lastBlock.Header.Hash,
-					BlockNumber:     lastBlock.Header.Height,
-					CommitmentLevel: 10,
-				}
-				e.signalChan <- sig
-				lastSignal = sig
+
+			// An upgrade may change the block rate starting with the next block
+			if rate := e.schedule.Rules(e.nextHeight(e.prevBlock.Header.Height, false)).BlockInterval(); rate != blockRate {
+				e.logger.WithField("previous_rate", blockRate).WithField("rate", rate).Info("block rate changed by upgrade")
+				blockRate = rate
+
+				blockTicker.Reset(blockRate)
 			}
 
-		case <-flashBlockTicker.C:
+			// Flash blocks of the next height are timed from this block
+			if withFlashBlocks {
+				flashBlockTicker.Reset(e.flashBlocks.interval(blockRate))
+			}
+		case <-flashBlockTicker.C():
+			ticked = true
 			if !withFlashBlocks {
 				// Just ignore if a flashblock ticker comes in, but it actually should not be called because of the Stop(), unless there is a crazy race condition
 				continue
@@ -189,31 +425,27 @@ func (e *Engine) StartBlockProduction(ctx context.Context, withCommitmentSignal,
 				continue
 			}
 
-			num := lastBlock.Header.Height + 1
-			if num != lastFlashBlockNum {
-				lastFlashBlockIndex = 0
-				lastFlashBlockNum = num
+			// No flash block is produced for a skipped slot
+			num := e.nextHeight(lastBlock.Header.Height, false)
+			if !e.schedule.Rules(num).FlashBlocks {
 				continue
 			}
 
-			if lastFlashBlockIndex >= 3 { // we don't send 4 or above, it's now sent as final block
-				continue
+			if num != flash.height {
+				flash = flashProgress{height: num}
 			}
 
-			idx := lastFlashBlockIndex + 1
-			nonce := idx + 10000 // so we don't overlap with forks' hashes
-			flashBlock := e.newBlock(num, &nonce, e.prevBlock)
-			e.addTransactions(flashBlock, int(idx*uint64(e.blockSizeInBytes)/4))
-			e.flashBlockChan <- &types.FlashBlock{
-				Block: flashBlock,
-				Index: int32(idx),
+			if int(flash.index) >= e.flashBlocks.Partials { // the next one is the final flash block
+				continue
 			}
 
-			lastFlashBlockIndex = idx
-			lastFlashBlockNum = num
+			if !send(e, e.flashBlockChan, e.nextFlashBlock(&flash)) || !e.sendState(&flash, commitments) {
+				e.stop("block production aborted", blockTicker, flashBlockTicker)
+				return
+			}
 
 		case <-ctx.Done():
-			e.stop("context done", blockTicker, commitmentSignalTicker, flashBlockTicker)
+			e.stop("context done", blockTicker, flashBlockTicker)
 			return
 		}
 	}
@@ -239,195 +471,233 @@ func (e *Engine) SubscribeFlashBlocks() <-chan *types.FlashBlock {
 	return e.flashBlockChan
 }
 
-func (e *Engine) createBlocks(inGenesis bool) (out []*types.Block) {
-	heightToProduce := e.prevBlock.Header.Height + 1
-	if !inGenesis && e.withSkippedBlocks && heightToProduce%13 == 0 {
-		heightToProduce += 1
-		logrus.Info(fmt.Sprintf("skipping block #%d that is a multiple of 13, created %d instead", heightToProduce-1, heightToProduce))
+func (e *Engine) subscribeState() <-chan *engineState {
+	return e.stateChan
+}
+
+// nextHeight returns the height of the canonical block following height.
+func (e *Engine) nextHeight(height uint64, inGenesis bool) uint64 {
+	next := height + 1
+	if !inGenesis && e.withSkippedBlocks && next%13 == 0 {
+		next += 1
 	}
 
-	if !inGenesis && e.withReorgs && heightToProduce%17 == 0 {
-		if heightToProduce%2 == 0 {
-			logrus.Info("created 2 block fork sequence")
-			firstFork := e.newBlock(heightToProduce, ptr(uint64(1)), e.prevBlock)
-			secondFork := e.newBlock(heightToProduce+1, ptr(uint64(2)), firstFork)
+	return next
+}
 
-			out = append(out, firstFork, secondFork)
-		} else {
-			logrus.Info("created 1 block fork sequence")
-			out = append(out, e.newBlock(heightToProduce, ptr(uint64(1)), e.prevBlock))
-		}
+// createBlocks produces the blocks of the next height, the forks followed by the canonical
+// block which becomes the head.
+func (e *Engine) createBlocks(inGenesis bool) []*types.Block {
+	out := e.pendingBlocks
+	e.pendingBlocks = nil
+
+	heightToProduce := e.nextHeight(e.prevBlock.Header.Height, inGenesis)
+	if len(out) == 0 || out[len(out)-1].Header.Height != heightToProduce {
+		out = e.buildBlocks(inGenesis)
+	}
+
+	block := out[len(out)-1]
+	e.prefetchTransactions(block.Header.Height, inGenesis)
+	e.advance(block, true)
+
+	return out
+}
+
+// buildBlocks builds the blocks of the next height without making them the head.
+func (e *Engine) buildBlocks(inGenesis bool) (out []*types.Block) {
+	heightToProduce := e.nextHeight(e.prevBlock.Header.Height, inGenesis)
+	if heightToProduce != e.prevBlock.Header.Height+1 {
+		e.logger.Info(fmt.Sprintf("skipping block #%d that is a multiple of 13, created %d instead", heightToProduce-1, heightToProduce))
+	}
+
+	out = e.forkBlocks(heightToProduce, inGenesis)
+	if len(out) > 0 {
+		e.logger.Info(fmt.Sprintf("created %d block fork sequence", len(out)))
+	}
+
+	if upgrade := e.schedule.Rules(heightToProduce); upgrade != e.schedule.Rules(e.prevBlock.Header.Height) {
+		e.logger.
+			WithField("height", heightToProduce).
+			WithField("upgrade", upgrade.UpgradeName).
+			WithField("protocol_version", upgrade.ProtocolVersion).
+			Info("activating protocol upgrade")
 	}
 
 	block := e.newBlock(heightToProduce, nil, e.prevBlock)
-	e.addTransactions(block, e.blockSizeInBytes)
+	e.fillBlock(block, e.blockSizeInBytes, e.bridgeTransactions(heightToProduce))
 
-	out = append(out, block)
+	return append(out, block)
+}
 
-	e.prevBlock = block
-	if block.Header.Height%10 == 0 {
-		logrus.WithField("block", blockRef{block.Header.Hash, block.Header.Height}).Info("created block is now the final block")
-		e.finalBlock = block
+// forkBlocks builds the fork sequence replaced by the canonical block of height, none when
+// no fork is due at height.
+func (e *Engine) forkBlocks(height uint64, inGenesis bool) (out []*types.Block) {
+	depth := e.forkDepth(height, inGenesis)
+	if depth == 0 {
+		return nil
 	}
 
-	return
+	parent := e.prevBlock
+	for i := range depth {
+		fork := e.newBlock(height+i, ptr(i+1), parent)
+		fork.Seal(e.producerKey)
+
+		out = append(out, fork)
+		parent = fork
+	}
+
+	return out
 }
 
-var simulateTypes = []string{"transfer", "delegate", "undelegate", "reward", "slash"}
-var bigZero = big.NewInt(0)
+// forkDepth returns the amount of fork blocks built before the canonical block of height, a
+// 2 blocks fork sequence at even multiples of 17, a single fork block at odd ones, unless a
+// deeper one was forced.
+func (e *Engine) forkDepth(height uint64, inGenesis bool) uint64 {
+	if inGenesis {
+		return 0
+	}
+
+	depth := e.forcedReorg.Swap(0)
+	if e.withReorgs && height%17 == 0 {
+		depth = max(depth, 2-height%2)
+	}
 
-const (
-	KiB = 1024
-)
+	return depth
+}
 
-func (e *Engine) addTransactions(block *types.Block, sizeInBytes int) {
-	addTx := func(data []byte) {
-		i := len(block.Transactions)
-
-		txHash := types.MakeFakeHash(block.Header.Height, i)
-		sender := "0x" + txHash[:40]
-		receiver := "0x" + txHash[24:64]
-		amount := new(big.Int).SetUint64((block.Header.Height << 32) | uint64(i))
-		success := true
-
-		// Each five transactions, make a fixed sender
-		if i%7 == 0 {
-			sender = "0xDEADBEEF"
+// advance makes block the new head of the chain, and the final block if it's a multiple of 10.
+func (e *Engine) advance(block *types.Block, logFinal bool) {
+	e.prevBlock = block
+	if e.schedule.Rules(block.Header.Height).IsFinal(block.Header.Height) {
+		if logFinal {
+			e.logger.WithField("block", blockRef{block.Header.Hash, block.Header.Height}).Info("created block is now the final block")
 		}
+		e.setFinalBlock(block)
+	}
+}
 
-		// Each eleven transactions, make a fixed receiver
-		if i%11 == 0 {
-			receiver = "0xBAAAAAAD"
-		}
+// addTransactions appends transactions to block until its exact Protobuf size, once sealed,
+// reaches sizeInBytes, and seals it. At least one transaction is always added.
+func (e *Engine) addTransactions(block *types.Block, sizeInBytes int) {
+	e.fillBlock(block, sizeInBytes, nil)
+}
 
-		// Each 3 transactions, make amount zero
-		if i%3 == 0 {
-			amount = bigZero
-		}
+// fillBlock fills block up to sizeInBytes with generated transactions followed by bridges,
+// appended last so that the generated ones are the same with or without them, and seals it.
+func (e *Engine) fillBlock(block *types.Block, sizeInBytes int, bridges []types.Transaction) {
+	e.fillTransactions(block, sizeInBytes, bridges, func(first int, budget int) []types.Transaction {
+		return e.generator.transactions(block.Header.Height, first, budget)
+	})
+}
 
-		// Each 13 transactions, make it fail
-		if i%13 == 0 {
-			success = false
+// fillTransactions appends the transactions returned by generate for the budget left, first
+// being the index of the first one, followed by bridges so that block is exactly sizeInBytes
+// once sealed, then seals it.
+//
+// The gas used is part of the header and its varint length depends on the amount of
+// generated transactions, itself depending on the budget left by the header. It's estimated
+// from the target transaction count, transactions are generated again in the rare case the
+// estimate has a different length.
+func (e *Engine) fillTransactions(block *types.Block, sizeInBytes int, bridges []types.Transaction, generate func(first int, budget int) []types.Transaction) {
+	header := block.Header
+	existing := block.Transactions[:len(block.Transactions):len(block.Transactions)]
+	existingGas := types.GasUsed(existing) + types.GasUsed(bridges)
+
+	budgetFor := func(gasUsed uint64) int {
+		sizer := types.NewSealedBlockSizer(header, gasUsed, uint64(sizeInBytes))
+		for i := range existing {
+			sizer.Add(&existing[i])
+		}
+		for i := range bridges {
+			sizer.Add(&bridges[i])
 		}
 
-		block.Transactions = append(block.Transactions, types.Transaction{
-			Type:     simulateTypes[i%len(simulateTypes)],
-			Hash:     txHash,
-			Sender:   sender,
-			Receiver: receiver,
-			Data:     fillData(data, block.Header.Height, i),
-			Amount:   amount,
-			Fee:      new(big.Int).SetUint64(block.Header.Height + uint64(i)),
-			Success:  success,
-			Events:   e.generateEvents(block.Header.Height),
-		})
+		return max(sizeInBytes-sizer.Size(), 0)
 	}
 
-	// At those small size, the loop below is fast enough
-	if sizeInBytes < 10*KiB {
-		for size := block.ApproximatedSize(); size <= sizeInBytes; size = block.ApproximatedSize() {
-			addTx(make([]byte, 32))
+	gasUsed := existingGas + estimateGas(header.Height, budgetFor(existingGas))
+	for range maxFillRounds {
+		generated := generate(len(existing), budgetFor(gasUsed))
+
+		actualGas := existingGas + types.GasUsed(generated)
+		block.Transactions = append(append(existing, generated...), bridges...)
+
+		if header.SealedProtoSize(actualGas, 0) == header.SealedProtoSize(gasUsed, 0) {
+			break
 		}
+		gasUsed = actualGas
 	}
 
-	// At larger sizes, we estimate the number of transactions to add and generate data
-	txCount := targetTxCount(sizeInBytes)
-	dataSizePerTx := (sizeInBytes / txCount) - 250 // rough estimate of tx overhead
+	header.Size = uint64(sizeInBytes)
+	block.Seal(e.producerKey)
+}
 
-	// Ensure dataSizePerTx is non-negative to avoid makeslice panic
-	if dataSizePerTx < 0 {
-		dataSizePerTx = 0
-	}
+// prefetchTransactions starts generating the transactions of the blocks following height
+// while the current one is being processed.
+func (e *Engine) prefetchTransactions(height uint64, inGenesis bool) {
+	e.generator.discardBelow(height + 1)
 
-	for range txCount {
-		addTx(make([]byte, dataSizePerTx))
+	next := height
+	for range e.blockLookahead {
+		next = e.nextHeight(next, inGenesis)
+		e.generator.prefetch(next, e.blockSizeInBytes)
 	}
 }
 
-// targetTxCount provides an estimated target transaction count, and it gives roughly
-// in that range:
-//
-//   - 100 transactions at 100KiB
-//   - 1000 transactions at 1MiB
-//   - 2500 transactions at 2.5MiB
-//   - 5000 transactions at 5MiB
-//   - 10000 transactions at 10MiB
-//   - 100000 transactions at 100MiB
-//   - etc.
-//
-// With a minimum of 10 transactions.
-func targetTxCount(blockSizeInBytes int) int {
-	scale := math.Log10(float64(blockSizeInBytes))
-	exponent := scale - 3
-	if exponent < 1 {
-		exponent = 1
+// NewSampleBlock creates a standalone block at height filled with transactions up to
+// sizeInBytes, it's used to benchmark block consumers.
+func NewSampleBlock(height uint64, sizeInBytes int) *types.Block {
+	genesis := types.GenesisBlock(&types.Genesis{Hash: types.MakeHash(0), Time: time.Now()})
+	engine := &Engine{baseRules: types.Rules{BlockRate: 60}, finalBlock: genesis, generator: newTxGenerator(runtime.NumCPU()), clock: clock.Real}
+	if err := engine.SetGenesis(&types.Genesis{Hash: genesis.Header.Hash, Time: genesis.Header.Timestamp}); err != nil {
+		panic(err)
 	}
 
-	return int(math.Pow(10, float64(exponent)))
+	block := engine.newBlock(height, nil, genesis)
+	engine.addTransactions(block, sizeInBytes)
+
+	return block
 }
 
-func fillData(buf []byte, blockHeight uint64, txIndex int) []byte {
-	for i := range buf {
-		buf[i] = byte((blockHeight + uint64(txIndex) + uint64(i)) % 256)
+// newBlock creates the block at height on top of parent, without transactions and not sealed
+// yet. The nonce, set on blocks that are not canonical, goes in the header extra data so that
+// their hash differs from the canonical block.
+func (e *Engine) newBlock(height uint64, nonce *uint64, parent *types.Block) *types.Block {
+	rules := e.schedule.Rules(height)
+	now := e.clock.Now()
+
+	var extraData []byte
+	if nonce != nil {
+		extraData = binary.LittleEndian.AppendUint64(nil, *nonce)
 	}
 
-	return buf
-}
+	// Set before sealing for the block to be sized with its signature
+	var producerKey []byte
+	if e.producerKey != nil {
+		producerKey = e.producerKey.Public().(ed25519.PublicKey)
+	}
 
-func (e *Engine) newBlock(height uint64, nonce *uint64, parent *types.Block) *types.Block {
 	return &types.Block{
 		Header: &types.BlockHeader{
 			Height:    height,
-			Hash:      types.MakeHashNonce(height, nonce),
 			PrevNum:   &parent.Header.Height,
 			PrevHash:  &parent.Header.Hash,
 			FinalNum:  e.finalBlock.Header.Height,
 			FinalHash: e.finalBlock.Header.Hash,
-			Timestamp: e.genesisTime.Add(e.blockRate * time.Duration(height)),
-		},
-		Transactions: []types.Transaction{},
-	}
-}
+			Timestamp: e.timestamps.blockTime(e.schedule, e.genesis.Time, height, parent.Header.Timestamp, now),
 
-func (e *Engine) generateEvents(height uint64) []types.Event {
-	events := []types.Event{}
+			ProtocolVersion: rules.ProtocolVersion,
+			ExtraFields:     rules.HeaderFields,
+			PropagationTime: e.timestamps.propagationTime(now),
+			SkippedSlots:    height - parent.Header.Height - 1,
 
-	events = append(events, types.Event{
-		Type: "token_transfer",
-		Attributes: []types.Attribute{
-			{Key: "foo", Value: "bar"},
+			Proposer:    e.proposer,
+			GasLimit:    max(uint64(e.blockSizeInBytes)*gasLimitPerByte, minGasLimit),
+			ExtraData:   extraData,
+			ProducerKey: producerKey,
 		},
-	})
-
-	switch {
-	case height%2 == 0:
-		events = append(events, types.Event{
-			Type: "coin_spent",
-			Attributes: []types.Attribute{
-				{Key: "spender", Value: "fizz"},
-				{Key: "amount", Value: "buzz"},
-			},
-		})
-	case height%3 == 0:
-		events = append(events, types.Event{
-			Type: "delegate",
-			Attributes: []types.Attribute{
-				{Key: "delegator", Value: "addr1"},
-				{Key: "validator", Value: "addr2"},
-				{Key: "amount", Value: "123456789"},
-			},
-		})
-	case height%5 == 0:
-		events = append(events, types.Event{
-			Type: "undelegate",
-			Attributes: []types.Attribute{
-				{Key: "delegator", Value: "addr1"},
-				{Key: "amount", Value: "123456789"},
-			},
-		})
+		Transactions: []types.Transaction{},
 	}
-
-	return events
 }
 
 func ptr[T any](t T) *T {
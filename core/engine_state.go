@@ -0,0 +1,232 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// engineState is the production state of the engine that can't be derived from the stored
+// blocks, persisted so that a restarted node resumes exactly where it stopped. The fork
+// schedule and the block timestamps derive from the heights and the stored genesis, they
+// don't need to be persisted.
+type engineState struct {
+	// Flash is the last flash block sent
+	Flash *flashBlockState `json:"flash,omitempty"`
+
+	// Commitments are the blocks followed by the commitment pipeline
+	Commitments []committedBlockState `json:"commitments,omitempty"`
+}
+
+type flashBlockState struct {
+	Height uint64 `json:"height"`
+	Index  int32  `json:"index"`
+}
+
+type committedBlockState struct {
+	Height   uint64 `json:"height"`
+	Hash     string `json:"hash"`
+	PrevHash string `json:"prev_hash"`
+	Reached  int    `json:"reached"`
+}
+
+// pendingBlocks are the upcoming blocks built along with the first flash block of their
+// height, persisted apart from the engine state as they're only written once per height.
+type pendingBlocks struct {
+	Height uint64         `json:"height"`
+	Blocks []*types.Block `json:"blocks,omitempty"`
+
+	// Source is the block invalidated flash blocks are taken from, the first of Blocks
+	// otherwise
+	Source *types.Block `json:"source,omitempty"`
+}
+
+// resume restores the production state persisted in store by a previous run, and sends it to
+// be persisted there from now on. It must be called once the engine is initialized.
+func (e *Engine) resume(store *Store) error {
+	state, err := store.readEngineState()
+	if err != nil {
+		return fmt.Errorf("engine state: %w", err)
+	}
+
+	pending, err := store.readPendingBlocks()
+	if err != nil {
+		return fmt.Errorf("pending blocks: %w", err)
+	}
+
+	e.stateStore = store
+	e.resumed = state
+	if e.prevBlock == nil {
+		return nil
+	}
+
+	next := e.nextHeight(e.prevBlock.Header.Height, false)
+	if flash := state.Flash; flash != nil && flash.Height == next {
+		e.resumedFlash = flashProgress{height: flash.Height, index: flash.Index}
+	}
+
+	// A node that crashed may have stored flash blocks of next after persisting the state,
+	// they were traced already and the production continues after the last one
+	indexes, err := store.flashBlockIndexes(next)
+	if err != nil {
+		return fmt.Errorf("flash blocks of #%d: %w", next, err)
+	}
+	if len(indexes) > 0 && indexes[len(indexes)-1] > e.resumedFlash.index {
+		e.resumedFlash = flashProgress{height: next, index: indexes[len(indexes)-1]}
+	}
+
+	// The pending blocks are only resumed on top of the head they were built on, the flash
+	// blocks of their height being rebuilt otherwise
+	if pending == nil || pending.Height != next {
+		return nil
+	}
+
+	source := pending.Source
+	if source == nil && len(pending.Blocks) > 0 {
+		source = pending.Blocks[0]
+	}
+	if source == nil || valueOr(source.Header.PrevHash, "") != e.prevBlock.Header.Hash {
+		return nil
+	}
+
+	e.pendingBlocks = pending.Blocks
+	if e.resumedFlash.height == next {
+		e.resumedFlash.source = source
+	}
+
+	e.logger.
+		WithField("height", next).
+		WithField("flash_index", e.resumedFlash.index).
+		WithField("commitments", len(state.Commitments)).
+		Info("resuming block production")
+
+	return nil
+}
+
+// sendState sends the engine state to the node once what it describes was sent, for the
+// node to persist it once processed. It returns whether it was sent, like send.
+func (e *Engine) sendState(flash *flashProgress, commitments *commitmentPipeline) bool {
+	if e.stateStore == nil {
+		return true
+	}
+
+	state := &engineState{}
+	if flash.index > 0 {
+		state.Flash = &flashBlockState{Height: flash.height, Index: flash.index}
+	}
+
+	if commitments != nil {
+		for _, committed := range commitments.blocks {
+			state.Commitments = append(state.Commitments, committedBlockState{
+				Height:   committed.header.Height,
+				Hash:     committed.header.Hash,
+				PrevHash: valueOr(committed.header.PrevHash, ""),
+				Reached:  committed.reached,
+			})
+		}
+	}
+
+	return send(e, e.stateChan, state)
+}
+
+// persistPendingBlocks writes the blocks built for the flash blocks of height.
+func (e *Engine) persistPendingBlocks(height uint64, source *types.Block) {
+	if e.stateStore == nil {
+		return
+	}
+
+	pending := &pendingBlocks{Height: height, Blocks: e.pendingBlocks}
+	if len(e.pendingBlocks) == 0 || source != e.pendingBlocks[0] {
+		pending.Source = source
+	}
+
+	if err := e.stateStore.writePendingBlocks(pending); err != nil {
+		e.logger.WithError(err).Error("cant persist pending blocks")
+	}
+}
+
+// resumedCommitments returns the commitment pipeline of levels following the blocks followed
+// by the previous run.
+func (e *Engine) resumedCommitments(levels CommitmentLevels) *commitmentPipeline {
+	pipeline := newCommitmentPipeline(levels)
+	if e.resumed == nil {
+		return pipeline
+	}
+
+	for _, committed := range e.resumed.Commitments {
+		header := &types.BlockHeader{Height: committed.Height, Hash: committed.Hash}
+		if committed.PrevHash != "" {
+			header.PrevHash = &committed.PrevHash
+		}
+
+		// The levels may have changed since, a block having reached the last one is forgotten
+		if reached := min(committed.Reached, len(levels)); reached < len(levels) {
+			pipeline.blocks = append(pipeline.blocks, &committedBlock{header: header, reached: reached})
+		}
+	}
+
+	return pipeline
+}
+
+func (store *Store) readEngineState() (*engineState, error) {
+	state := &engineState{}
+	if err := store.readJSONFile(store.engineStatePath, state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (store *Store) writeEngineState(state *engineState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("json encode engine state: %w", err)
+	}
+
+	return store.files.WriteFile(store.engineStatePath, data, 0644)
+}
+
+// readPendingBlocks reads the pending blocks, verified like ReadBlock does, nil when there are
+// none.
+func (store *Store) readPendingBlocks() (*pendingBlocks, error) {
+	pending := &pendingBlocks{}
+	if err := store.readJSONFile(store.pendingBlocksPath, pending); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, block := range append(pending.Blocks, pending.Source) {
+		if block == nil {
+			continue
+		}
+
+		if err := store.verifyBlock(block); err != nil {
+			return nil, err
+		}
+	}
+
+	return pending, nil
+}
+
+func (store *Store) writePendingBlocks(pending *pendingBlocks) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("json encode pending blocks: %w", err)
+	}
+
+	return store.files.WriteFile(store.pendingBlocksPath, data, 0644)
+}
+
+func (store *Store) readJSONFile(filename string, value any) error {
+	data, err := store.files.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/streamingfast/dummy-blockchain/clock"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// newTestEngine returns an engine producing blocks of sizeInBytes on top of the test genesis,
+// signed by key when it's not nil.
+func newTestEngine(t *testing.T, sizeInBytes int, key ed25519.PrivateKey) *Engine {
+	t.Helper()
+
+	engine := NewEngine(EngineConfig{BlockRate: 60, BlockSizeInBytes: sizeInBytes, BlockWorkers: 2})
+	engine.SetClock(clock.NewVirtual(testGenesis.Time))
+	engine.SetLogger(testLogger())
+	if key != nil {
+		engine.SetProducerKey(key)
+	}
+
+	if err := engine.SetGenesis(testGenesis); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := types.GenesisBlock(testGenesis)
+	if err := engine.Initialize(genesis, genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	return &engine
+}
+
+func TestEngine_FillBlockSize(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bridge := types.Transaction{Type: "bridge", Hash: types.MakeHash("bridge"), Sender: "bridge:other", Receiver: "bridge", Amount: bigZero, Fee: bigZero, Success: true}
+
+	for _, size := range []int{1 * humanize.KiByte, 4 * humanize.KiByte, 64*humanize.KiByte + 3, 1 * humanize.MiByte, 10*humanize.MiByte + 1} {
+		for _, signed := range []bool{false, true} {
+			t.Run(fmt.Sprintf("size=%d/signed=%t", size, signed), func(t *testing.T) {
+				var engine *Engine
+				if signed {
+					engine = newTestEngine(t, size, key)
+				} else {
+					engine = newTestEngine(t, size, nil)
+				}
+
+				for height := uint64(1); height <= 3; height++ {
+					var bridges []types.Transaction
+					if height == 2 {
+						bridges = []types.Transaction{bridge}
+					}
+
+					block := engine.newBlock(height, nil, engine.prevBlock)
+					engine.fillBlock(block, size, bridges)
+					engine.advance(block, false)
+
+					if actual := block.ProtoSize(); actual != size || block.Header.Size != uint64(size) {
+						t.Errorf("block #%d is %d bytes with a header size of %d, expected %d", height, actual, block.Header.Size, size)
+					}
+
+					if err := block.Verify(); err != nil {
+						t.Errorf("verify block #%d: %s", height, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestEngine_StopHeight(t *testing.T) {
+	// 20 would become the final block when created
+	engine := NewEngine(EngineConfig{BlockRate: 60, BlockSizeInBytes: 1024, BlockWorkers: 2, StopHeight: 19})
+	clk := clock.NewVirtual(testGenesis.Time)
+	engine.SetClock(clk)
+	engine.SetLogger(testLogger())
+	if err := engine.SetGenesis(testGenesis); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := types.GenesisBlock(testGenesis)
+	if err := engine.Initialize(genesis, genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []*types.Block
+	blocks := engine.SubscribeBlocks()
+	go func() {
+		for block := range blocks {
+			sent = append(sent, block)
+			clk.Release()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		engine.StartBlockProduction(context.Background(), false)
+		close(done)
+	}()
+
+	for stopped := false; !stopped; {
+		select {
+		case <-done:
+			stopped = true
+		default:
+			if !clk.Step() {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	if head := sent[len(sent)-1].Header.Height; head != 19 {
+		t.Fatalf("last block sent is #%d, expected #19", head)
+	}
+
+	// The head and final block stay on the blocks sent, a restart with a higher stop height
+	// continues from them
+	if head := engine.prevBlock.Header.Height; head != 19 {
+		t.Errorf("engine head is #%d, expected #19", head)
+	}
+	if final := engine.FinalHeader().Height; final != 10 {
+		t.Errorf("engine final block is #%d, expected #10", final)
+	}
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// finalFlashBlockIndexOffset is added to the index of the final flash block, the last one
+// of a height completing the produced block, e.g. 1004 is the final flash block after 3
+// partial ones.
+const finalFlashBlockIndexOffset = 1000
+
+// invalidatedFlashBlockNonce is the nonce of the block invalidated flash blocks are taken
+// from, it doesn't overlap with the forks' ones.
+const invalidatedFlashBlockNonce = 20_000
+
+// FlashBlockContent is which transactions of the block produced at their height flash blocks
+// hold. Whatever the content, the partial flash blocks are exact prefixes of the block, which is
+// built as soon as the first flash block of its height is produced, and each one extends the
+// previous one.
+type FlashBlockContent string
+
+const (
+	// FlashBlockPrefix flash blocks hold all the transactions of the block so far.
+	FlashBlockPrefix FlashBlockContent = "prefix"
+
+	// FlashBlockDelta flash blocks only hold the transactions added since the previous flash
+	// block, the final one holding the remainder of the block. Their header commits to all
+	// the transactions so far, see types.AccumulateFlashBlock.
+	FlashBlockDelta FlashBlockContent = "delta"
+)
+
+func ParseFlashBlockContent(in string) (FlashBlockContent, error) {
+	switch FlashBlockContent(in) {
+	case "", FlashBlockPrefix:
+		return FlashBlockPrefix, nil
+	case FlashBlockDelta:
+		return FlashBlockDelta, nil
+	}
+
+	return "", fmt.Errorf("unknown flash block content %q, valid values are prefix and delta", in)
+}
+
+// FlashBlockConfig configures the flash blocks produced ahead of each block when they are
+// enabled. The partial flash blocks of a height are followed by the final flash block,
+// indexed 1000 + Partials + 1, which completes the produced block.
+type FlashBlockConfig struct {
+	// Partials is the amount of partial flash blocks produced before each block.
+	Partials int
+
+	// Interval is the time between two flash blocks, the first one coming Interval after the
+	// previous block, zero spreads them evenly over the block interval. The partials not
+	// produced by the time the next block is are dropped.
+	Interval time.Duration
+
+	Content FlashBlockContent
+
+	// InvalidateEvery invalidates, when reorgs are enabled, the flash blocks of the heights
+	// multiple of it: the final flash block is not sent and the produced block is not the
+	// one the partials were taken from. Zero never invalidates them. The partials of heights
+	// having a fork are invalidated too, they are taken from the fork.
+	InvalidateEvery uint64
+}
+
+// DefaultFlashBlockConfig returns 3 prefix partials per block, invalidated every 11 heights.
+func DefaultFlashBlockConfig() FlashBlockConfig {
+	return FlashBlockConfig{
+		Partials:        3,
+		Content:         FlashBlockPrefix,
+		InvalidateEvery: 11,
+	}
+}
+
+func (c FlashBlockConfig) Validate() error {
+	if c.Partials < 0 || c.Partials >= finalFlashBlockIndexOffset-1 {
+		return fmt.Errorf("flash block partials must be between 0 and %d, got %d", finalFlashBlockIndexOffset-2, c.Partials)
+	}
+
+	if c.Interval < 0 {
+		return fmt.Errorf("flash block interval must not be negative, got %s", c.Interval)
+	}
+
+	_, err := ParseFlashBlockContent(string(c.Content))
+	return err
+}
+
+// finalIndex returns the index of the final flash block.
+func (c FlashBlockConfig) finalIndex() int32 {
+	return finalFlashBlockIndexOffset + int32(c.Partials) + 1
+}
+
+// interval returns the time between two flash blocks at blockInterval.
+func (c FlashBlockConfig) interval(blockInterval time.Duration) time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+
+	return max(blockInterval/time.Duration(c.Partials+1), time.Millisecond)
+}
+
+// prefixLength returns the amount of transactions out of count the partial at index is a
+// prefix of, at least one, none before the first partial.
+func (c FlashBlockConfig) prefixLength(count int, index int32) int {
+	if index == 0 {
+		return 0
+	}
+
+	return min(max(count*int(index)/(c.Partials+1), 1), count)
+}
+
+// flashProgress tracks the flash blocks produced for the upcoming height.
+type flashProgress struct {
+	height uint64
+	index  int32
+
+	// source is the block the partials are taken from
+	source *types.Block
+}
+
+// flashBlocksInvalidated returns whether the flash blocks of height are invalidated.
+func (e *Engine) flashBlocksInvalidated(height uint64) bool {
+	return e.withReorgs && e.flashBlocks.InvalidateEvery > 0 && height%e.flashBlocks.InvalidateEvery == 0
+}
+
+// nextFlashBlock returns the next partial flash block of progress.
+func (e *Engine) nextFlashBlock(progress *flashProgress) *types.FlashBlock {
+	if progress.source == nil {
+		progress.source = e.flashBlockSource(progress.height)
+		e.persistPendingBlocks(progress.height, progress.source)
+	}
+
+	source := progress.source
+	previous := e.flashBlocks.prefixLength(len(source.Transactions), progress.index)
+
+	progress.index++
+	count := e.flashBlocks.prefixLength(len(source.Transactions), progress.index)
+
+	return &types.FlashBlock{
+		Block: e.flashBlock(source, previous, count),
+		Index: progress.index,
+	}
+}
+
+// finalFlashBlockSent returns whether progress already has the final flash block of height,
+// sent before the node crashed.
+func (e *Engine) finalFlashBlockSent(progress *flashProgress, height uint64) bool {
+	return progress.height == height && progress.index == e.flashBlocks.finalIndex()
+}
+
+// finalFlashBlock returns the final flash block of block, the first one produced at its
+// height, progress being the partials sent before it.
+func (e *Engine) finalFlashBlock(block *types.Block, progress *flashProgress) *types.FlashBlock {
+	previous := 0
+	if progress.height == block.Header.Height && progress.source == block {
+		previous = e.flashBlocks.prefixLength(len(block.Transactions), progress.index)
+	}
+
+	if e.flashBlocks.Content != FlashBlockDelta || previous == 0 {
+		// The header commits to the content, the final flash block must be the full block
+		// itself, even if we're on a block that will get reorg'd
+		header := *block.Header
+		return &types.FlashBlock{
+			Block: &types.Block{Header: &header, Transactions: block.Transactions},
+			Index: e.flashBlocks.finalIndex(),
+		}
+	}
+
+	return &types.FlashBlock{
+		Block: e.flashBlock(block, previous, len(block.Transactions)),
+		Index: e.flashBlocks.finalIndex(),
+	}
+}
+
+// flashBlock returns the flash block of source holding its count first transactions, the
+// ones from previous on for delta flash blocks.
+func (e *Engine) flashBlock(source *types.Block, previous int, count int) *types.Block {
+	header := *source.Header
+	block := &types.Block{Header: &header, Transactions: source.Transactions[:count:count]}
+
+	if e.flashBlocks.Content == FlashBlockDelta {
+		block.SealFlashDelta(e.producerKey, previous)
+	} else {
+		block.Seal(e.producerKey)
+	}
+
+	return block
+}
+
+// flashBlockSource returns the block the partials of height are taken from, the
+// upcoming block built ahead of time, or a block that will never be produced when they are
+// invalidated.
+func (e *Engine) flashBlockSource(height uint64) *types.Block {
+	if e.flashBlocksInvalidated(height) {
+		nonce := uint64(invalidatedFlashBlockNonce)
+		block := e.newBlock(height, &nonce, e.prevBlock)
+		e.addTransactions(block, e.blockSizeInBytes)
+
+		return block
+	}
+
+	e.pendingBlocks = e.buildBlocks(false)
+	return e.pendingBlocks[0]
+}
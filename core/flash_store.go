@@ -0,0 +1,142 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// Flash blocks are stored apart from the blocks, in the `flash` directory of the group of
+// their height, so that they're purged and archived along with the blocks of their height.
+const flashBlocksDir = "flash"
+
+// WriteFlashBlock writes flashBlock, leaving the block of its height and the head untouched. A
+// flash block of the same height and index, written before a restart, is replaced.
+func (store *Store) WriteFlashBlock(flashBlock *types.FlashBlock) error {
+	height := flashBlock.Header.Height
+	if err := store.files.MkdirAll(store.flashBlocksDir(height)); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(flashBlock)
+	if err != nil {
+		return fmt.Errorf("json encode flash block: %w", err)
+	}
+
+	return store.files.WriteFile(store.flashBlockFilename(height, flashBlock.Index), append(data, '\n'), 0644)
+}
+
+// ReadFlashBlock reads the flash block of height at index, verified like ReadBlock does. A
+// *BlockUnavailableError is returned when the height is out of the stored ones, an error
+// matching os.ErrNotExist when no flash block was produced at index.
+func (store *Store) ReadFlashBlock(height uint64, index int32) (*types.FlashBlock, error) {
+	if err := store.checkFlashBlockHeight(height); err != nil {
+		return nil, err
+	}
+
+	data, err := store.files.ReadFile(store.flashBlockFilename(height, index))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no flash block at index %d of height #%d: %w", index, height, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	flashBlock := &types.FlashBlock{}
+	if err := json.Unmarshal(data, flashBlock); err != nil {
+		return nil, err
+	}
+
+	if flashBlock.Block == nil || flashBlock.Header == nil {
+		return nil, fmt.Errorf("%w: flash block at index %d of height #%d has no header", types.ErrInvalidBlock, index, height)
+	}
+
+	if err := store.verifyBlock(flashBlock.Block); err != nil {
+		return nil, err
+	}
+
+	return flashBlock, nil
+}
+
+// ReadFlashBlocks reads the flash blocks of height sorted by index, none when no flash block
+// was produced at height.
+func (store *Store) ReadFlashBlocks(height uint64) ([]*types.FlashBlock, error) {
+	if err := store.checkFlashBlockHeight(height); err != nil {
+		return nil, err
+	}
+
+	indexes, err := store.flashBlockIndexes(height)
+	if err != nil {
+		return nil, err
+	}
+
+	flashBlocks := make([]*types.FlashBlock, 0, len(indexes))
+	for _, index := range indexes {
+		flashBlock, err := store.ReadFlashBlock(height, index)
+		if err != nil {
+			return nil, err
+		}
+		flashBlocks = append(flashBlocks, flashBlock)
+	}
+
+	return flashBlocks, nil
+}
+
+// flashBlockIndexes returns the sorted indexes of the flash blocks stored at height.
+func (store *Store) flashBlockIndexes(height uint64) ([]int32, error) {
+	entries, err := store.files.ReadDir(store.flashBlocksDir(height))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var indexes []int32
+	prefix := strconv.FormatUint(height, 10) + "."
+	for _, entry := range entries {
+		name, found := strings.CutPrefix(strings.TrimSuffix(entry.Name(), ".json"), prefix)
+		if !found {
+			continue
+		}
+
+		index, err := strconv.ParseInt(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, int32(index))
+	}
+	slices.Sort(indexes)
+
+	return indexes, nil
+}
+
+// checkFlashBlockHeight returns a *BlockUnavailableError when the flash blocks of height
+// can't be stored, flash blocks being produced up to the height following the head.
+func (store *Store) checkFlashBlockHeight(height uint64) error {
+	if height < store.meta.GenesisHeight {
+		return &BlockUnavailableError{Height: height, Reason: BlockBelowGenesis}
+	}
+
+	if height > store.HeadHeight()+1 {
+		return &BlockUnavailableError{Height: height, Reason: BlockNotProduced}
+	}
+
+	if height < store.LowestHeight() {
+		return &BlockUnavailableError{Height: height, Reason: BlockPruned}
+	}
+
+	return nil
+}
+
+func (store *Store) flashBlocksDir(height uint64) string {
+	return filepath.Join(store.groupDir(store.blockGroup(height)), flashBlocksDir)
+}
+
+func (store *Store) flashBlockFilename(height uint64, index int32) string {
+	return filepath.Join(store.flashBlocksDir(height), fmt.Sprintf("%d.%d.json", height, index))
+}
@@ -0,0 +1,328 @@
+package core
+
+import (
+	"math"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// txGenerator builds the transactions of blocks, splitting the work of big blocks over
+// worker goroutines. The transactions of upcoming heights can be prepared ahead of time
+// with prefetch so that block production keeps up with its rate even for huge blocks.
+//
+// Generated transactions only depend on the height, the index of the first transaction and
+// the size budget, never on the amount of workers or on whether they were prefetched.
+type txGenerator struct {
+	workers int
+
+	// schedule provides the transaction types added by upgrades, nil means none
+	schedule *types.Schedule
+
+	lock     sync.Mutex
+	prepared map[uint64]*preparedTransactions
+}
+
+// preparedTransactions are generated for the whole block size, which is always a bit more
+// than the actual budget once the header is known. Since the data of a transaction at a given
+// length is a prefix of its data at a bigger length, the data buffers are then re-sliced.
+type preparedTransactions struct {
+	budget       int
+	transactions []types.Transaction
+	done         chan struct{}
+}
+
+// Below this amount of transactions per worker, splitting the work costs more than it saves
+const minTransactionsPerWorker = 256
+
+func newTxGenerator(workers int) *txGenerator {
+	return &txGenerator{
+		workers:  max(workers, 1),
+		prepared: map[uint64]*preparedTransactions{},
+	}
+}
+
+// prefetch starts generating in the background the transactions of the block at height,
+// budget must be at least as big as the one later passed to transactions.
+func (g *txGenerator) prefetch(height uint64, budget int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if _, found := g.prepared[height]; found {
+		return
+	}
+
+	prepared := &preparedTransactions{budget: budget, done: make(chan struct{})}
+	g.prepared[height] = prepared
+
+	go func() {
+		defer close(prepared.done)
+		prepared.transactions = g.generate(height, 0, budget, nil)
+	}()
+}
+
+// discardBelow drops prepared transactions of heights that will never be produced.
+func (g *txGenerator) discardBelow(height uint64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for preparedHeight := range g.prepared {
+		if preparedHeight < height {
+			delete(g.prepared, preparedHeight)
+		}
+	}
+}
+
+// transactions returns the transactions filling budget bytes of the block at height, first
+// being the index of the first transaction (when the block already has some). At least one
+// transaction is always returned.
+func (g *txGenerator) transactions(height uint64, first int, budget int) []types.Transaction {
+	var reuse []types.Transaction
+
+	if first == 0 {
+		// Prepared transactions are kept until discardBelow is called, flash blocks of the
+		// same height can re-use them, generated transactions are never mutated once returned.
+		g.lock.Lock()
+		prepared, found := g.prepared[height]
+		g.lock.Unlock()
+
+		if found {
+			<-prepared.done
+			if prepared.budget >= budget && targetTxCount(prepared.budget) == targetTxCount(budget) {
+				reuse = prepared.transactions
+			}
+		}
+	}
+
+	return g.generate(height, first, budget, reuse)
+}
+
+func (g *txGenerator) generate(height uint64, first int, budget int, reuse []types.Transaction) []types.Transaction {
+	count := targetTxCount(budget)
+
+	// Transactions are first created without data, they are small and it's then possible to
+	// compute exactly how much data must be spread over them to reach the requested size.
+	transactions := reuse
+	if transactions == nil {
+		txTypes := g.transactionTypes(height)
+		transactions = make([]types.Transaction, count)
+		g.parallel(count, func(start, end int) {
+			for i := start; i < end; i++ {
+				transactions[i] = newTransaction(height, first+i, txTypes)
+			}
+		})
+	}
+	count = len(transactions)
+
+	dataLengths := make([]int, count)
+	fieldSizes := make([]int, count)
+
+	size := 0
+	for i := range transactions {
+		fieldSizes[i] = transactions[i].ProtoFieldSizeWithData(0)
+		if i > 0 && size+fieldSizes[i] > budget {
+			count = i
+			break
+		}
+
+		size += fieldSizes[i]
+	}
+
+	remaining := budget - size
+	for i := 0; i < count && remaining > 0; i++ {
+		dataLengths[i] = dataLengthForFieldSize(&transactions[i], fieldSizes[i]+remaining/(count-i))
+		remaining -= transactions[i].ProtoFieldSizeWithData(dataLengths[i]) - fieldSizes[i]
+	}
+
+	out := make([]types.Transaction, count)
+	g.parallel(count, func(start, end int) {
+		for i := start; i < end; i++ {
+			out[i] = transactions[i]
+
+			switch length := dataLengths[i]; {
+			case length == 0:
+				out[i].Data = nil
+			case len(transactions[i].Data) >= length:
+				out[i].Data = transactions[i].Data[:length]
+			default:
+				out[i].Data = fillData(make([]byte, length), height, first+i)
+			}
+		}
+	})
+
+	return out
+}
+
+// transactionTypes returns the types of the transactions generated at height.
+func (g *txGenerator) transactionTypes(height uint64) []string {
+	if g.schedule == nil {
+		return simulateTypes
+	}
+
+	added := g.schedule.Rules(height).TransactionTypes
+	if len(added) == 0 {
+		return simulateTypes
+	}
+
+	return append(slices.Clone(simulateTypes), added...)
+}
+
+// parallel calls work over [0, count) split in contiguous ranges, one per worker.
+func (g *txGenerator) parallel(count int, work func(start, end int)) {
+	workers := min(g.workers, count/minTransactionsPerWorker)
+	if workers <= 1 {
+		work(0, count)
+		return
+	}
+
+	chunkSize := (count + workers - 1) / workers
+
+	wg := sync.WaitGroup{}
+	for start := 0; start < count; start += chunkSize {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			work(start, end)
+		}(start, min(start+chunkSize, count))
+	}
+
+	wg.Wait()
+}
+
+var simulateTypes = []string{"transfer", "delegate", "undelegate", "reward", "slash"}
+var bigZero = big.NewInt(0)
+
+// dataLengthForFieldSize returns the largest data length for which the transaction field
+// size is at most targetFieldSize, taking into account the length prefixes growing with it.
+func dataLengthForFieldSize(trx *types.Transaction, targetFieldSize int) int {
+	dataLength := targetFieldSize - trx.ProtoFieldSizeWithData(0)
+	for dataLength > 0 {
+		excess := trx.ProtoFieldSizeWithData(dataLength) - targetFieldSize
+		if excess <= 0 {
+			break
+		}
+
+		dataLength -= excess
+	}
+
+	return max(dataLength, 0)
+}
+
+func newTransaction(height uint64, i int, txTypes []string) types.Transaction {
+	txHash := types.MakeFakeHash(height, i)
+	sender := "0x" + txHash[:40]
+	receiver := "0x" + txHash[24:64]
+	amount := new(big.Int).SetUint64((height << 32) | uint64(i))
+	success := true
+
+	// Each five transactions, make a fixed sender
+	if i%7 == 0 {
+		sender = "0xDEADBEEF"
+	}
+
+	// Each eleven transactions, make a fixed receiver
+	if i%11 == 0 {
+		receiver = "0xBAAAAAAD"
+	}
+
+	// Each 3 transactions, make amount zero
+	if i%3 == 0 {
+		amount = bigZero
+	}
+
+	// Each 13 transactions, make it fail
+	if i%13 == 0 {
+		success = false
+	}
+
+	return types.Transaction{
+		Type:     txTypes[i%len(txTypes)],
+		Hash:     txHash,
+		Sender:   sender,
+		Receiver: receiver,
+		Amount:   amount,
+		Fee:      new(big.Int).SetUint64(height + uint64(i)),
+		Success:  success,
+		Events:   generateEvents(height),
+	}
+}
+
+// targetTxCount provides an estimated target transaction count, and it gives roughly
+// in that range:
+//
+//   - 100 transactions at 100KiB
+//   - 1000 transactions at 1MiB
+//   - 2500 transactions at 2.5MiB
+//   - 5000 transactions at 5MiB
+//   - 10000 transactions at 10MiB
+//   - 100000 transactions at 100MiB
+//   - etc.
+//
+// With a minimum of 10 transactions.
+func targetTxCount(blockSizeInBytes int) int {
+	scale := math.Log10(float64(blockSizeInBytes))
+	exponent := scale - 3
+	if exponent < 1 {
+		exponent = 1
+	}
+
+	return int(math.Pow(10, float64(exponent)))
+}
+
+func fillData(buf []byte, blockHeight uint64, txIndex int) []byte {
+	for i := range buf {
+		buf[i] = byte((blockHeight + uint64(txIndex) + uint64(i)) % 256)
+	}
+
+	return buf
+}
+
+func generateEvents(height uint64) []types.Event {
+	events := []types.Event{}
+
+	events = append(events, types.Event{
+		Type: "token_transfer",
+		Attributes: []types.Attribute{
+			{Key: "foo", Value: "bar"},
+		},
+	})
+
+	switch {
+	case height%2 == 0:
+		events = append(events, types.Event{
+			Type: "coin_spent",
+			Attributes: []types.Attribute{
+				{Key: "spender", Value: "fizz"},
+				{Key: "amount", Value: "buzz"},
+			},
+		})
+	case height%3 == 0:
+		events = append(events, types.Event{
+			Type: "delegate",
+			Attributes: []types.Attribute{
+				{Key: "delegator", Value: "addr1"},
+				{Key: "validator", Value: "addr2"},
+				{Key: "amount", Value: "123456789"},
+			},
+		})
+	case height%5 == 0:
+		events = append(events, types.Event{
+			Type: "undelegate",
+			Attributes: []types.Attribute{
+				{Key: "delegator", Value: "addr1"},
+				{Key: "amount", Value: "123456789"},
+			},
+		})
+	}
+
+	return events
+}
+
+// estimateGas returns the gas used by the transactions generated for budget at height, it's
+// exact unless the budget is too small for the target transaction count.
+func estimateGas(height uint64, budget int) uint64 {
+	trx := types.Transaction{Events: generateEvents(height)}
+	return uint64(targetTxCount(budget)) * trx.Gas()
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// GenerateHistory produces the blocks following the engine's current head up to height `to`
+// (inclusive) as fast as possible, handing them to write in height order. The skipped heights,
+// forks and finality rules are the same as live production, the fork blocks of a height being
+// handed before its canonical block.
+//
+// Transactions, the expensive part, are generated by workers goroutines ahead of the
+// sequential header chaining, write is called from a single goroutine.
+func (e *Engine) GenerateHistory(ctx context.Context, to uint64, workers int, write func(block *types.Block) error) (last *types.Block, err error) {
+	if e.prevBlock == nil {
+		return nil, fmt.Errorf("engine must be initialized with a head block")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Each block gets its own generator using a single goroutine, parallelism comes from
+	// generating multiple blocks at the same time.
+	generator := newTxGenerator(1)
+	generator.schedule = e.schedule
+	futures := make(chan *historyFuture, workers*2)
+	jobs := make(chan func(), workers)
+
+	wg := sync.WaitGroup{}
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+	defer func() {
+		// Unblocks the height producer so that workers' job queue gets closed
+		cancel()
+		wg.Wait()
+	}()
+
+	go func() {
+		defer close(futures)
+		defer close(jobs)
+
+		for height := e.nextHeight(e.prevBlock.Header.Height, false); height <= to; height = e.nextHeight(height, false) {
+			future := &historyFuture{height: height, transactions: make(chan []types.Transaction, 1)}
+			job := func() { future.transactions <- generator.generate(height, 0, e.blockSizeInBytes, nil) }
+
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case futures <- future:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	lastLog := start
+	count := 0
+
+	for future := range futures {
+		var prepared []types.Transaction
+		select {
+		case prepared = <-future.transactions:
+		case <-ctx.Done():
+			return last, ctx.Err()
+		}
+
+		height := future.height
+
+		// Forks are written before the canonical block like when producing live, the store
+		// replaces them with the canonical blocks and merged blocks only keep the canonical ones
+		for _, fork := range e.forkBlocks(height, false) {
+			if err := write(fork); err != nil {
+				return last, fmt.Errorf("write fork block #%d: %w", fork.Header.Height, err)
+			}
+		}
+
+		block := e.newBlock(height, nil, e.prevBlock)
+
+		// Transactions were generated for the whole block size, now that the header is known
+		// they are re-sliced to fill the exact remaining budget.
+		e.fillTransactions(block, e.blockSizeInBytes, nil, func(first int, budget int) []types.Transaction {
+			return generator.generate(height, first, budget, prepared)
+		})
+
+		if err := write(block); err != nil {
+			return last, fmt.Errorf("write block #%d: %w", height, err)
+		}
+
+		e.advance(block, false)
+		last = block
+		count++
+
+		if time.Since(lastLog) > 5*time.Second {
+			elapsed := time.Since(start)
+			e.logger.
+				WithField("block", blockRef{block.Header.Hash, block.Header.Height}).
+				WithField("blocks_per_second", fmt.Sprintf("%.1f", float64(count)/elapsed.Seconds())).
+				Info("generating history")
+			lastLog = time.Now()
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return last, err
+	}
+
+	e.logger.WithField("count", count).WithField("duration", time.Since(start).String()).Info("history generated")
+	return last, nil
+}
+
+// historyFuture holds the transactions of height being generated by a worker.
+type historyFuture struct {
+	height       uint64
+	transactions chan []types.Transaction
+}
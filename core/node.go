@@ -2,71 +2,150 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/clock"
 	"github.com/streamingfast/dummy-blockchain/tracer"
 	"github.com/streamingfast/dummy-blockchain/types"
 )
 
+// ErrAborted is returned by Node.Start when the node was aborted.
+var ErrAborted = errors.New("node aborted")
+
 type Node struct {
 	engine               Engine
-	server               Server
+	server               *Server
 	store                *Store
 	tracer               tracer.Tracer
 	withCommitmentSignal bool
 	withFlashBlocks      bool
+
+	// shutdownTimeout bounds how long stopping the node waits for the block production to
+	// drain and for the server requests in progress, zero waits as long as needed
+	shutdownTimeout time.Duration
+
+	// aborted is closed by Abort, to stop like a crash would
+	aborted   chan struct{}
+	abortOnce sync.Once
+
+	clock  clock.Clock
+	logger logrus.FieldLogger
+}
+
+// NodeConfig configures a node, the blocks it produces, where it stores, serves and traces
+// them.
+type NodeConfig struct {
+	EngineConfig
+
+	// Genesis is the genesis of a new store, an initialized store keeps its own.
+	Genesis *types.Genesis
+
+	// StoreDir is where the chain is stored, in memory when it's empty.
+	StoreDir string
+
+	// Retention is the blocks kept by the store.
+	Retention Retention
+
+	// ServerAddr is the address the chain is served on, not at all when it's empty.
+	ServerAddr string
+
+	// ShutdownTimeout bounds the time the server drains its requests when the node stops.
+	ShutdownTimeout time.Duration
+
+	// Tracer traces the stored blocks, flash blocks and signals, nil traces nothing.
+	Tracer tracer.Tracer
+
+	// WithCommitmentSignal sends the commitment signals of the CommitmentLevels.
+	WithCommitmentSignal bool
 }
 
-func NewNode(
-	storeDir string,
-	blockRate int,
-	blockSizeInBytes int,
-	genesisHash string,
-	genesisHeight uint64,
-	genesisTime time.Time,
-	genesisBlockBurst uint64,
-	stopHeight uint64,
-	serverAddr string,
-	tracer tracer.Tracer,
-	withCommitmentSignal bool,
-	withSkippedBlocks bool,
-	withReorgs bool,
-	withFlashBlocks bool,
-	purge bool,
-) *Node {
-	store := NewStore(storeDir, genesisHash, genesisHeight, genesisTime, purge)
+// NewNode creates a node configured by config.
+func NewNode(config NodeConfig) *Node {
+	store := NewMemoryStore(config.Genesis, config.Retention)
+	if config.StoreDir != "" {
+		store = NewStore(config.StoreDir, config.Genesis, config.Retention)
+	}
+
+	var server *Server
+	if config.ServerAddr != "" {
+		server = ptr(NewServer(store, config.ServerAddr))
+	}
 
 	return &Node{
-		engine:               NewEngine(genesisHash, genesisHeight, genesisTime, genesisBlockBurst, stopHeight, blockRate, blockSizeInBytes, withSkippedBlocks, withReorgs),
+		engine:               NewEngine(config.EngineConfig),
 		store:                store,
-		server:               NewServer(store, serverAddr),
-		tracer:               tracer,
-		withCommitmentSignal: withCommitmentSignal,
-		withFlashBlocks:      withFlashBlocks,
+		server:               server,
+		tracer:               config.Tracer,
+		withCommitmentSignal: config.WithCommitmentSignal,
+		withFlashBlocks:      config.WithFlashBlocks,
+		shutdownTimeout:      config.ShutdownTimeout,
+		aborted:              make(chan struct{}),
+		clock:                clock.Real,
+		logger:               logrus.StandardLogger(),
 	}
 }
 
+// SetClock sets the clock of the node, its engine and store, the system clock by default. It
+// must be called before initializing the node.
+func (node *Node) SetClock(clock clock.Clock) {
+	node.clock = clock
+	node.engine.SetClock(clock)
+	node.store.SetClock(clock)
+}
+
+// SetLogger sets the logger of the node, its engine and store, the logrus standard logger by
+// default.
+func (node *Node) SetLogger(logger logrus.FieldLogger) {
+	node.logger = logger
+	node.engine.SetLogger(logger)
+	node.store.SetLogger(logger)
+}
+
+// Abort stops the node abruptly, like a crash: Start returns ErrAborted once the block, flash
+// block or signal being processed is stored and traced, without draining the blocks of the
+// height in progress nor persisting the production state. It's used to test that a node
+// restarted after a crash resumes a continuous stream.
+func (node *Node) Abort() {
+	node.abortOnce.Do(func() {
+		close(node.aborted)
+	})
+}
+
+// ForceReorg makes the node produce a fork sequence of depth blocks, see Engine.ForceReorg.
+func (node *Node) ForceReorg(depth int) {
+	node.engine.ForceReorg(depth)
+}
+
 func (node *Node) Initialize() error {
-	logrus.
+	node.logger.
 		WithField("with_commitment_signal", node.withCommitmentSignal).
+		WithField("commitment_levels", node.engine.commitmentLevels).
 		WithField("with_flash_blocks", node.withFlashBlocks).
+		WithField("timestamp_mode", node.engine.timestamps.Mode()).
 		Info("initializing node")
 
-	logrus.Info("initializing store")
+	node.logger.Info("initializing store")
 	if err := node.store.Initialize(); err != nil {
-		logrus.WithError(err).Error("store initialization failed")
+		node.logger.WithError(err).Error("store initialization failed")
+		return err
+	}
+
+	if err := node.store.SetTimestampMode(node.engine.timestamps.Mode()); err != nil {
+		node.logger.WithError(err).Error("cant record timestamp mode")
 		return err
 	}
 
 	var tipBlock *types.Block
 	if tip := node.store.meta.HeadHeight; tip > 0 {
-		logrus.WithField("tip", tip).Info("loading last block")
+		node.logger.WithField("tip", tip).Info("loading last block")
 		block, err := node.store.ReadBlock(tip)
 		if err != nil {
-			logrus.WithError(err).Error("cant read last block")
+			node.logger.WithError(err).Error("cant read last block")
 			return err
 		}
 		tipBlock = block
@@ -79,10 +158,10 @@ func (node *Node) Initialize() error {
 		final = node.store.meta.GenesisHeight
 	}
 
-	logrus.WithField("final", final).Info("loading final block")
+	node.logger.WithField("final", final).Info("loading final block")
 	finalBlock, err := node.store.ReadBlock(final)
 	if err != nil {
-		logrus.WithError(err).Error("cant read final block")
+		node.logger.WithError(err).Error("cant read final block")
 		return err
 	}
 
@@ -90,22 +169,44 @@ func (node *Node) Initialize() error {
 		return fmt.Errorf("can't find final block %d", final)
 	}
 
-	logrus.Info("initializing engine")
+	// Block timestamps derive from the genesis, the persisted one must be used for
+	// production to continue seamlessly from the stored head.
+	if err := node.engine.SetGenesis(node.store.Genesis()); err != nil {
+		node.logger.WithError(err).Error("invalid genesis")
+		return err
+	}
+
+	node.engine.SetProducerKey(node.store.ProducerKey())
+
+	// The stored final height is the final block when the head was produced, the head became
+	// final itself right after if it's at a final height
+	if tipBlock != nil && node.engine.schedule.Rules(tipBlock.Header.Height).IsFinal(tipBlock.Header.Height) {
+		finalBlock = tipBlock
+	}
+
+	node.logger.Info("initializing engine")
 	if err := node.engine.Initialize(tipBlock, finalBlock); err != nil {
-		logrus.WithError(err).Error("engine initialization failed")
+		node.logger.WithError(err).Error("engine initialization failed")
+		return err
+	}
+
+	if err := node.engine.resume(node.store); err != nil {
+		node.logger.WithError(err).Error("engine state restoration failed")
 		return err
 	}
 
 	if tracer := node.tracer; tracer != nil {
+		// The protocol version is announced once, flash blocks enabled by a later upgrade
+		// require 3.1 from the start.
 		version := "3.0"
-		if node.withFlashBlocks {
+		if node.engine.schedule.HasFlashBlocks() {
 			version = "3.1"
 		}
 
-		logrus.WithField("firehose_protocol_version", version).Info("initializing tracer")
+		node.logger.WithField("firehose_protocol_version", version).Info("initializing tracer")
 
 		if err := node.tracer.Initialize(version); err != nil {
-			logrus.WithError(err).Error("tracer initialization failed")
+			node.logger.WithError(err).Error("tracer initialization failed")
 			return err
 		}
 	}
@@ -113,11 +214,57 @@ func (node *Node) Initialize() error {
 	return nil
 }
 
+// Store returns the store of the node's chain.
+func (node *Node) Store() *Store {
+	return node.store
+}
+
+// BridgeTo makes the node's blocks reference the final blocks of remote, another chain named
+// chain running in the same process, through bridge transactions.
+func (node *Node) BridgeTo(chain string, remote *Node) {
+	node.engine.BridgeTo(chain, &remote.engine)
+}
+
+// Start produces blocks until ctx is done or the stop height is reached. Once ctx is done, the
+// blocks of the height in progress are still stored and traced before it returns, so that
+// the node stops on a clean state, at most the shutdown timeout. The server failing or a
+// block failing to be stored stops the node with the error, Abort with ErrAborted.
 func (node *Node) Start(ctx context.Context) error {
-	go node.server.Start() // TODO: handle error here
-	go node.engine.StartBlockProduction(ctx, node.withCommitmentSignal, node.withFlashBlocks)
+	defer node.store.Close()
+
+	serverErr := make(chan error, 1)
+	if node.server != nil {
+		go func() { serverErr <- node.server.Start() }()
+		defer node.shutdownServer()
+	}
+
+	// Unblocks the engine when returning before it's done, and waits for it so that it
+	// doesn't persist anything once returned
+	engineCtx, cancelEngine := context.WithCancel(ctx)
+	produced := make(chan struct{})
+	defer func() {
+		cancelEngine()
+		node.engine.Abort()
+		<-produced
+	}()
+
+	go func() {
+		defer close(produced)
+		node.engine.StartBlockProduction(engineCtx, node.withCommitmentSignal)
+	}()
+
+	done := ctx.Done()
+	var drainTimeout <-chan time.Time
 
 	for {
+		// Checked first, the abort racing with the next produced item otherwise
+		select {
+		case <-node.aborted:
+			node.logger.Warn("node aborted")
+			return ErrAborted
+		default:
+		}
+
 		select {
 		case block, ok := <-node.engine.SubscribeBlocks():
 			if !ok {
@@ -125,84 +272,100 @@ func (node *Node) Start(ctx context.Context) error {
 			}
 
 			start := time.Now()
-			if err := node.processBlock(block); err != nil {
-				logrus.WithError(err).Error("failed to process block")
+			err := node.processBlock(block)
+			node.clock.Release()
+			if err != nil {
+				node.logger.WithError(err).Error("failed to process block")
 				return err
 			}
-			logrus.WithField("duration", time.Since(start).String()).Debug("block processed")
-
-			if tracer := node.tracer; tracer != nil {
-				tracer.OnBlockStart(block.Header)
-				for _, trx := range block.Transactions {
-					tracer.OnTrxStart(&trx)
-
-					func() {
-						defer tracer.OnTrxEnd(&trx)
-
-						for _, event := range trx.Events {
-							tracer.OnTrxEvent(trx.Hash, &event)
-						}
-					}()
-				}
-
-				tracer.OnBlockEnd(block, node.engine.finalBlock.Header)
-			}
+			node.logger.WithField("duration", time.Since(start).String()).Debug("block processed")
 
 		case fb, ok := <-node.engine.SubscribeFlashBlocks():
 			if !ok {
 				return nil
 			}
-			if err := node.processFlashBlock(fb); err != nil {
-				logrus.WithError(err).Error("failed to process block")
+			err := node.processFlashBlock(fb)
+			node.clock.Release()
+			if err != nil {
+				node.logger.WithError(err).Error("failed to process block")
 				return err
 			}
 
-			if tracer := node.tracer; tracer != nil {
-				tracer.OnFlashBlockStart(fb.Block.Header)
-				for _, trx := range fb.Block.Transactions {
-					tracer.OnTrxStart(&trx)
-
-					func() {
-						defer tracer.OnTrxEnd(&trx)
-
-						for _, event := range trx.Events {
-							tracer.OnTrxEvent(trx.Hash, &event)
-						}
-					}()
-				}
+		case sig, ok := <-node.engine.SubscribeSignals():
+			if !ok {
+				return nil
+			}
 
-				tracer.OnFlashBlockEnd(fb.Block, node.engine.finalBlock.Header, fb.Index)
+			err := node.processSignal(sig)
+			node.clock.Release()
+			if err != nil {
+				node.logger.WithError(err).Error("failed to process signal")
+				return err
 			}
 
-		case sig, ok := <-node.engine.SubscribeSignals():
+		case state, ok := <-node.engine.subscribeState():
 			if !ok {
 				return nil
 			}
 
-			if tracer := node.tracer; tracer != nil {
-				tracer.OnCommitmentSignal(sig)
+			// Persisted once what it describes was processed, so that the node resumes from
+			// it after a crash
+			err := node.store.writeEngineState(state)
+			node.clock.Release()
+			if err != nil {
+				node.logger.WithError(err).Error("failed to persist engine state")
+				return err
+			}
+
+		case <-node.aborted:
+			continue
+
+		case err := <-serverErr:
+			if err != nil {
+				return fmt.Errorf("server: %w", err)
+			}
+
+		case <-done:
+			node.logger.Info("waiting for the block production to stop")
+			done = nil
+			if node.shutdownTimeout > 0 {
+				drainTimeout = time.After(node.shutdownTimeout)
 			}
 
-		case <-ctx.Done():
-			return nil
+		case <-drainTimeout:
+			return fmt.Errorf("block production didn't stop within the shutdown timeout of %s", node.shutdownTimeout)
 		}
 	}
 }
 
+// shutdownServer waits for the server requests in progress, at most the shutdown timeout.
+func (node *Node) shutdownServer() {
+	ctx := context.Background()
+	if node.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, node.shutdownTimeout)
+		defer cancel()
+	}
+
+	if err := node.server.Shutdown(ctx); err != nil {
+		node.logger.WithError(err).Warn("server shutdown did not complete")
+	}
+}
+
 func (node *Node) processBlock(block *types.Block) error {
 	eventCount := 0
 	for _, tx := range block.Transactions {
 		eventCount += len(tx.Events)
 	}
 
-	logrus.
+	node.logger.
 		WithField("block", blockRef{block.Header.Hash, block.Header.Height}).
 		WithField("parent_block", blockRef{valueOr(block.Header.PrevHash, ""), valueOr(block.Header.PrevNum, 0)}).
 		WithField("final_block", blockRef{block.Header.FinalHash, block.Header.FinalNum}).
 		WithField("stats", fmt.Sprintf("Txs: %d, Events: %d, Size: %s",
 			len(block.Transactions),
 			eventCount,
-			humanize.Bytes(uint64(block.ApproximatedSize())),
+			humanize.Bytes(uint64(block.ProtoSize())),
 		)).
 		Info("processing block")
 
@@ -210,6 +373,12 @@ func (node *Node) processBlock(block *types.Block) error {
 		return err
 	}
 
+	if node.tracer != nil {
+		if err := tracer.TraceBlock(node.tracer, block, node.engine.FinalHeader()); err != nil {
+			return fmt.Errorf("trace block #%d: %w", block.Header.Height, err)
+		}
+	}
+
 	return nil
 }
 
@@ -220,7 +389,7 @@ func (node *Node) processFlashBlock(flashBlock *types.FlashBlock) error {
 		eventCount += len(tx.Events)
 	}
 
-	logrus.
+	node.logger.
 		WithField("block", blockRef{block.Header.Hash, block.Header.Height}).
 		WithField("parent_block", blockRef{valueOr(block.Header.PrevHash, ""), valueOr(block.Header.PrevNum, 0)}).
 		WithField("final_block", blockRef{block.Header.FinalHash, block.Header.FinalNum}).
@@ -228,14 +397,34 @@ func (node *Node) processFlashBlock(flashBlock *types.FlashBlock) error {
 		WithField("stats", fmt.Sprintf("Txs: %d, Events: %d, Size: %s",
 			len(block.Transactions),
 			eventCount,
-			humanize.Bytes(uint64(block.ApproximatedSize())),
+			humanize.Bytes(uint64(block.ProtoSize())),
 		)).
 		Info("processing flash block")
 
-	if err := node.store.WriteBlock(block); err != nil {
+	if err := node.store.WriteFlashBlock(flashBlock); err != nil {
+		return err
+	}
+
+	if node.tracer != nil {
+		if err := tracer.TraceFlashBlock(node.tracer, flashBlock, node.engine.FinalHeader()); err != nil {
+			return fmt.Errorf("trace flash block #%d.%d: %w", block.Header.Height, flashBlock.Index, err)
+		}
+	}
+
+	return nil
+}
+
+func (node *Node) processSignal(signal *types.Signal) error {
+	if err := node.store.WriteSignal(signal); err != nil {
 		return err
 	}
 
+	if node.tracer != nil {
+		if err := node.tracer.OnCommitmentSignal(signal); err != nil {
+			return fmt.Errorf("trace signal of block #%d: %w", signal.BlockNumber, err)
+		}
+	}
+
 	return nil
 }
 
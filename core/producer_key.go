@@ -0,0 +1,88 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// ProducerKey returns the key signing the blocks of the store, available once initialized.
+func (store *Store) ProducerKey() ed25519.PrivateKey {
+	return store.producerKey
+}
+
+// loadProducerKey reads the producer key of the store, generating it for a store without
+// blocks. A store with blocks but no key was written by a version that didn't sign them, its
+// unsigned blocks would fail verification once a key is generated.
+func (store *Store) loadProducerKey() error {
+	data, err := store.files.ReadFile(store.producerKeyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if store.meta.HeadHeight > store.meta.GenesisHeight {
+			return fmt.Errorf("%w: it has blocks but no producer key %q", ErrOutdatedStore, store.producerKeyPath)
+		}
+
+		return store.generateProducerKey()
+	}
+	if err != nil {
+		return fmt.Errorf("read producer key: %w", err)
+	}
+
+	key, err := parseProducerKey(data)
+	if err != nil {
+		return fmt.Errorf("producer key %q: %w", store.producerKeyPath, err)
+	}
+	store.producerKey = key
+
+	return nil
+}
+
+func (store *Store) generateProducerKey() error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate producer key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("encode producer key: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := store.files.WriteFile(store.producerKeyPath, data, 0600); err != nil {
+		return fmt.Errorf("write producer key: %w", err)
+	}
+
+	store.logger.
+		WithField("path", store.producerKeyPath).
+		WithField("proposer", types.ProducerAddress(key.Public().(ed25519.PublicKey))).
+		Info("generated producer key")
+
+	store.producerKey = key
+	return nil
+}
+
+// parseProducerKey parses a PEM encoded PKCS #8 Ed25519 private key.
+func parseProducerKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("expected a PEM encoded 'PRIVATE KEY'")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an Ed25519 key, got %T", parsed)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,511 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dummy-blockchain/clock"
+)
+
+// RetentionPolicy selects which block groups the store purges.
+type RetentionPolicy string
+
+const (
+	// RetentionAll keeps every block.
+	RetentionAll RetentionPolicy = "all"
+
+	// RetentionGroups only keeps the groups of the genesis, final and head heights.
+	RetentionGroups RetentionPolicy = "groups"
+
+	// RetentionLastBlocks keeps the last Retention.Blocks heights.
+	RetentionLastBlocks RetentionPolicy = "last"
+
+	// RetentionAge keeps the blocks whose timestamp is within Retention.Age of the current time.
+	RetentionAge RetentionPolicy = "age"
+
+	// RetentionSinceHeight keeps the blocks from Retention.Height on.
+	RetentionSinceHeight RetentionPolicy = "since"
+)
+
+// ArchiveFormat selects how purged block groups are archived.
+type ArchiveFormat string
+
+const (
+	// ArchiveDir moves purged groups to the archive directory as is.
+	ArchiveDir ArchiveFormat = "dir"
+
+	// ArchiveTarGz writes purged groups to `<group>.tar.gz` files in the archive directory.
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+)
+
+// retentionCheckInterval is how often the age retention policy is re-evaluated when no
+// block group is started.
+const retentionCheckInterval = time.Minute
+
+// Retention configures the store purging. The groups holding the final and head blocks are
+// never purged whatever the policy, the node needs them to restart. The zero value keeps
+// every block.
+type Retention struct {
+	Policy RetentionPolicy
+	Blocks uint64
+	Age    time.Duration
+	Height uint64
+
+	// ArchiveDir receives the purged groups (in ArchiveFormat) instead of deleting them
+	ArchiveDir    string
+	ArchiveFormat ArchiveFormat
+}
+
+// ParseRetention parses a retention policy, either `all`, `groups`, `last=<blocks>`,
+// `age=<duration>` (e.g. `48h`) or `since=<height>`.
+func ParseRetention(in string) (Retention, error) {
+	name, value, hasValue := strings.Cut(in, "=")
+
+	retention := Retention{Policy: RetentionPolicy(name)}
+	switch retention.Policy {
+	case RetentionAll, RetentionGroups:
+		if hasValue {
+			return Retention{}, fmt.Errorf("retention policy %q takes no value", name)
+		}
+		return retention, nil
+
+	case RetentionLastBlocks:
+		blocks, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || blocks == 0 {
+			return Retention{}, fmt.Errorf("retention policy 'last' requires a block count greater than 0, got %q", value)
+		}
+		retention.Blocks = blocks
+
+	case RetentionAge:
+		age, err := time.ParseDuration(value)
+		if err != nil || age <= 0 {
+			return Retention{}, fmt.Errorf("retention policy 'age' requires a positive duration (e.g. 48h), got %q", value)
+		}
+		retention.Age = age
+
+	case RetentionSinceHeight:
+		height, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return Retention{}, fmt.Errorf("retention policy 'since' requires a height, got %q", value)
+		}
+		retention.Height = height
+
+	default:
+		return Retention{}, fmt.Errorf("unknown retention policy %q, valid values are all, groups, last=<blocks>, age=<duration> and since=<height>", in)
+	}
+
+	return retention, nil
+}
+
+// WithArchive returns the retention archiving purged groups to dir in format.
+func (r Retention) WithArchive(dir string, format ArchiveFormat) (Retention, error) {
+	switch format {
+	case ArchiveDir, ArchiveTarGz:
+	default:
+		return Retention{}, fmt.Errorf("unknown archive format %q, valid values are dir and tar.gz", format)
+	}
+
+	r.ArchiveDir = dir
+	r.ArchiveFormat = format
+	return r, nil
+}
+
+func (r Retention) purges() bool {
+	return r.Policy != "" && r.Policy != RetentionAll
+}
+
+// String implements fmt.Stringer.
+func (r Retention) String() string {
+	switch r.Policy {
+	case RetentionLastBlocks:
+		return fmt.Sprintf("last=%d", r.Blocks)
+	case RetentionAge:
+		return fmt.Sprintf("age=%s", r.Age)
+	case RetentionSinceHeight:
+		return fmt.Sprintf("since=%d", r.Height)
+	case "":
+		return string(RetentionAll)
+	}
+
+	return string(r.Policy)
+}
+
+// purgeHeights are the store heights a purge is evaluated against.
+type purgeHeights struct {
+	genesis uint64
+	final   uint64
+	head    uint64
+}
+
+// purger purges the store block groups in the background, out of the block writing path.
+type purger struct {
+	store     *Store
+	retention Retention
+
+	lock    sync.Mutex
+	pending *purgeHeights
+
+	// lastAgeCheck limits how often block timestamps are read by the age policy
+	lastAgeCheck time.Time
+
+	trigger chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newPurger(store *Store, retention Retention) *purger {
+	return &purger{
+		store:     store,
+		retention: retention,
+		trigger:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// schedule requests a purge against heights, replacing a pending request if any.
+func (p *purger) schedule(heights purgeHeights) {
+	p.lock.Lock()
+	p.pending = &heights
+	p.lock.Unlock()
+
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (p *purger) run() {
+	defer close(p.done)
+
+	var last *purgeHeights
+
+	// Blocks age even if none is written, the age policy checks them periodically once the
+	// first purge is requested. The ticker is only created then, a virtual clock not firing
+	// it before the block production is ticking.
+	var ticker clock.Ticker
+	var ticks <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	// A tick is released once handled, like the engine does
+	ticked := false
+	defer func() {
+		if ticked {
+			p.store.clock.Release()
+		}
+	}()
+
+	for {
+		if ticked {
+			p.store.clock.Release()
+			ticked = false
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-p.trigger:
+			p.lock.Lock()
+			last, p.pending = p.pending, nil
+			p.lock.Unlock()
+
+			if p.retention.Policy == RetentionAge {
+				if ticker == nil {
+					ticker = p.store.clock.NewTicker(retentionCheckInterval)
+					ticks = ticker.C()
+				}
+
+				if p.store.clock.Now().Sub(p.lastAgeCheck) < retentionCheckInterval {
+					continue
+				}
+			}
+		case <-ticks:
+			ticked = true
+		}
+
+		if last == nil {
+			continue
+		}
+
+		if p.retention.Policy == RetentionAge {
+			p.lastAgeCheck = p.store.clock.Now()
+		}
+
+		if err := p.purge(*last); err != nil {
+			p.store.logger.WithError(err).Warn("failed to purge old block groups")
+		}
+	}
+}
+
+// close waits for the purge in progress, if any, and stops the purger.
+func (p *purger) close() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *purger) purge(heights purgeHeights) error {
+	groups, err := p.store.listGroups()
+	if err != nil {
+		return err
+	}
+
+	keep := map[uint64]bool{
+		p.store.blockGroup(heights.final): true,
+		p.store.blockGroup(heights.head):  true,
+	}
+	if p.retention.Policy == RetentionGroups {
+		keep[p.store.blockGroup(heights.genesis)] = true
+	}
+
+	purged := false
+	defer func() {
+		// Heights below the lowest group left are not available anymore
+		if !purged {
+			return
+		}
+
+		if err := p.store.updateLowestHeight(); err != nil {
+			p.store.logger.WithError(err).Warn("failed to update the lowest stored height")
+		}
+	}()
+
+	for _, group := range groups {
+		if keep[group] {
+			continue
+		}
+
+		// The groups above the head one only hold flash blocks of the upcoming height
+		if group > p.store.blockGroup(heights.head) {
+			break
+		}
+
+		purge, err := p.expired(group, heights)
+		if err != nil {
+			return err
+		}
+
+		if !purge {
+			// Groups are sorted, the following ones are not expired either
+			break
+		}
+
+		if err := p.purgeGroup(group); err != nil {
+			return err
+		}
+		purged = true
+	}
+
+	return nil
+}
+
+// expired returns whether all the heights of group are out of the retention.
+func (p *purger) expired(group uint64, heights purgeHeights) (bool, error) {
+	lastHeight := group + filesPerDir - 1
+
+	switch p.retention.Policy {
+	case RetentionGroups:
+		return true, nil
+
+	case RetentionLastBlocks:
+		return heights.head >= p.retention.Blocks && lastHeight <= heights.head-p.retention.Blocks, nil
+
+	case RetentionSinceHeight:
+		return lastHeight < p.retention.Height, nil
+
+	case RetentionAge:
+		heights, err := p.store.groupHeights(group)
+		if err != nil || len(heights) == 0 {
+			return false, err
+		}
+
+		block, err := p.store.ReadBlock(heights[len(heights)-1])
+		if err != nil {
+			return false, err
+		}
+
+		return p.store.clock.Now().Sub(block.Header.Timestamp) > p.retention.Age, nil
+	}
+
+	return false, nil
+}
+
+func (p *purger) purgeGroup(group uint64) error {
+	groupDir := p.store.groupDir(group)
+
+	if p.retention.ArchiveDir == "" {
+		p.store.logger.WithField("dir", groupDir).Debug("purging old block group")
+		if err := p.store.files.RemoveAll(groupDir); err != nil {
+			return fmt.Errorf("remove group dir %s: %w", groupDir, err)
+		}
+
+		return nil
+	}
+
+	if err := os.MkdirAll(p.retention.ArchiveDir, 0700); err != nil {
+		return fmt.Errorf("create archive dir: %w", err)
+	}
+
+	name := filepath.Base(groupDir)
+	p.store.logger.WithField("dir", groupDir).WithField("archive_dir", p.retention.ArchiveDir).WithField("format", p.retention.ArchiveFormat).Debug("archiving old block group")
+
+	switch p.retention.ArchiveFormat {
+	case ArchiveTarGz:
+		filename := filepath.Join(p.retention.ArchiveDir, name+".tar.gz")
+		if err := writeTarGz(filename+".tmp", groupDir); err != nil {
+			os.Remove(filename + ".tmp")
+			return fmt.Errorf("archive group dir %s: %w", groupDir, err)
+		}
+
+		if err := os.Rename(filename+".tmp", filename); err != nil {
+			return err
+		}
+
+	default:
+		if err := moveDir(groupDir, filepath.Join(p.retention.ArchiveDir, name)); err != nil {
+			return fmt.Errorf("archive group dir %s: %w", groupDir, err)
+		}
+	}
+
+	return os.RemoveAll(groupDir)
+}
+
+// listGroups returns the block groups present in the store, sorted.
+func (store *Store) listGroups() ([]uint64, error) {
+	entries, err := store.files.ReadDir(store.blocksDir)
+	if err != nil {
+		return nil, fmt.Errorf("read blocks dir: %w", err)
+	}
+
+	var groups []uint64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		group, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		groups = append(groups, group)
+	}
+	slices.Sort(groups)
+
+	return groups, nil
+}
+
+func (store *Store) groupDir(group uint64) string {
+	return fmt.Sprintf("%s/%010d", store.blocksDir, group)
+}
+
+// groupHeights returns the heights of the blocks stored in group, sorted.
+func (store *Store) groupHeights(group uint64) ([]uint64, error) {
+	entries, err := store.files.ReadDir(store.groupDir(group))
+	if err != nil {
+		return nil, err
+	}
+
+	heights := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		height, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, height)
+	}
+	slices.Sort(heights)
+
+	return heights, nil
+}
+
+// writeTarGz writes the files of dir to a gzipped tar file, named relatively to dir.
+func writeTarGz(filename string, dir string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	compressed := gzip.NewWriter(file)
+	archive := tar.NewWriter(compressed)
+
+	if err := archive.AddFS(os.DirFS(dir)); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// moveDir moves src to dst, copying its tree when they are on different devices.
+func moveDir(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	return copyDir(src, dst)
+}
+
+// copyDir copies the files of src to dst, recursing into its sub-directories.
+func copyDir(src string, dst string) error {
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		copyEntry := copyFile
+		if entry.IsDir() {
+			copyEntry = copyDir
+		}
+
+		if err := copyEntry(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
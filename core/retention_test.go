@@ -0,0 +1,158 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// groupFiles are the files of a block group, by path relative to the group dir.
+var groupFiles = map[string]string{
+	"0000000001.json":       "block 1",
+	"0000000002.json":       "block 2",
+	"flash/1.1.json":        "flash block 1.1",
+	"flash/1.1001.json":     "flash block 1.1001",
+	"flash/nested/any.json": "nested",
+}
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = string(content)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func readTarGz(t *testing.T, filename string) map[string]string {
+	t.Helper()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+}
+
+// TestCopyDir covers the copy moveDir falls back to when the archive dir is on another
+// device than the store.
+func TestCopyDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "0000000000")
+	writeTree(t, src, groupFiles)
+
+	dst := filepath.Join(t.TempDir(), "archive", "0000000000")
+	if err := copyDir(src, dst); err != nil {
+		t.Fatalf("copy dir: %s", err)
+	}
+
+	if copied := readTree(t, dst); !maps.Equal(copied, groupFiles) {
+		t.Errorf("copied %v, expected %v", copied, groupFiles)
+	}
+}
+
+func TestPurgeGroup_Archive(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveDir, ArchiveTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			archiveDir := t.TempDir()
+			retention, err := Retention{Policy: RetentionGroups}.WithArchive(archiveDir, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store := NewStore(t.TempDir(), &types.Genesis{Hash: types.MakeHash(0), Time: time.Now()}, retention)
+			store.SetLogger(testLogger())
+
+			groupDir := store.groupDir(0)
+			writeTree(t, groupDir, groupFiles)
+
+			if err := newPurger(store, retention).purgeGroup(0); err != nil {
+				t.Fatalf("purge group: %s", err)
+			}
+
+			if _, err := os.Stat(groupDir); !os.IsNotExist(err) {
+				t.Errorf("group dir still exists after its purge: %v", err)
+			}
+
+			var archived map[string]string
+			switch format {
+			case ArchiveDir:
+				archived = readTree(t, filepath.Join(archiveDir, "0000000000"))
+			case ArchiveTarGz:
+				archived = readTarGz(t, filepath.Join(archiveDir, "0000000000.tar.gz"))
+			}
+
+			if !maps.Equal(archived, groupFiles) {
+				t.Errorf("archived %v, expected %v", archived, groupFiles)
+			}
+		})
+	}
+}
@@ -1,7 +1,15 @@
 package core
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -21,6 +29,35 @@ const (
 		<li><code>/status</code> - Chain status</li>
 		<li><code>/block</code> - Current block</li>
 		<li><code>/blocks/:height</code> - Get block by height</li>
+		<li><code>/blocks?from=&to=&limit=</code> - List blocks of a height range</li>
+		<li><code>/blocks/:height/flash</code> - List flash blocks of a height</li>
+		<li><code>/blocks/:height/flash/:index</code> - Get flash block of a height by index</li>
+		<li><code>/signals?from=&limit=</code> - List signals of the blocks from a height on</li>
+	</ul>
+</div>
+	`
+
+	multiChainHomePage = `
+<link rel="stylesheet" href="https://stackpath.bootstrapcdn.com/bootstrap/3.4.1/css/bootstrap.min.css" integrity="sha384-HSMxcRTRxnN+Bdg0JdbxYKrThecOKuH5zCYotlSAcp1+c8xmyTe9GYg1l9a69psu" crossorigin="anonymous">
+<div class="container">
+	<h1>Dummy Blockchain</h1>
+	<p>You're looking at the Dummy block chain server implementation, running multiple chains!</p>
+	<hr/>
+	<h2>Chains</h3>
+	<ul>
+%s
+	</ul>
+	<h2>Routes</h3>
+	<ul>
+		<li><code>/</code> - View current page</li>
+		<li><code>/chains</code> - Status of every chain</li>
+		<li><code>/chains/:name/status</code> - Chain status</li>
+		<li><code>/chains/:name/block</code> - Current block</li>
+		<li><code>/chains/:name/blocks/:height</code> - Get block by height</li>
+		<li><code>/chains/:name/blocks?from=&to=&limit=</code> - List blocks of a height range</li>
+		<li><code>/chains/:name/blocks/:height/flash</code> - List flash blocks of a height</li>
+		<li><code>/chains/:name/blocks/:height/flash/:index</code> - Get flash block of a height by index</li>
+		<li><code>/chains/:name/signals?from=&limit=</code> - List signals of the blocks from a height on</li>
 	</ul>
 </div>
 	`
@@ -31,6 +68,10 @@ type Server struct {
 
 	store *Store
 	addr  string
+	http  *http.Server
+
+	// chains holds the store of each chain by name when serving multiple chains
+	chains map[string]*Store
 }
 
 func init() {
@@ -43,23 +84,63 @@ func NewServer(store *Store, addr string) Server {
 		store:  store,
 		addr:   addr,
 	}
+	server.http = &http.Server{Addr: addr, Handler: server.Engine}
 
 	server.GET("/", server.getHome)
-	server.GET("/status", server.getStatus)
-	server.GET("/block", server.getBlock)
-	server.GET("/blocks/:id", server.getBlock)
+	registerChainRoutes(server.Engine, store)
 
 	return server
 }
 
+// NewMultiChainServer creates a server exposing the routes of each chain (keyed by name)
+// under `/chains/<name>`.
+func NewMultiChainServer(chains map[string]*Store, addr string) Server {
+	server := Server{
+		Engine: gin.Default(),
+		addr:   addr,
+		chains: chains,
+	}
+	server.http = &http.Server{Addr: addr, Handler: server.Engine}
+
+	server.GET("/", server.getMultiChainHome)
+	server.GET("/chains", server.getChains)
+	for name, store := range chains {
+		registerChainRoutes(server.Group("/chains/"+name), store)
+	}
+
+	return server
+}
+
+func registerChainRoutes(router gin.IRouter, store *Store) {
+	routes := chainRoutes{store: store}
+
+	router.GET("/status", routes.getStatus)
+	router.GET("/block", routes.getBlock)
+	router.GET("/blocks", routes.getBlocks)
+	router.GET("/blocks/:id", routes.getBlock)
+	router.GET("/blocks/:id/txs/:index/proof", routes.getTransactionProof)
+	router.GET("/blocks/:id/flash", routes.getFlashBlocks)
+	router.GET("/blocks/:id/flash/:index", routes.getFlashBlock)
+	router.GET("/signals", routes.getSignals)
+}
+
+// Start serves the routes until Shutdown is called, it returns nil once shut down and the
+// error preventing the server to run otherwise (e.g. the address is already in use).
 func (s *Server) Start() error {
 	logrus.WithField("addr", s.addr).Info("starting server")
-	err := s.Run(s.addr)
-	if err != nil {
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		logrus.WithError(err).Error("cant start server")
+		return err
 	}
 
-	return err
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for the requests in progress to complete,
+// until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	logrus.WithField("addr", s.addr).Info("shutting down server")
+	return s.http.Shutdown(ctx)
 }
 
 func (s *Server) getHome(c *gin.Context) {
@@ -67,37 +148,332 @@ func (s *Server) getHome(c *gin.Context) {
 	c.String(200, homePage)
 }
 
-func (s *Server) getStatus(c *gin.Context) {
-	c.JSON(200, s.store.meta)
+func (s *Server) getMultiChainHome(c *gin.Context) {
+	var items strings.Builder
+	for _, name := range s.chainNames() {
+		fmt.Fprintf(&items, "\t\t<li><a href=\"/chains/%[1]s/block\"><code>%[1]s</code></a></li>\n", html.EscapeString(name))
+	}
+
+	c.Header("Content-Type", "text/html")
+	c.String(200, fmt.Sprintf(multiChainHomePage, items.String()))
+}
+
+func (s *Server) getChains(c *gin.Context) {
+	statuses := make(map[string]any, len(s.chains))
+	for name, store := range s.chains {
+		statuses[name] = store.Status()
+	}
+
+	c.JSON(200, statuses)
+}
+
+func (s *Server) chainNames() []string {
+	names := make([]string, 0, len(s.chains))
+	for name := range s.chains {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// chainRoutes serves the routes of a single chain.
+type chainRoutes struct {
+	store *Store
+}
+
+func (s chainRoutes) getStatus(c *gin.Context) {
+	c.JSON(200, s.store.Status())
+}
+
+func (s chainRoutes) getBlock(c *gin.Context) {
+	block, ok := s.readBlock(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, block)
+}
+
+// transactionProof is the response of the transaction proof endpoint, the proof is checked
+// with types.VerifyTransactionProof against the header.
+type transactionProof struct {
+	Header      *types.BlockHeader      `json:"header"`
+	Transaction *types.Transaction      `json:"transaction"`
+	Proof       *types.TransactionProof `json:"proof"`
+}
+
+func (s chainRoutes) getTransactionProof(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		abortInvalidRequest(c, "invalid_index", fmt.Sprintf("invalid transaction index %q", c.Param("index")))
+		return
+	}
+
+	block, ok := s.readBlock(c)
+	if !ok {
+		return
+	}
+
+	proof, err := types.NewTransactionProof(block.Transactions, index)
+	if err != nil {
+		c.AbortWithStatusJSON(404, gin.H{"error": err.Error(), "reason": "transaction_not_found"})
+		return
+	}
+
+	c.JSON(200, transactionProof{
+		Header:      block.Header,
+		Transaction: &block.Transactions[index],
+		Proof:       proof,
+	})
+}
+
+func (s chainRoutes) getFlashBlocks(c *gin.Context) {
+	height, ok := blockHeightParam(c)
+	if !ok {
+		return
+	}
+
+	flashBlocks, err := s.store.ReadFlashBlocks(height)
+	if err != nil {
+		s.abortWithBlockError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"flash_blocks": flashBlocks})
+}
+
+func (s chainRoutes) getFlashBlock(c *gin.Context) {
+	index, err := strconv.ParseInt(c.Param("index"), 10, 32)
+	if err != nil {
+		abortInvalidRequest(c, "invalid_index", fmt.Sprintf("invalid flash block index %q", c.Param("index")))
+		return
+	}
+
+	height, ok := blockHeightParam(c)
+	if !ok {
+		return
+	}
+
+	flashBlock, err := s.store.ReadFlashBlock(height, int32(index))
+	if err != nil {
+		var unavailable *BlockUnavailableError
+		if !errors.As(err, &unavailable) && errors.Is(err, os.ErrNotExist) {
+			c.AbortWithStatusJSON(404, gin.H{"error": err.Error(), "reason": "flash_block_not_found"})
+			return
+		}
+
+		s.abortWithBlockError(c, err)
+		return
+	}
+
+	c.JSON(200, flashBlock)
+}
+
+// signalsPage is the response of the signals listing.
+type signalsPage struct {
+	Signals []*types.Signal `json:"signals"`
+
+	// Next is the `from` of the next page, unset when there are no more signals
+	Next *uint64 `json:"next,omitempty"`
 }
 
-func (s *Server) getBlock(c *gin.Context) {
+// getSignals lists the signals of the blocks from height from on (the lowest stored height by
+// default), pages end with all the signals of their last block.
+func (s chainRoutes) getSignals(c *gin.Context) {
+	query := struct {
+		From  *uint64 `form:"from"`
+		Limit int     `form:"limit"`
+	}{}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		abortInvalidRequest(c, "invalid_query", fmt.Sprintf("invalid query: %s", err))
+		return
+	}
+
+	limit := query.Limit
+	switch {
+	case limit == 0:
+		limit = defaultSignalsPageLimit
+	case limit < 0 || limit > maxSignalsPageLimit:
+		abortInvalidRequest(c, "invalid_query", fmt.Sprintf("limit must be between 1 and %d", maxSignalsPageLimit))
+		return
+	}
+
+	signals, next, err := s.store.ReadSignals(valueOr(query.From, s.store.LowestHeight()), limit)
+	if err != nil {
+		c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := signalsPage{Signals: signals, Next: next}
+	if page.Signals == nil {
+		page.Signals = []*types.Signal{}
+	}
+
+	c.JSON(200, page)
+}
+
+// blockHeightParam parses the `id` param, the request is aborted when it's not a height.
+func blockHeightParam(c *gin.Context) (uint64, bool) {
+	height, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		abortInvalidRequest(c, "invalid_id", fmt.Sprintf("invalid block id %q, expected a height", c.Param("id")))
+		return 0, false
+	}
+
+	return height, true
+}
+
+// readBlock reads the block of the `id` param, the head block without it, the request is
+// aborted when it can't be read.
+func (s chainRoutes) readBlock(c *gin.Context) (*types.Block, bool) {
 	var (
 		block *types.Block
 		err   error
 	)
 
-	if id := c.Param("id"); len(id) > 0 {
-		blockNum, err := strconv.Atoi(id)
-		if err != nil {
-			c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
-			return
+	if len(c.Param("id")) > 0 {
+		height, ok := blockHeightParam(c)
+		if !ok {
+			return nil, false
 		}
 
-		block, err = s.store.ReadBlock(uint64(blockNum))
+		block, err = s.store.ReadBlock(height)
 	} else {
 		block, err = s.store.CurrentBlock()
 	}
 
 	if err != nil {
-		c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+		s.abortWithBlockError(c, err)
+		return nil, false
+	}
+
+	return block, true
+}
+
+// blocksPage is the response of the blocks range listing.
+type blocksPage struct {
+	// From is the first height of the listed range, raised to the lowest stored height when
+	// the requested one was pruned
+	From   uint64         `json:"from"`
+	Blocks []*types.Block `json:"blocks"`
+
+	// Next is the `from` of the next page, unset when the range is complete
+	Next *uint64 `json:"next,omitempty"`
+}
+
+// getBlocks lists the blocks of the [from, to] range (to defaults to the head), skipped
+// heights are left out, at most limit blocks are returned per page. A range starting below
+// the lowest stored height starts at it instead, it's only unavailable when fully pruned.
+func (s chainRoutes) getBlocks(c *gin.Context) {
+	query := struct {
+		From  *uint64 `form:"from"`
+		To    *uint64 `form:"to"`
+		Limit int     `form:"limit"`
+	}{}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		abortInvalidRequest(c, "invalid_query", fmt.Sprintf("invalid query: %s", err))
 		return
 	}
 
-	if block == nil {
-		c.JSON(404, gin.H{"error": "block not found"})
+	status := s.store.Status()
+	head := max(status.HeadHeight, status.GenesisHeight)
+
+	from := valueOr(query.From, status.LowestHeight)
+	to := min(valueOr(query.To, head), head)
+
+	limit := query.Limit
+	switch {
+	case limit == 0:
+		limit = defaultBlocksPageLimit
+	case limit < 0 || limit > maxBlocksPageLimit:
+		abortInvalidRequest(c, "invalid_query", fmt.Sprintf("limit must be between 1 and %d", maxBlocksPageLimit))
 		return
 	}
 
-	c.JSON(200, block)
+	if from > to && query.To != nil {
+		abortInvalidRequest(c, "invalid_query", fmt.Sprintf("from %d is above to %d", from, *query.To))
+		return
+	}
+
+	if from > head {
+		s.abortWithBlockError(c, &BlockUnavailableError{Height: from, Reason: BlockNotProduced})
+		return
+	}
+
+	from = max(from, status.LowestHeight)
+	if from > to {
+		s.abortWithBlockError(c, &BlockUnavailableError{Height: to, Reason: BlockPruned})
+		return
+	}
+
+	page := blocksPage{From: from, Blocks: []*types.Block{}}
+	for height := from; height <= to; height++ {
+		if len(page.Blocks) == limit {
+			page.Next = &height
+			break
+		}
+
+		block, err := s.store.ReadBlock(height)
+		if err != nil {
+			var unavailable *BlockUnavailableError
+			if errors.As(err, &unavailable) && unavailable.Reason == BlockSkipped {
+				continue
+			}
+
+			s.abortWithBlockError(c, err)
+			return
+		}
+
+		page.Blocks = append(page.Blocks, block)
+	}
+
+	c.JSON(200, page)
+}
+
+const (
+	defaultBlocksPageLimit = 20
+	maxBlocksPageLimit     = 1000
+
+	defaultSignalsPageLimit = 100
+	maxSignalsPageLimit     = 10_000
+)
+
+// abortWithBlockError responds to a failed block read, 410 when the block was pruned, 404
+// when it doesn't exist (yet) and 500 when it was lost, doesn't match its header or on other
+// errors.
+func (s chainRoutes) abortWithBlockError(c *gin.Context, err error) {
+	if errors.Is(err, types.ErrInvalidBlock) {
+		c.AbortWithStatusJSON(500, gin.H{"error": err.Error(), "reason": "invalid_block"})
+		return
+	}
+
+	var unavailable *BlockUnavailableError
+	if !errors.As(err, &unavailable) {
+		c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := 404
+	switch unavailable.Reason {
+	case BlockPruned:
+		code = 410
+	case BlockMissing:
+		code = 500
+	}
+
+	status := s.store.Status()
+	c.AbortWithStatusJSON(code, gin.H{
+		"error":         unavailable.Error(),
+		"reason":        unavailable.Reason,
+		"height":        unavailable.Height,
+		"lowest_height": status.LowestHeight,
+		"head_height":   max(status.HeadHeight, status.GenesisHeight),
+	})
+}
+
+func abortInvalidRequest(c *gin.Context, reason string, message string) {
+	c.AbortWithStatusJSON(400, gin.H{"error": message, "reason": reason})
 }
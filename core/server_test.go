@@ -0,0 +1,61 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServer_BlocksBelowLowestHeight(t *testing.T) {
+	store, err := newTestStore(t, t.TempDir())
+	if err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+
+	for height := uint64(1); height <= 1010; height++ {
+		if err := store.WriteBlock(newTestBlock(height, store.ProducerKey())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := newPurger(store, Retention{Policy: RetentionGroups}).purgeGroup(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.updateLowestHeight(); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	registerChainRoutes(router, store)
+
+	get := func(path string) (int, []byte) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		return recorder.Code, recorder.Body.Bytes()
+	}
+
+	// A paging client starting at 0 gets the blocks still stored
+	code, body := get("/blocks?from=0&limit=5")
+	if code != 200 {
+		t.Fatalf("listing from 0 answered %d: %s", code, body)
+	}
+
+	page := blocksPage{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatal(err)
+	}
+
+	if page.From != 1000 || len(page.Blocks) != 5 || page.Blocks[0].Header.Height != 1000 || page.Next == nil || *page.Next != 1005 {
+		t.Errorf("listing from 0 returned from %d, %d blocks and next %v, expected from 1000, 5 blocks and next 1005", page.From, len(page.Blocks), page.Next)
+	}
+
+	// The range is unavailable when fully pruned, as a single pruned block
+	for _, path := range []string{"/blocks?from=0&to=999", "/blocks/5"} {
+		if code, body := get(path); code != 410 {
+			t.Errorf("%s answered %d, expected 410: %s", path, code, body)
+		}
+	}
+}
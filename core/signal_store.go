@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// Signals are appended, in the order they are sent, to the `signals.jsonl` file of the group
+// of their block, so that they're purged and archived along with the blocks they signal.
+const signalsFilename = "signals.jsonl"
+
+// WriteSignal appends signal to the signals of its block. The signals of a block whose group
+// was purged are not written.
+func (store *Store) WriteSignal(signal *types.Signal) error {
+	data, err := json.Marshal(signal)
+	if err != nil {
+		return fmt.Errorf("json encode signal: %w", err)
+	}
+
+	err = store.files.AppendFile(store.signalsFilename(store.blockGroup(signal.BlockNumber)), append(data, '\n'))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("write signal: %w", err)
+	}
+
+	return nil
+}
+
+// repairSignals drops the partial last line of the signals files, left by a node that
+// crashed while appending a signal, so that the following signals are not appended to it.
+func (store *Store) repairSignals() error {
+	groups, err := store.listGroups()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		filename := store.signalsFilename(group)
+
+		data, err := store.files.ReadFile(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(data) == 0 || data[len(data)-1] == '\n' {
+			continue
+		}
+
+		size := bytes.LastIndexByte(data, '\n') + 1
+		if err := store.files.Truncate(filename, int64(size)); err != nil {
+			return fmt.Errorf("repair signals of group %d: %w", group, err)
+		}
+
+		store.logger.
+			WithField("group", group).
+			WithField("dropped_bytes", len(data)-size).
+			Warn("dropped partially written signal")
+	}
+
+	return nil
+}
+
+// ReadSignals reads the signals of the blocks from height from on, sorted by block number,
+// the signals of a block in the order they were sent. At most limit signals are returned,
+// more when the signals of the last block don't fit, next is the from of the following
+// ones, nil when there are none.
+func (store *Store) ReadSignals(from uint64, limit int) (signals []*types.Signal, next *uint64, err error) {
+	groups, err := store.listGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, group := range groups {
+		if group+filesPerDir <= from {
+			continue
+		}
+
+		groupSignals, err := store.readGroupSignals(group, from)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, signal := range groupSignals {
+			if len(signals) >= limit && signal.BlockNumber != signals[len(signals)-1].BlockNumber {
+				return signals, &signal.BlockNumber, nil
+			}
+			signals = append(signals, signal)
+		}
+	}
+
+	return signals, nil, nil
+}
+
+// readGroupSignals reads the signals of group of the blocks from height from on, sorted by
+// block number. A line being written, not terminated yet, is left out.
+func (store *Store) readGroupSignals(group uint64, from uint64) ([]*types.Signal, error) {
+	data, err := store.files.ReadFile(store.signalsFilename(group))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(data, []byte{'\n'})
+
+	var signals []*types.Signal
+	for i, line := range lines[:len(lines)-1] {
+		signal := &types.Signal{}
+		if err := json.Unmarshal(line, signal); err != nil {
+			return nil, fmt.Errorf("signals of group %d, line %d: %w", group, i+1, err)
+		}
+
+		if signal.BlockNumber >= from {
+			signals = append(signals, signal)
+		}
+	}
+
+	slices.SortStableFunc(signals, func(a, b *types.Signal) int {
+		return cmp.Compare(a.BlockNumber, b.BlockNumber)
+	})
+
+	return signals, nil
+}
+
+func (store *Store) signalsFilename(group uint64) string {
+	return filepath.Join(store.groupDir(group), signalsFilename)
+}
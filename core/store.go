@@ -1,61 +1,190 @@
 package core
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/clock"
 	"github.com/streamingfast/dummy-blockchain/types"
 )
 
 const (
 	filesPerDir = 1000
+
+	// maxRecentSkippedHeights is the amount of skipped heights listed in the store meta
+	maxRecentSkippedHeights = 20
 )
 
 type StoreMeta struct {
-	GenesisHash      string `json:"genesis_hash"`
-	GenesisHeight    uint64 `json:"genesis_height"`
-	GenesisTimeNanos int64  `json:"genesis_time_nanos"`
-	FinalHeight      uint64 `json:"final_height"`
-	HeadHeight       uint64 `json:"head_height"`
+	GenesisHash      string              `json:"genesis_hash"`
+	GenesisHeight    uint64              `json:"genesis_height"`
+	GenesisTimeNanos int64               `json:"genesis_time_nanos"`
+	GenesisAlloc     map[string]*big.Int `json:"genesis_alloc,omitempty"`
+	GenesisUpgrades  []types.Upgrade     `json:"genesis_upgrades,omitempty"`
+	TimestampMode    TimestampMode       `json:"timestamp_mode,omitempty"`
+	FinalHeight      uint64              `json:"final_height"`
+	HeadHeight       uint64              `json:"head_height"`
+
+	// SkippedSlots is the amount of heights skipped since genesis, RecentSkippedHeights the
+	// last ones, lowest first.
+	SkippedSlots         uint64   `json:"skipped_slots"`
+	RecentSkippedHeights []uint64 `json:"recent_skipped_heights,omitempty"`
+}
+
+// StoreStatus is the store meta along with the state of the stored blocks.
+type StoreStatus struct {
+	StoreMeta
+
+	// LowestHeight is the lowest height of the lowest block group still stored, heights below
+	// it were pruned (see Retention).
+	LowestHeight uint64 `json:"lowest_height"`
+
+	// ProducerKey is the public key signing the blocks, Proposer its address.
+	ProducerKey []byte `json:"producer_key,omitempty"`
+	Proposer    string `json:"proposer,omitempty"`
+}
+
+// ErrOutdatedStore is returned when initializing a store written by a version producing
+// blocks the current one doesn't accept, it has to be reset.
+var ErrOutdatedStore = errors.New("store written by an outdated version, run `dummy-blockchain reset` to produce the chain again")
+
+// BlockUnavailableReason tells why a block cannot be read.
+type BlockUnavailableReason string
+
+const (
+	BlockPruned       BlockUnavailableReason = "pruned"
+	BlockNotProduced  BlockUnavailableReason = "not_produced"
+	BlockSkipped      BlockUnavailableReason = "skipped"
+	BlockBelowGenesis BlockUnavailableReason = "below_genesis"
+
+	// BlockMissing is a height that should have a block but whose file is gone, unlike
+	// BlockSkipped and BlockPruned it means data was lost.
+	BlockMissing BlockUnavailableReason = "missing"
+)
+
+// BlockUnavailableError is returned when reading a block that isn't stored, it matches
+// os.ErrNotExist.
+type BlockUnavailableError struct {
+	Height uint64
+	Reason BlockUnavailableReason
+}
+
+func (e *BlockUnavailableError) Error() string {
+	switch e.Reason {
+	case BlockPruned:
+		return fmt.Sprintf("block #%d was pruned", e.Height)
+	case BlockNotProduced:
+		return fmt.Sprintf("block #%d is not produced yet", e.Height)
+	case BlockSkipped:
+		return fmt.Sprintf("slot #%d skipped, no block was produced at this height", e.Height)
+	case BlockBelowGenesis:
+		return fmt.Sprintf("block #%d is below the genesis height", e.Height)
+	case BlockMissing:
+		return fmt.Sprintf("block #%d is missing from the store", e.Height)
+	}
+
+	return fmt.Sprintf("block #%d is unavailable", e.Height)
+}
+
+func (e *BlockUnavailableError) Is(target error) bool {
+	return target == os.ErrNotExist
 }
 
 type Store struct {
-	rootDir      string
-	blocksDir    string
-	metaPath     string
-	currentGroup int
-	purge        bool
+	rootDir           string
+	blocksDir         string
+	metaPath          string
+	producerKeyPath   string
+	engineStatePath   string
+	pendingBlocksPath string
+	currentGroup      int
+	retention         Retention
+	purger            *purger
+	producerKey       ed25519.PrivateKey
+	files             storeFiles
+	clock             clock.Clock
+	logger            logrus.FieldLogger
+
+	// lock guards the meta heights and lowestHeight, updated while being served
+	lock         sync.RWMutex
+	meta         StoreMeta
+	lowestHeight uint64
+}
 
-	meta StoreMeta
+// NewStore creates the store rooted at rootDir, genesis is only used when the store is
+// initialized for the first time, the one persisted in the store meta wins afterwards, as
+// the producer key generated along. Block groups out of retention are purged in the
+// background as blocks are written.
+func NewStore(rootDir string, genesis *types.Genesis, retention Retention) *Store {
+	return newStore(rootDir, osFiles{}, genesis, retention)
 }
 
-func NewStore(rootDir string, genesisHash string, genesisHeight uint64, genesisTime time.Time, purge bool) *Store {
+// NewMemoryStore creates a store keeping its files in memory, like NewStore otherwise. Its
+// blocks are lost when the process stops, purged groups can't be archived.
+func NewMemoryStore(genesis *types.Genesis, retention Retention) *Store {
+	return newStore("", newMemoryFiles(), genesis, retention)
+}
+
+func newStore(rootDir string, files storeFiles, genesis *types.Genesis, retention Retention) *Store {
 	return &Store{
-		rootDir:      rootDir,
-		blocksDir:    filepath.Join(rootDir, "blocks"),
-		metaPath:     filepath.Join(rootDir, "meta.json"),
-		currentGroup: -1,
-		purge:        purge,
+		rootDir:           rootDir,
+		blocksDir:         filepath.Join(rootDir, "blocks"),
+		metaPath:          filepath.Join(rootDir, "meta.json"),
+		producerKeyPath:   filepath.Join(rootDir, "producer.key"),
+		engineStatePath:   filepath.Join(rootDir, "engine.json"),
+		pendingBlocksPath: filepath.Join(rootDir, "pending-blocks.json"),
+		currentGroup:      -1,
+		retention:         retention,
+		files:             files,
+		clock:             clock.Real,
+		logger:            logrus.StandardLogger(),
 
 		meta: StoreMeta{
-			GenesisHash:      genesisHash,
-			GenesisHeight:    genesisHeight,
-			GenesisTimeNanos: genesisTime.UnixNano(),
+			GenesisHash:      genesis.Hash,
+			GenesisHeight:    genesis.Height,
+			GenesisTimeNanos: genesis.Time.UnixNano(),
+			GenesisAlloc:     genesis.Alloc,
+			GenesisUpgrades:  genesis.Upgrades,
 		},
 	}
 }
 
+// SetClock sets the clock the age of the blocks is measured with, the system clock by
+// default. It must be called before initializing the store.
+func (store *Store) SetClock(clock clock.Clock) {
+	store.clock = clock
+}
+
+// SetLogger sets the logger of the store, the logrus standard logger by default.
+func (store *Store) SetLogger(logger logrus.FieldLogger) {
+	store.logger = logger
+}
+
+// Exists returns whether the store was already initialized in its directory.
+func (store *Store) Exists() bool {
+	return store.files.Exists(store.metaPath) == nil
+}
+
 func (store *Store) Initialize() error {
-	logrus.WithField("dir", store.rootDir).Debug("creating store root directory")
-	if err := os.MkdirAll(store.rootDir, 0700); err != nil {
+	if _, inMemory := store.files.(*memoryFiles); inMemory && store.retention.ArchiveDir != "" {
+		return fmt.Errorf("purged block groups of an in-memory store can't be archived")
+	}
+
+	store.logger.WithField("dir", store.rootDir).Debug("creating store root directory")
+	if err := store.files.MkdirAll(store.rootDir); err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(store.blocksDir, 0700); err != nil {
+	if err := store.files.MkdirAll(store.blocksDir); err != nil {
 		return err
 	}
 
@@ -63,138 +192,370 @@ func (store *Store) Initialize() error {
 		return err
 	}
 
-	logrus.WithField("dir", store.rootDir).
+	if err := store.checkSealed(); err != nil {
+		return err
+	}
+
+	if err := store.updateLowestHeight(); err != nil {
+		return err
+	}
+
+	if err := store.repairSignals(); err != nil {
+		return err
+	}
+
+	if err := store.loadProducerKey(); err != nil {
+		return err
+	}
+
+	store.logger.WithField("dir", store.rootDir).
 		WithField("genesis_hash", store.meta.GenesisHash).
 		WithField("genesis_height", store.meta.GenesisHeight).
 		WithField("genesis_time", time.Unix(0, store.meta.GenesisTimeNanos)).
 		WithField("final_height", store.meta.FinalHeight).
 		WithField("head_height", store.meta.HeadHeight).
+		WithField("retention", store.retention).
 		Info("stored initialized")
 
+	if store.retention.purges() && store.purger == nil {
+		store.purger = newPurger(store, store.retention)
+		go store.purger.run()
+	}
+
 	return nil
 }
 
-func (store *Store) WriteBlock(block *types.Block) error {
-	store.meta.HeadHeight = block.Header.Height
-	store.meta.FinalHeight = block.Header.FinalNum
+// Close stops the background purging, waiting for the purge in progress if any.
+func (store *Store) Close() {
+	if store.purger != nil {
+		store.purger.close()
+		store.purger = nil
+	}
+}
 
+// WriteBlock writes block and makes it the head. The head only moves once the block file is
+// written, so that a concurrent ReadBlock of the head always finds it.
+func (store *Store) WriteBlock(block *types.Block) error {
 	group := int(store.blockGroup(block.Header.Height))
 	if group != store.currentGroup {
-		groupDir := fmt.Sprintf("%s/%010d", store.blocksDir, group)
-		if err := os.MkdirAll(groupDir, 0700); err != nil {
+		if err := store.createGroupDir(block.Header.Height); err != nil {
 			return err
 		}
 		store.currentGroup = group
 	}
 
-	file, err := os.Create(store.blockFilename(block.Header.Height))
-	if err != nil {
-		return fmt.Errorf("open file: %w", err)
+	if err := store.writeBlockFile(block); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(block); err != nil {
-		return fmt.Errorf("json encode block: %w", err)
+	store.lock.Lock()
+	store.meta.HeadHeight = block.Header.Height
+	store.meta.FinalHeight = block.Header.FinalNum
+	store.lock.Unlock()
+
+	if err := store.writeMeta(); err != nil {
+		return err
 	}
 
-	meta, err := json.MarshalIndent(store.meta, "", "  ")
-	if err != nil {
+	if store.purger != nil {
+		store.purger.schedule(purgeHeights{
+			genesis: store.meta.GenesisHeight,
+			final:   store.meta.FinalHeight,
+			head:    store.meta.HeadHeight,
+		})
+	}
+
+	return nil
+}
+
+// WriteHistoricalBlock writes the block file and skipped heights only, leaving the head and final heights
+// untouched until SetHead is called. It's safe for concurrent use.
+func (store *Store) WriteHistoricalBlock(block *types.Block) error {
+	if err := store.createGroupDir(block.Header.Height); err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(store.metaPath, meta, 0655); err != nil {
+	return store.writeBlockFile(block)
+}
+
+// SetHead sets the head and final heights once historical blocks have been written.
+func (store *Store) SetHead(headHeight uint64, finalHeight uint64) error {
+	store.lock.Lock()
+	store.meta.HeadHeight = headHeight
+	store.meta.FinalHeight = finalHeight
+	store.lock.Unlock()
+
+	return store.writeMeta()
+}
+
+// SetTimestampMode records the timestamp mode of the blocks written from now on, blocks
+// already written keep their timestamps.
+func (store *Store) SetTimestampMode(mode TimestampMode) error {
+	if previous := store.meta.TimestampMode; previous != "" && previous != mode {
+		store.logger.
+			WithField("previous_mode", previous).
+			WithField("mode", mode).
+			Warn("timestamp mode changed, stored blocks keep the timestamps of the previous mode")
+	}
+
+	store.lock.Lock()
+	store.meta.TimestampMode = mode
+	store.lock.Unlock()
+
+	return store.writeMeta()
+}
+
+// Genesis returns the genesis persisted in the store meta.
+func (store *Store) Genesis() *types.Genesis {
+	return &types.Genesis{
+		Height:   store.meta.GenesisHeight,
+		Hash:     store.meta.GenesisHash,
+		Time:     time.Unix(0, store.meta.GenesisTimeNanos),
+		Alloc:    store.meta.GenesisAlloc,
+		Upgrades: store.meta.GenesisUpgrades,
+	}
+}
+
+// HeadHeight returns the height of the last block written, the genesis height if none.
+func (store *Store) HeadHeight() uint64 {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	return max(store.meta.HeadHeight, store.meta.GenesisHeight)
+}
+
+// Status returns the store meta and the lowest stored height, it's safe to call while
+// blocks are written.
+func (store *Store) Status() StoreStatus {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	status := StoreStatus{StoreMeta: store.meta, LowestHeight: store.lowestHeight}
+	status.RecentSkippedHeights = slices.Clone(store.meta.RecentSkippedHeights)
+	if store.producerKey != nil {
+		status.ProducerKey = store.producerKey.Public().(ed25519.PublicKey)
+		status.Proposer = types.ProducerAddress(status.ProducerKey)
+	}
+
+	return status
+}
+
+// LowestHeight returns the lowest height of the lowest block group still stored.
+func (store *Store) LowestHeight() uint64 {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	return store.lowestHeight
+}
+
+func (store *Store) createGroupDir(height uint64) error {
+	return store.files.MkdirAll(store.groupDir(store.blockGroup(height)))
+}
+
+func (store *Store) writeBlockFile(block *types.Block) error {
+	if err := store.writeSkippedHeights(block.Header); err != nil {
 		return err
 	}
 
-	if store.purge {
-		if err := store.purgeOldGroups(); err != nil {
-			logrus.WithError(err).Warn("failed to purge old block groups")
+	data, err := json.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("json encode block: %w", err)
+	}
+
+	return store.files.WriteFile(store.blockFilename(block.Header.Height), append(data, '\n'), 0644)
+}
+
+// writeSkippedHeights marks the heights skipped before header, a fork block at the same
+// height as the canonical one marks (and counts) them once. The block of a fork sequence
+// written at a skipped height is removed, it's not part of the chain.
+func (store *Store) writeSkippedHeights(header *types.BlockHeader) error {
+	for height := header.Height - header.SkippedSlots; height < header.Height; height++ {
+		if err := store.createGroupDir(height); err != nil {
+			return err
 		}
+
+		err := store.files.CreateFile(store.skippedFilename(height))
+		if err == nil || errors.Is(err, os.ErrExist) {
+			if err := store.files.RemoveAll(store.blockFilename(height)); err != nil {
+				return fmt.Errorf("remove orphaned block at skipped height %d: %w", height, err)
+			}
+		}
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("mark skipped height %d: %w", height, err)
+		}
+
+		store.lock.Lock()
+		store.meta.SkippedSlots++
+		store.meta.RecentSkippedHeights = append(store.meta.RecentSkippedHeights, height)
+		slices.Sort(store.meta.RecentSkippedHeights)
+		if extra := len(store.meta.RecentSkippedHeights) - maxRecentSkippedHeights; extra > 0 {
+			store.meta.RecentSkippedHeights = slices.Delete(store.meta.RecentSkippedHeights, 0, extra)
+		}
+		store.lock.Unlock()
 	}
 
 	return nil
 }
 
+func (store *Store) writeMeta() error {
+	store.lock.RLock()
+	meta, err := json.MarshalIndent(store.meta, "", "  ")
+	store.lock.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return store.files.WriteFile(store.metaPath, meta, 0655)
+}
+
 func (store *Store) CurrentBlock() (*types.Block, error) {
-	return store.ReadBlock(store.meta.HeadHeight)
+	return store.ReadBlock(store.HeadHeight())
 }
 
+// ReadBlock reads the block at height, a *BlockUnavailableError is returned when there is
+// none. The block is verified against its header (see types.Block.Verify) and signed blocks
+// must be signed by the store producer key, an error matching types.ErrInvalidBlock is
+// returned otherwise.
 func (store *Store) ReadBlock(height uint64) (*types.Block, error) {
 	if height == store.meta.GenesisHeight {
-		return types.GenesisBlock(store.meta.GenesisHash, store.meta.GenesisHeight, time.Unix(0, store.meta.GenesisTimeNanos)), nil
+		return types.GenesisBlock(store.Genesis()), nil
+	}
+
+	if height < store.meta.GenesisHeight {
+		return nil, &BlockUnavailableError{Height: height, Reason: BlockBelowGenesis}
+	}
+
+	if height > store.HeadHeight() {
+		return nil, &BlockUnavailableError{Height: height, Reason: BlockNotProduced}
+	}
+
+	// The canonical chain skipped the height, a fork block written there before is orphaned
+	if err := store.files.Exists(store.skippedFilename(height)); err == nil {
+		return nil, &BlockUnavailableError{Height: height, Reason: BlockSkipped}
 	}
 
 	block := &types.Block{}
 
-	data, err := os.ReadFile(store.blockFilename(height))
+	data, err := store.files.ReadFile(store.blockFilename(height))
 	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		// Purging removes whole groups, a missing block in a present group was lost
+		if err := store.files.Exists(store.groupDir(store.blockGroup(height))); errors.Is(err, os.ErrNotExist) {
+			return nil, &BlockUnavailableError{Height: height, Reason: BlockPruned}
+		}
+
+		return nil, &BlockUnavailableError{Height: height, Reason: BlockMissing}
+	}
+
+	if err := json.Unmarshal(data, block); err != nil {
 		return nil, err
 	}
 
-	return block, json.Unmarshal(data, block)
-}
+	if err := store.verifyBlock(block); err != nil {
+		return nil, err
+	}
 
-func (store *Store) blockFilename(height uint64) string {
-	return fmt.Sprintf("%s/%010d/%d.json", store.blocksDir, store.blockGroup(height), height)
+	return block, nil
 }
 
-func (store *Store) blockGroup(height uint64) uint64 {
-	return height - (height % filesPerDir)
+// verifyBlock checks a read block against its header and the store producer key, a block
+// that isn't signed being invalid when the store has one.
+func (store *Store) verifyBlock(block *types.Block) error {
+	if err := block.Verify(); err != nil {
+		return err
+	}
+
+	if store.producerKey != nil {
+		return block.Header.VerifySignature(store.producerKey.Public().(ed25519.PublicKey))
+	}
+
+	return nil
 }
 
-func (store *Store) purgeOldGroups() error {
-	keepGroups := map[uint64]bool{
-		store.blockGroup(store.meta.GenesisHeight): true,
-		store.blockGroup(store.meta.FinalHeight):   true,
-		store.blockGroup(store.meta.HeadHeight):    true,
+// checkSealed checks that the head block is sealed, stores written before headers were sealed
+// hold blocks failing verification.
+func (store *Store) checkSealed() error {
+	height := store.meta.HeadHeight
+	if height <= store.meta.GenesisHeight {
+		return nil
 	}
 
-	entries, err := os.ReadDir(store.blocksDir)
+	data, err := store.files.ReadFile(store.blockFilename(height))
 	if err != nil {
-		return fmt.Errorf("read blocks dir: %w", err)
+		// Left to ReadBlock to report
+		return nil
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		var group uint64
-		if _, err := fmt.Sscanf(entry.Name(), "%d", &group); err != nil {
-			continue
-		}
-
-		if keepGroups[group] {
-			continue
-		}
+	block := &types.Block{}
+	if err := json.Unmarshal(data, block); err != nil || block.Header == nil {
+		return nil
+	}
 
-		groupDir := filepath.Join(store.blocksDir, entry.Name())
-		logrus.WithField("dir", groupDir).Debug("purging old block group")
-		if err := os.RemoveAll(groupDir); err != nil {
-			return fmt.Errorf("remove group dir %s: %w", groupDir, err)
-		}
+	if block.Header.TransactionsRoot == "" {
+		return fmt.Errorf("%w: head block #%d is not sealed", ErrOutdatedStore, height)
 	}
 
 	return nil
 }
 
-func (store *Store) readMeta() error {
-	_, err := os.Stat(store.metaPath)
+// updateLowestHeight finds the lowest height of the lowest stored group, the genesis height
+// when no group was purged yet.
+func (store *Store) updateLowestHeight() error {
+	groups, err := store.listGroups()
 	if err != nil {
-		logrus.WithField("path", store.metaPath).WithError(err).Debug("cant open meta file, creating")
+		return err
+	}
 
-		meta, err := json.MarshalIndent(store.meta, "", "  ")
+	lowest := store.meta.GenesisHeight
+	if len(groups) > 0 && groups[0] > store.blockGroup(store.meta.GenesisHeight) {
+		heights, err := store.groupHeights(groups[0])
 		if err != nil {
 			return err
 		}
 
-		if err := os.WriteFile(store.metaPath, meta, 0655); err != nil {
+		lowest = groups[0]
+		if len(heights) > 0 {
+			lowest = heights[0]
+		}
+	}
+
+	store.lock.Lock()
+	store.lowestHeight = lowest
+	store.lock.Unlock()
+
+	return nil
+}
+
+func (store *Store) blockFilename(height uint64) string {
+	return fmt.Sprintf("%s/%010d/%d.json", store.blocksDir, store.blockGroup(height), height)
+}
+
+// skippedFilename is the empty file marking a skipped height, next to the block files.
+func (store *Store) skippedFilename(height uint64) string {
+	return fmt.Sprintf("%s/%010d/%d.skipped", store.blocksDir, store.blockGroup(height), height)
+}
+
+func (store *Store) blockGroup(height uint64) uint64 {
+	return height - (height % filesPerDir)
+}
+
+func (store *Store) readMeta() error {
+	if err := store.files.Exists(store.metaPath); err != nil {
+		store.logger.WithField("path", store.metaPath).WithError(err).Debug("cant open meta file, creating")
+
+		if err := store.writeMeta(); err != nil {
 			return err
 		}
 	}
 
-	data, err := os.ReadFile(store.metaPath)
+	data, err := store.files.ReadFile(store.metaPath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storeFiles is where the store keeps its files, the file system or memory. Names are slash
+// separated, directories must be created before the files they hold.
+type storeFiles interface {
+	ReadFile(name string) ([]byte, error)
+
+	// WriteFile replaces the file atomically, it's never left half-written.
+	WriteFile(name string, data []byte, perm os.FileMode) error
+
+	// AppendFile appends data to the file with a single write, creating it if needed.
+	AppendFile(name string, data []byte) error
+
+	// Truncate cuts the file down to size bytes.
+	Truncate(name string, size int64) error
+
+	// CreateFile creates an empty file, failing with an error matching os.ErrExist if it
+	// already exists.
+	CreateFile(name string) error
+
+	// Exists returns nil if the file or directory exists, an error matching os.ErrNotExist
+	// otherwise.
+	Exists(name string) error
+
+	MkdirAll(name string) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	RemoveAll(name string) error
+}
+
+// osFiles keeps the store files in the file system.
+type osFiles struct{}
+
+func (osFiles) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFiles) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return writeFileAtomic(name, data, perm)
+}
+
+func (osFiles) AppendFile(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func (osFiles) Truncate(name string, size int64) error {
+	return os.Truncate(name, size)
+}
+
+func (osFiles) CreateFile(name string) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func (osFiles) Exists(name string) error {
+	_, err := os.Stat(name)
+	return err
+}
+
+func (osFiles) MkdirAll(name string) error {
+	return os.MkdirAll(name, 0700)
+}
+
+func (osFiles) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFiles) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// writeFileAtomic writes data to a temporary file renamed to filename, so that filename is
+// never left half-written when the process is stopped.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	if err := os.WriteFile(filename+".tmp", data, perm); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+// memoryFiles keeps the store files in memory, they're lost when the process stops.
+type memoryFiles struct {
+	lock  sync.RWMutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func newMemoryFiles() *memoryFiles {
+	return &memoryFiles{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{".": true, "/": true},
+	}
+}
+
+func (m *memoryFiles) ReadFile(name string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	data, found := m.files[path.Clean(name)]
+	if !found {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return slices.Clone(data), nil
+}
+
+func (m *memoryFiles) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err := m.checkParent("write", name); err != nil {
+		return err
+	}
+
+	m.files[path.Clean(name)] = slices.Clone(data)
+	return nil
+}
+
+func (m *memoryFiles) AppendFile(name string, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err := m.checkParent("append", name); err != nil {
+		return err
+	}
+
+	name = path.Clean(name)
+	m.files[name] = append(m.files[name], data...)
+	return nil
+}
+
+func (m *memoryFiles) Truncate(name string, size int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	name = path.Clean(name)
+	data, found := m.files[name]
+	if !found {
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrNotExist}
+	}
+	if size < int64(len(data)) {
+		m.files[name] = data[:size:size]
+	}
+
+	return nil
+}
+
+func (m *memoryFiles) CreateFile(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err := m.checkParent("create", name); err != nil {
+		return err
+	}
+
+	name = path.Clean(name)
+	if _, found := m.files[name]; found {
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+	}
+
+	m.files[name] = nil
+	return nil
+}
+
+func (m *memoryFiles) Exists(name string) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	name = path.Clean(name)
+	if _, found := m.files[name]; found || m.dirs[name] {
+		return nil
+	}
+
+	return &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *memoryFiles) MkdirAll(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for dir := path.Clean(name); !m.dirs[dir]; dir = path.Dir(dir) {
+		if _, found := m.files[dir]; found {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+		}
+		m.dirs[dir] = true
+	}
+
+	return nil
+}
+
+// ReadDir returns the entries of the directory sorted by name, like os.ReadDir.
+func (m *memoryFiles) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	name = path.Clean(name)
+	if !m.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for file, data := range m.files {
+		if path.Dir(file) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memoryFileInfo{name: path.Base(file), size: int64(len(data))}))
+		}
+	}
+	for dir := range m.dirs {
+		if dir != name && path.Dir(dir) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memoryFileInfo{name: path.Base(dir), dir: true}))
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+func (m *memoryFiles) RemoveAll(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	name = path.Clean(name)
+	inside := func(file string) bool {
+		return file == name || strings.HasPrefix(file, name+"/")
+	}
+
+	for file := range m.files {
+		if inside(file) {
+			delete(m.files, file)
+		}
+	}
+	for dir := range m.dirs {
+		if inside(dir) {
+			delete(m.dirs, dir)
+		}
+	}
+
+	return nil
+}
+
+// checkParent returns an error matching os.ErrNotExist when the directory of name doesn't
+// exist, as the file system does.
+func (m *memoryFiles) checkParent(op string, name string) error {
+	if !m.dirs[path.Dir(path.Clean(name))] {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return nil
+}
+
+type memoryFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return i.size }
+func (i memoryFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memoryFileInfo) IsDir() bool        { return i.dir }
+func (i memoryFileInfo) Sys() any           { return nil }
+
+func (i memoryFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0700
+	}
+
+	return 0644
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// testLogger discards the logs of the tested stores and engines.
+func testLogger() logrus.FieldLogger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return logger
+}
+
+var testGenesis = &types.Genesis{Hash: types.MakeHash(0), Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+// newTestStore creates and initializes a store in dir, closed when the test ends.
+func newTestStore(t *testing.T, dir string) (*Store, error) {
+	t.Helper()
+
+	store := NewStore(dir, testGenesis, Retention{})
+	store.SetLogger(testLogger())
+	t.Cleanup(store.Close)
+
+	return store, store.Initialize()
+}
+
+func TestStore_OutdatedUnsealedStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := newTestStore(t, dir)
+	if err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+
+	// A block as stored before headers were sealed
+	block := &types.Block{Header: &types.BlockHeader{Height: 1, Hash: types.MakeHash(1), Timestamp: testGenesis.Time.Add(time.Second)}}
+	if err := store.WriteHistoricalBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetHead(1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestStore(t, dir); !errors.Is(err, ErrOutdatedStore) {
+		t.Fatalf("initializing an unsealed store returned %v, expected ErrOutdatedStore", err)
+	}
+}
+
+// newTestBlock returns a block at height on top of the genesis block, sealed by key.
+func newTestBlock(height uint64, key ed25519.PrivateKey) *types.Block {
+	genesis := types.GenesisBlock(testGenesis)
+	block := &types.Block{
+		Header: &types.BlockHeader{
+			Height:    height,
+			PrevNum:   &genesis.Header.Height,
+			PrevHash:  &genesis.Header.Hash,
+			FinalNum:  genesis.Header.Height,
+			FinalHash: genesis.Header.Hash,
+			Timestamp: testGenesis.Time.Add(time.Duration(height) * time.Second),
+			GasLimit:  minGasLimit,
+		},
+		Transactions: []types.Transaction{{Type: "transfer", Hash: types.MakeHash(height), Amount: big.NewInt(1), Fee: big.NewInt(1)}},
+	}
+	block.Seal(key)
+
+	return block
+}
+
+func TestStore_SignedBlocks(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := newTestStore(t, dir)
+	if err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+
+	key := store.ProducerKey()
+	if key == nil {
+		t.Fatal("no producer key generated")
+	}
+
+	block := newTestBlock(1, key)
+	if err := store.WriteBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	flashBlock := &types.FlashBlock{Block: newTestBlock(2, key), Index: 1}
+	if err := store.WriteFlashBlock(flashBlock); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key is persisted, a restarted store reads the blocks it signed
+	restarted, err := newTestStore(t, dir)
+	if err != nil {
+		t.Fatalf("initialize again: %s", err)
+	}
+
+	if !restarted.ProducerKey().Equal(key) {
+		t.Fatal("restarted store has another producer key")
+	}
+
+	read, err := restarted.ReadBlock(1)
+	if err != nil {
+		t.Fatalf("read block: %s", err)
+	}
+	if read.Header.Hash != block.Header.Hash {
+		t.Errorf("read block %s, expected %s", read.Header.Hash, block.Header.Hash)
+	}
+
+	if _, err := restarted.ReadFlashBlock(2, 1); err != nil {
+		t.Errorf("read flash block: %s", err)
+	}
+}
+
+func TestStore_RejectsInvalidBlocks(t *testing.T) {
+	store, err := newTestStore(t, t.TempDir())
+	if err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		block func() *types.Block
+	}{
+		{"unsigned", func() *types.Block { return newTestBlock(1, nil) }},
+		{"signed by another key", func() *types.Block { return newTestBlock(1, otherKey) }},
+		{"tampered transaction", func() *types.Block {
+			block := newTestBlock(1, store.ProducerKey())
+			block.Transactions[0].Amount = big.NewInt(1000)
+			return block
+		}},
+		{"tampered signature", func() *types.Block {
+			block := newTestBlock(1, store.ProducerKey())
+			block.Header.Signature[0] ^= 0xff
+			return block
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := store.WriteBlock(test.block()); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.ReadBlock(1); !errors.Is(err, types.ErrInvalidBlock) {
+				t.Errorf("read block returned %v, expected ErrInvalidBlock", err)
+			}
+
+			if err := store.WriteFlashBlock(&types.FlashBlock{Block: test.block(), Index: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.ReadFlashBlock(1, 1); !errors.Is(err, types.ErrInvalidBlock) {
+				t.Errorf("read flash block returned %v, expected ErrInvalidBlock", err)
+			}
+		})
+	}
+}
+
+func TestStore_OutdatedUnsignedStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := newTestStore(t, dir)
+	if err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+
+	// Blocks as stored before they were signed, by a store without producer key
+	if err := store.WriteBlock(newTestBlock(1, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "producer.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestStore(t, dir); !errors.Is(err, ErrOutdatedStore) {
+		t.Fatalf("initializing a store with unsigned blocks returned %v, expected ErrOutdatedStore", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "producer.key")); !os.IsNotExist(err) {
+		t.Errorf("a producer key was generated for the outdated store: %v", err)
+	}
+}
+
+func TestStore_WriteBlockConcurrentReads(t *testing.T) {
+	store := NewMemoryStore(testGenesis, Retention{})
+	store.SetLogger(testLogger())
+	if err := store.Initialize(); err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+
+	blocks := make([]*types.Block, 2000)
+	for i := range blocks {
+		blocks[i] = newTestBlock(uint64(i+1), store.ProducerKey())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for _, block := range blocks {
+			if err := store.WriteBlock(block); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	// The head is only published once its block is written
+	for reads := 0; ; reads++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if _, err := store.CurrentBlock(); err != nil {
+			t.Fatalf("read head after %d reads: %s", reads, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// TimestampMode selects how block timestamps are computed.
+type TimestampMode string
+
+const (
+	// TimestampModeSlot derives timestamps from the persisted genesis time and the block
+	// interval in effect at each height, the same height always gets the same timestamp.
+	TimestampModeSlot TimestampMode = "slot"
+
+	// TimestampModeWallClock uses the time at which the block is produced.
+	TimestampModeWallClock TimestampMode = "wall-clock"
+
+	// TimestampModeReplay uses timestamps read from a file, heights not listed in it are
+	// placed relative to the closest listed height below (or above) like in slot mode.
+	TimestampModeReplay TimestampMode = "replay"
+)
+
+// ParseTimestampMode returns the mode named in.
+func ParseTimestampMode(in string) (TimestampMode, error) {
+	switch mode := TimestampMode(in); mode {
+	case TimestampModeSlot, TimestampModeWallClock, TimestampModeReplay:
+		return mode, nil
+	case "":
+		return TimestampModeSlot, nil
+	}
+
+	return "", fmt.Errorf("unknown timestamp mode %q, valid values are slot, wall-clock and replay", in)
+}
+
+// Timestamps computes the timestamps of the produced blocks, the zero value (or nil) uses
+// the slot mode without propagation time.
+type Timestamps struct {
+	mode     TimestampMode
+	replayed []replayedTimestamp
+
+	// withPropagationTime sets the header propagation time to the production wall-clock time
+	withPropagationTime bool
+}
+
+type replayedTimestamp struct {
+	height    uint64
+	timestamp time.Time
+}
+
+// NewTimestamps creates the timestamps computed with mode, replayFile being read in replay
+// mode. It holds one `<height> <timestamp>` line per replayed height, the timestamp being
+// either RFC3339 or Unix nanoseconds, empty lines and lines starting with `#` are ignored.
+func NewTimestamps(mode TimestampMode, replayFile string, withPropagationTime bool) (*Timestamps, error) {
+	timestamps := &Timestamps{mode: mode, withPropagationTime: withPropagationTime}
+
+	if mode != TimestampModeReplay {
+		if replayFile != "" {
+			return nil, fmt.Errorf("a timestamp replay file is only used in replay mode")
+		}
+
+		return timestamps, nil
+	}
+
+	if replayFile == "" {
+		return nil, fmt.Errorf("replay timestamp mode requires a replay file")
+	}
+
+	replayed, err := readReplayedTimestamps(replayFile)
+	if err != nil {
+		return nil, fmt.Errorf("read timestamp replay file %q: %w", replayFile, err)
+	}
+	timestamps.replayed = replayed
+
+	return timestamps, nil
+}
+
+// Mode returns the timestamp mode.
+func (t *Timestamps) Mode() TimestampMode {
+	if t == nil || t.mode == "" {
+		return TimestampModeSlot
+	}
+
+	return t.mode
+}
+
+// blockTime returns the timestamp of the block at height whose parent is at parentTime, now
+// being the time of the clock producing it.
+func (t *Timestamps) blockTime(schedule *types.Schedule, genesisTime time.Time, height uint64, parentTime time.Time, now time.Time) time.Time {
+	switch t.Mode() {
+	case TimestampModeWallClock:
+		// Never goes back in time, even if the clock does
+		if now.After(parentTime) {
+			return now
+		}
+		return parentTime
+
+	case TimestampModeReplay:
+		i, found := slices.BinarySearchFunc(t.replayed, height, func(replayed replayedTimestamp, height uint64) int {
+			return cmp.Compare(replayed.height, height)
+		})
+		if !found && i > 0 {
+			i--
+		}
+
+		closest := t.replayed[min(i, len(t.replayed)-1)]
+		if closest.height == height {
+			return closest.timestamp
+		}
+
+		return closest.timestamp.Add(schedule.Timestamp(genesisTime, height).Sub(schedule.Timestamp(genesisTime, closest.height)))
+	}
+
+	return schedule.Timestamp(genesisTime, height)
+}
+
+// propagationTime returns the propagation time of a block produced now, nil if it's not
+// tracked.
+func (t *Timestamps) propagationTime(now time.Time) *time.Time {
+	if t == nil || !t.withPropagationTime {
+		return nil
+	}
+
+	return ptr(now)
+}
+
+func readReplayedTimestamps(path string) ([]replayedTimestamp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var replayed []replayedTimestamp
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected '<height> <timestamp>', got %q", lineNum, line)
+		}
+
+		height, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid height: %w", lineNum, err)
+		}
+
+		timestamp, err := parseReplayedTimestamp(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		replayed = append(replayed, replayedTimestamp{height: height, timestamp: timestamp})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(replayed) == 0 {
+		return nil, fmt.Errorf("no timestamps found")
+	}
+
+	slices.SortStableFunc(replayed, func(a, b replayedTimestamp) int { return cmp.Compare(a.height, b.height) })
+	for i := 1; i < len(replayed); i++ {
+		if replayed[i].height == replayed[i-1].height {
+			return nil, fmt.Errorf("height %d is listed more than once", replayed[i].height)
+		}
+	}
+
+	return replayed, nil
+}
+
+func parseReplayedTimestamp(in string) (time.Time, error) {
+	if nanos, err := strconv.ParseInt(in, 10, 64); err == nil {
+		return time.Unix(0, nanos).UTC(), nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, in)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC3339 or Unix nanoseconds", in)
+	}
+
+	return timestamp, nil
+}
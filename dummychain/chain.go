@@ -0,0 +1,288 @@
+// Package dummychain runs a dummy chain in process, for Go programs and tests consuming
+// blocks, flash blocks and commitment signals without spawning the `dummy-blockchain`
+// binary.
+//
+// By default, the chain is kept in memory and its block production is paced by a virtual
+// clock: no block is produced until the program asks for one, e.g. with WaitForHeight, and
+// the chain goes through the same sequence of blocks, flash blocks and signals on every run
+// whatever the time their production takes:
+//
+//	chain := dummychain.NewT(t, dummychain.WithReorgs(), dummychain.WithSignals(nil))
+//	chain.WaitForHeight(ctx, 100)
+//	chain.ForceReorg(3)
+//	chain.WaitForHeight(ctx, 110)
+package dummychain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/clock"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// ErrStopped is returned when waiting on a chain that stopped producing blocks, because Stop
+// was called, the stop height was reached or the chain failed.
+var ErrStopped = errors.New("chain stopped")
+
+// idlePollInterval is how often a chain on a virtual clock is checked while its block
+// production isn't ticking yet, i.e. while it's starting
+const idlePollInterval = time.Millisecond
+
+// Chain is a dummy chain running in process.
+type Chain struct {
+	node  *core.Node
+	clock *clock.Virtual
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	stopOnce sync.Once
+
+	lock    sync.Mutex
+	head    *types.Block
+	updated chan struct{}
+}
+
+// New creates a chain and starts its block production, in memory and on a virtual clock
+// unless configured otherwise by opts.
+func New(opts ...Option) (*Chain, error) {
+	config := defaultConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	genesisTime := config.genesisTime
+	if genesisTime.IsZero() {
+		genesisTime = DefaultGenesisTime
+		if config.realClock {
+			genesisTime = time.Now()
+		}
+	}
+
+	genesis := types.NewGenesis(genesisTime)
+	genesis.Height = config.genesisHeight
+
+	logger := config.logger
+	if logger == nil {
+		discard := logrus.New()
+		discard.SetOutput(io.Discard)
+		logger = discard
+	}
+
+	chain := &Chain{
+		done:    make(chan struct{}),
+		updated: make(chan struct{}),
+	}
+
+	tracers := tracer.MultiTracer{&observer{chain: chain, config: config}}
+	if config.tracer != nil {
+		tracers = append(tracers, config.tracer)
+	}
+
+	config.node.Genesis = genesis
+	config.node.Tracer = tracers
+	chain.node = core.NewNode(config.node)
+	chain.node.SetLogger(logger)
+
+	if !config.realClock {
+		chain.clock = clock.NewVirtual(genesisTime)
+		chain.node.SetClock(chain.clock)
+	}
+
+	if err := chain.node.Initialize(); err != nil {
+		return nil, fmt.Errorf("initialize chain: %w", err)
+	}
+
+	// A chain resumed from its store dir starts from its stored head
+	if store := chain.node.Store(); store.HeadHeight() > store.Genesis().Height {
+		head, err := store.CurrentBlock()
+		if err != nil {
+			return nil, fmt.Errorf("read chain head: %w", err)
+		}
+		chain.head = head
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chain.cancel = cancel
+
+	go func() {
+		defer close(chain.done)
+		chain.err = chain.node.Start(ctx)
+	}()
+
+	return chain, nil
+}
+
+// NewT creates a chain like New, failing t if it can't, and stops it when t completes.
+func NewT(t testing.TB, opts ...Option) *Chain {
+	t.Helper()
+
+	chain, err := New(opts...)
+	if err != nil {
+		t.Fatalf("dummychain: %s", err)
+	}
+
+	t.Cleanup(func() {
+		if err := chain.Stop(); err != nil {
+			t.Errorf("dummychain: %s", err)
+		}
+	})
+
+	return chain
+}
+
+// Head returns the last block stored, nil until the genesis block is on a new chain.
+func (c *Chain) Head() *types.Block {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.head
+}
+
+// Store returns the store of the chain, to read its blocks, flash blocks and signals.
+func (c *Chain) Store() *core.Store {
+	return c.node.Store()
+}
+
+// Clock returns the virtual clock of the chain, nil when it runs on the real clock. Stepping
+// or advancing it produces blocks, WaitForHeight does it.
+func (c *Chain) Clock() *clock.Virtual {
+	return c.clock
+}
+
+// WaitForHeight waits for the chain head to reach height and returns it. On a virtual clock,
+// it steps the clock until then and returns the canonical block of height, or of the next
+// height produced when height is skipped. On the real clock, the returned block can be a
+// fork block, replaced right after by the canonical one.
+func (c *Chain) WaitForHeight(ctx context.Context, height uint64) (*types.Block, error) {
+	for {
+		c.lock.Lock()
+		head, updated := c.head, c.updated
+		c.lock.Unlock()
+
+		if head != nil && head.Header.Height >= height {
+			return head, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("waiting for height %d: %w", height, err)
+		}
+
+		select {
+		case <-c.done:
+			return nil, fmt.Errorf("waiting for height %d: %w", height, c.stoppedErr())
+		default:
+		}
+
+		if c.clock == nil {
+			select {
+			case <-updated:
+			case <-c.done:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		if !c.clock.Step() {
+			// The block production isn't ticking yet
+			select {
+			case <-time.After(idlePollInterval):
+			case <-c.done:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// ForceReorg makes the chain replace its next block with a fork sequence of depth blocks, see
+// core.Engine.ForceReorg.
+func (c *Chain) ForceReorg(depth int) {
+	c.node.ForceReorg(depth)
+}
+
+// Done is closed once the chain stopped producing blocks.
+func (c *Chain) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stop stops the chain and waits for it, returning the error that made it fail if any. It can
+// be called more than once.
+func (c *Chain) Stop() error {
+	c.stopOnce.Do(c.cancel)
+	<-c.done
+
+	return c.err
+}
+
+func (c *Chain) stoppedErr() error {
+	if c.err != nil {
+		return fmt.Errorf("%w: %w", ErrStopped, c.err)
+	}
+
+	return ErrStopped
+}
+
+func (c *Chain) setHead(block *types.Block) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.head = block
+	close(c.updated)
+	c.updated = make(chan struct{})
+}
+
+// observer tracks the chain head and calls the configured callbacks, as the first tracer of
+// the node.
+type observer struct {
+	chain  *Chain
+	config *config
+}
+
+var _ tracer.Tracer = (*observer)(nil)
+
+func (o *observer) Initialize(version string) error { return nil }
+
+func (o *observer) OnBlockStart(header *types.BlockHeader) error { return nil }
+
+func (o *observer) OnFlashBlockStart(header *types.BlockHeader) error { return nil }
+
+func (o *observer) OnCommitmentSignal(sig *types.Signal) error {
+	if o.config.onSignal != nil {
+		o.config.onSignal(sig)
+	}
+
+	return nil
+}
+
+func (o *observer) OnTrxStart(trx *types.Transaction) error { return nil }
+
+func (o *observer) OnTrxEvent(trxHash string, event *types.Event) error { return nil }
+
+func (o *observer) OnTrxEnd(trx *types.Transaction) error { return nil }
+
+func (o *observer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) error {
+	o.chain.setHead(blk)
+
+	if o.config.onBlock != nil {
+		o.config.onBlock(blk)
+	}
+
+	return nil
+}
+
+func (o *observer) OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, idx int32) error {
+	if o.config.onFlashBlock != nil {
+		o.config.onFlashBlock(&types.FlashBlock{Block: blk, Index: idx})
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package dummychain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/dummychain"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+
+	// Called from the goroutine producing the blocks, which WaitForHeight waits on
+	var blocks []*types.Block
+	chain := dummychain.NewT(t,
+		dummychain.WithSkippedBlocks(),
+		dummychain.WithSignals(nil),
+		dummychain.OnBlock(func(block *types.Block) { blocks = append(blocks, block) }),
+	)
+
+	head, err := chain.WaitForHeight(ctx, 1000)
+	if err != nil {
+		t.Fatalf("wait for height 1000: %s", err)
+	}
+
+	// 1000 is not a multiple of 13, it's produced
+	if head.Header.Height != 1000 {
+		t.Fatalf("head is #%d, expected #1000", head.Header.Height)
+	}
+
+	for i, block := range blocks[1:] {
+		if parent := blocks[i]; valueOr(block.Header.PrevHash) != parent.Header.Hash {
+			t.Fatalf("block #%d doesn't link to the previous block #%d", block.Header.Height, parent.Header.Height)
+		}
+		if block.Header.Height%13 == 0 {
+			t.Fatalf("block #%d should have been skipped", block.Header.Height)
+		}
+	}
+
+	produced := len(blocks)
+	chain.ForceReorg(3)
+
+	head, err = chain.WaitForHeight(ctx, 1010)
+	if err != nil {
+		t.Fatalf("wait for height 1010: %s", err)
+	}
+
+	// 1001 is a multiple of 13, the fork sequence is produced on top of block 1000 before the
+	// canonical block 1002 replacing it
+	forks := blocks[produced : produced+3]
+	for i, fork := range forks {
+		if fork.Header.Height != 1002+uint64(i) {
+			t.Fatalf("fork block %d is #%d, expected #%d", i, fork.Header.Height, 1002+i)
+		}
+	}
+
+	canonical := blocks[produced+3]
+	if canonical.Header.Height != 1002 || valueOr(canonical.Header.PrevHash) != blocks[produced-1].Header.Hash || canonical.Header.Hash == forks[0].Header.Hash {
+		t.Fatalf("block following the forks is #%d (%s), expected the canonical block #1002", canonical.Header.Height, canonical.Header.Hash)
+	}
+
+	stored, err := chain.Store().ReadBlock(1002)
+	if err != nil {
+		t.Fatalf("read block #1002: %s", err)
+	}
+	if stored.Header.Hash != canonical.Header.Hash {
+		t.Fatalf("stored block #1002 is %s, expected the canonical %s", stored.Header.Hash, canonical.Header.Hash)
+	}
+
+	if err := chain.Stop(); err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+
+	if _, err := chain.WaitForHeight(ctx, head.Header.Height+10); !errors.Is(err, dummychain.ErrStopped) {
+		t.Fatalf("waiting on a stopped chain returned %v, expected ErrStopped", err)
+	}
+}
+
+func TestChain_Deterministic(t *testing.T) {
+	// run returns the items produced up to height 200 in order, compared by kind and position
+	// since each chain has its own producer key, hence its own hashes
+	run := func() []string {
+		var events []string
+		chain := dummychain.NewT(t,
+			dummychain.WithReorgs(),
+			dummychain.WithSkippedBlocks(),
+			dummychain.WithFlashBlocks(core.DefaultFlashBlockConfig()),
+			dummychain.WithSignals(nil),
+			dummychain.OnBlock(func(block *types.Block) {
+				events = append(events, fmt.Sprintf("block %d", block.Header.Height))
+			}),
+			dummychain.OnFlashBlock(func(flashBlock *types.FlashBlock) {
+				events = append(events, fmt.Sprintf("flash %d/%d", flashBlock.Header.Height, flashBlock.Index))
+			}),
+			dummychain.OnSignal(func(signal *types.Signal) {
+				events = append(events, fmt.Sprintf("signal %d@%d", signal.BlockNumber, signal.CommitmentLevel))
+			}),
+		)
+
+		if _, err := chain.WaitForHeight(context.Background(), 200); err != nil {
+			t.Fatalf("wait for height 200: %s", err)
+		}
+		if err := chain.Stop(); err != nil {
+			t.Fatalf("stop: %s", err)
+		}
+
+		return events
+	}
+
+	first, second := run(), run()
+	if !slices.Equal(first, second) {
+		for i := range min(len(first), len(second)) {
+			if first[i] != second[i] {
+				t.Fatalf("runs diverge at item %d: %q then %q", i, first[i], second[i])
+			}
+		}
+		t.Fatalf("runs produced %d then %d items", len(first), len(second))
+	}
+
+	for _, kind := range []string{"block ", "flash ", "signal "} {
+		if !slices.ContainsFunc(first, func(event string) bool { return strings.HasPrefix(event, kind) }) {
+			t.Errorf("no %q item produced", kind)
+		}
+	}
+}
+
+func valueOr(hash *string) string {
+	if hash == nil {
+		return ""
+	}
+
+	return *hash
+}
+
+func TestChain_RestartWithHigherStopHeight(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var blocks []*types.Block
+	run := func(stopHeight uint64) {
+		chain := dummychain.NewT(t,
+			dummychain.WithStoreDir(dir),
+			dummychain.WithStopHeight(stopHeight),
+			dummychain.WithFlashBlocks(core.DefaultFlashBlockConfig()),
+			dummychain.WithSignals(nil),
+			dummychain.OnBlock(func(block *types.Block) { blocks = append(blocks, block) }),
+		)
+
+		if _, err := chain.WaitForHeight(ctx, stopHeight+1); !errors.Is(err, dummychain.ErrStopped) {
+			t.Fatalf("waiting past the stop height %d returned %v, expected ErrStopped", stopHeight, err)
+		}
+		if err := chain.Stop(); err != nil {
+			t.Fatalf("stop: %s", err)
+		}
+	}
+
+	run(10)
+	run(20)
+
+	// The restarted chain continues from the last block sent, without a gap
+	for i, block := range blocks[1:] {
+		if parent := blocks[i]; block.Header.Height != parent.Header.Height+1 || valueOr(block.Header.PrevHash) != parent.Header.Hash {
+			t.Fatalf("block #%d follows block #%d", block.Header.Height, parent.Header.Height)
+		}
+	}
+
+	if head := blocks[len(blocks)-1].Header.Height; head != 20 {
+		t.Errorf("head is #%d, expected #20", head)
+	}
+}
@@ -0,0 +1,162 @@
+package dummychain
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// Option configures a chain created by New.
+type Option func(*config)
+
+type config struct {
+	// node is the node configuration built by the options, its genesis and tracer are set
+	// by New
+	node core.NodeConfig
+
+	genesisHeight uint64
+	genesisTime   time.Time
+	tracer        tracer.Tracer
+	logger        logrus.FieldLogger
+	realClock     bool
+
+	onBlock      func(block *types.Block)
+	onFlashBlock func(flashBlock *types.FlashBlock)
+	onSignal     func(signal *types.Signal)
+}
+
+// DefaultGenesisTime is the genesis time of the chains, and the start of their virtual clock,
+// unless WithGenesisTime or WithRealClock is used.
+var DefaultGenesisTime = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func defaultConfig() *config {
+	return &config{
+		node: core.NodeConfig{
+			EngineConfig: core.EngineConfig{
+				BlockRate:        60,
+				BlockSizeInBytes: 4 * 1024,
+				BlockWorkers:     runtime.NumCPU(),
+				BlockLookahead:   1,
+				FlashBlocks:      core.DefaultFlashBlockConfig(),
+				CommitmentLevels: core.DefaultCommitmentLevels(),
+			},
+		},
+	}
+}
+
+// WithGenesisHeight sets the height of the genesis block, 0 by default.
+func WithGenesisHeight(height uint64) Option {
+	return func(c *config) { c.genesisHeight = height }
+}
+
+// WithGenesisTime sets the genesis time, the virtual clock starting at it.
+func WithGenesisTime(genesisTime time.Time) Option {
+	return func(c *config) { c.genesisTime = genesisTime }
+}
+
+// WithBlockRate sets the amount of blocks produced per minute, 60 by default.
+func WithBlockRate(blocksPerMinute int) Option {
+	return func(c *config) { c.node.BlockRate = blocksPerMinute }
+}
+
+// WithBlockSize sets the size of the produced blocks, as encoded in Protobuf, 4 KiB by default.
+func WithBlockSize(bytes int) Option {
+	return func(c *config) { c.node.BlockSizeInBytes = bytes }
+}
+
+// WithStopHeight makes the chain stop producing blocks once height is reached.
+func WithStopHeight(height uint64) Option {
+	return func(c *config) { c.node.StopHeight = height }
+}
+
+// WithUpgrades sets the protocol upgrades applied after the genesis.
+func WithUpgrades(upgrades ...types.Upgrade) Option {
+	return func(c *config) { c.node.Upgrades = upgrades }
+}
+
+// WithTimestamps sets how the block timestamps are computed, slot mode by default.
+func WithTimestamps(timestamps *core.Timestamps) Option {
+	return func(c *config) { c.node.Timestamps = timestamps }
+}
+
+// WithRetention sets the blocks kept by the store, all of them by default.
+func WithRetention(retention core.Retention) Option {
+	return func(c *config) { c.node.Retention = retention }
+}
+
+// WithReorgs produces the scheduled forks, at heights multiple of 17. ForceReorg produces
+// forks without it.
+func WithReorgs() Option {
+	return func(c *config) { c.node.WithReorgs = true }
+}
+
+// WithSkippedBlocks skips the heights multiple of 13.
+func WithSkippedBlocks() Option {
+	return func(c *config) { c.node.WithSkippedBlocks = true }
+}
+
+// WithFlashBlocks produces flash blocks configured by flashBlocks ahead of each block.
+func WithFlashBlocks(flashBlocks core.FlashBlockConfig) Option {
+	return func(c *config) {
+		c.node.WithFlashBlocks = true
+		c.node.FlashBlocks = flashBlocks
+	}
+}
+
+// WithSignals produces the commitment signals of levels, the default ones when levels is nil.
+func WithSignals(levels core.CommitmentLevels) Option {
+	return func(c *config) {
+		c.node.WithCommitmentSignal = true
+		if levels != nil {
+			c.node.CommitmentLevels = levels
+		}
+	}
+}
+
+// WithStoreDir stores the chain in dir instead of memory, a chain created again on the same
+// dir resumes it.
+func WithStoreDir(dir string) Option {
+	return func(c *config) { c.node.StoreDir = dir }
+}
+
+// WithServer serves the chain HTTP API on addr, no server is started by default.
+func WithServer(addr string) Option {
+	return func(c *config) { c.node.ServerAddr = addr }
+}
+
+// WithTracer traces the chain to tracer, e.g. tracer.NewFirehoseTracer to get its Firehose
+// stream.
+func WithTracer(tracer tracer.Tracer) Option {
+	return func(c *config) { c.tracer = tracer }
+}
+
+// WithLogger logs to logger, the chain doesn't log by default.
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(c *config) { c.logger = logger }
+}
+
+// WithRealClock paces the block production with the system clock instead of a virtual one,
+// the chain producing blocks in the background at its block rate.
+func WithRealClock() Option {
+	return func(c *config) { c.realClock = true }
+}
+
+// OnBlock calls fn with each block once stored, forks included, from the goroutine producing
+// them: blocks are not produced until fn returns.
+func OnBlock(fn func(block *types.Block)) Option {
+	return func(c *config) { c.onBlock = fn }
+}
+
+// OnFlashBlock calls fn with each flash block once stored, like OnBlock.
+func OnFlashBlock(fn func(flashBlock *types.FlashBlock)) Option {
+	return func(c *config) { c.onFlashBlock = fn }
+}
+
+// OnSignal calls fn with each commitment signal once stored, like OnBlock.
+func OnSignal(fn func(signal *types.Signal)) Option {
+	return func(c *config) { c.onSignal = fn }
+}
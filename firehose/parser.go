@@ -0,0 +1,228 @@
+package firehose
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ProtocolVersion30 is the Firehose protocol version where `FIRE BLOCK` lines carry
+	// full blocks only.
+	ProtocolVersion30 = "3.0"
+
+	// ProtocolVersion31 is the Firehose protocol version adding a flash block index to
+	// `FIRE BLOCK` lines, 0 being the full block.
+	ProtocolVersion31 = "3.1"
+
+	// FinalFlashBlockIndexOffset is added to the index of a flash block when it's the last
+	// one sent before the full block, e.g. 1004 means "final flash block with index 4".
+	FinalFlashBlockIndexOffset = 1000
+
+	// PayloadCompressionZstd is announced in the `FIRE INIT` line when block payloads are
+	// zstd compressed before being base64 encoded.
+	PayloadCompressionZstd = "zstd"
+)
+
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+
+// ErrNotFireLine is returned by ParseLine when the line is not a Firehose protocol line, such
+// lines are usually regular node logs interleaved with the protocol output and can be ignored.
+var ErrNotFireLine = errors.New("not a FIRE line")
+
+// Line is one of *InitLine, *BlockLine or *SignalLine.
+type Line interface {
+	isLine()
+}
+
+// InitLine is `FIRE INIT <version> <block type name> [<payload compression>]`, the payload
+// compression being an extension of this chain, absent when payloads are not compressed.
+type InitLine struct {
+	Version            string
+	BlockTypeName      string
+	PayloadCompression string
+}
+
+// BlockLine is `FIRE BLOCK <num> [<flash index>] <hash> <prev num> <prev hash> <final num> <timestamp> <payload>`,
+// the flash index being present only on protocol version 3.1.
+type BlockLine struct {
+	Number         uint64
+	FlashIndex     int32
+	Hash           string
+	PrevNumber     uint64
+	PrevHash       string
+	FinalNumber    uint64
+	TimestampNanos int64
+	Payload        []byte
+}
+
+// IsFlash returns true if the line is a partial (flash) block and not the full block.
+func (l *BlockLine) IsFlash() bool {
+	return l.FlashIndex != 0
+}
+
+// IsFinalFlash returns true if the line is the last flash block sent before the full block.
+func (l *BlockLine) IsFinalFlash() bool {
+	return l.FlashIndex >= FinalFlashBlockIndexOffset
+}
+
+// EffectiveFlashIndex returns the flash index with the final flash block offset removed.
+func (l *BlockLine) EffectiveFlashIndex() int32 {
+	if l.IsFinalFlash() {
+		return l.FlashIndex - FinalFlashBlockIndexOffset
+	}
+
+	return l.FlashIndex
+}
+
+// SignalLine is `FIRE SIGNAL <version> <block num> <block hash> <commitment level>`.
+type SignalLine struct {
+	Version         string
+	BlockNumber     uint64
+	BlockHash       string
+	CommitmentLevel int32
+}
+
+func (*InitLine) isLine()   {}
+func (*BlockLine) isLine()  {}
+func (*SignalLine) isLine() {}
+
+// ParseLine parses a single Firehose protocol line. The last `FIRE INIT` line of the stream
+// is required to parse `FIRE BLOCK` lines since the 3.0 and 3.1 formats differ and payloads
+// may be compressed, it's ignored for the other kinds and can be nil until received.
+func ParseLine(line string, init *InitLine) (Line, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "FIRE ") {
+		return nil, ErrNotFireLine
+	}
+
+	// Splitting on each space and not with strings.Fields on purpose, empty values (like
+	// the previous hash of the first block) are printed as empty tokens.
+	parts := strings.Split(line, " ")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid FIRE line, missing kind")
+	}
+
+	switch parts[1] {
+	case "INIT":
+		return parseInit(parts[2:])
+	case "BLOCK":
+		if init == nil {
+			return nil, fmt.Errorf("received FIRE BLOCK line before FIRE INIT")
+		}
+
+		return parseBlock(parts[2:], init)
+	case "SIGNAL":
+		return parseSignal(parts[2:])
+	}
+
+	return nil, fmt.Errorf("unknown FIRE line kind %q", parts[1])
+}
+
+func parseInit(parts []string) (*InitLine, error) {
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("invalid FIRE INIT line, expected 2 or 3 fields, got %d", len(parts))
+	}
+
+	if parts[0] != ProtocolVersion30 && parts[0] != ProtocolVersion31 {
+		return nil, fmt.Errorf("unsupported FIRE INIT protocol version %q", parts[0])
+	}
+
+	out := &InitLine{Version: parts[0], BlockTypeName: parts[1]}
+	if len(parts) == 3 {
+		if parts[2] != PayloadCompressionZstd {
+			return nil, fmt.Errorf("unsupported FIRE INIT payload compression %q", parts[2])
+		}
+
+		out.PayloadCompression = parts[2]
+	}
+
+	return out, nil
+}
+
+func parseBlock(parts []string, init *InitLine) (out *BlockLine, err error) {
+	out = &BlockLine{}
+
+	switch version := init.Version; version {
+	case ProtocolVersion30:
+		if len(parts) != 7 {
+			return nil, fmt.Errorf("invalid FIRE BLOCK line, expected 7 fields for protocol %s, got %d", version, len(parts))
+		}
+	case ProtocolVersion31:
+		if len(parts) != 8 {
+			return nil, fmt.Errorf("invalid FIRE BLOCK line, expected 8 fields for protocol %s, got %d", version, len(parts))
+		}
+
+		index, err := strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flash block index %q: %w", parts[1], err)
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("invalid flash block index %d, must be positive", index)
+		}
+
+		out.FlashIndex = int32(index)
+		parts = append(parts[:1:1], parts[2:]...)
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %q", version)
+	}
+
+	if out.Number, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid block number %q: %w", parts[0], err)
+	}
+
+	out.Hash = parts[1]
+	if out.Hash == "" {
+		return nil, fmt.Errorf("invalid block hash, must not be empty")
+	}
+
+	if out.PrevNumber, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid previous block number %q: %w", parts[2], err)
+	}
+
+	out.PrevHash = parts[3]
+
+	if out.FinalNumber, err = strconv.ParseUint(parts[4], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid final block number %q: %w", parts[4], err)
+	}
+
+	if out.TimestampNanos, err = strconv.ParseInt(parts[5], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q: %w", parts[5], err)
+	}
+
+	if out.Payload, err = base64.StdEncoding.DecodeString(parts[6]); err != nil {
+		return nil, fmt.Errorf("invalid base64 payload: %w", err)
+	}
+
+	if init.PayloadCompression == PayloadCompressionZstd {
+		if out.Payload, err = zstdDecoder.DecodeAll(out.Payload, nil); err != nil {
+			return nil, fmt.Errorf("invalid zstd payload: %w", err)
+		}
+	}
+
+	return out, nil
+}
+
+func parseSignal(parts []string) (out *SignalLine, err error) {
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid FIRE SIGNAL line, expected 4 fields, got %d", len(parts))
+	}
+
+	out = &SignalLine{Version: parts[0], BlockHash: parts[2]}
+
+	if out.BlockNumber, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid signal block number %q: %w", parts[1], err)
+	}
+
+	level, err := strconv.ParseInt(parts[3], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signal commitment level %q: %w", parts[3], err)
+	}
+	out.CommitmentLevel = int32(level)
+
+	return out, nil
+}
@@ -0,0 +1,241 @@
+package firehose
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestParseLine(t *testing.T) {
+	payload := []byte("block payload")
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := base64.StdEncoding.EncodeToString(encoder.EncodeAll(payload, nil))
+
+	init30 := &InitLine{Version: ProtocolVersion30, BlockTypeName: "sf.acme.type.v1.Block"}
+	init31 := &InitLine{Version: ProtocolVersion31, BlockTypeName: "sf.acme.type.v1.Block"}
+	init31Zstd := &InitLine{Version: ProtocolVersion31, BlockTypeName: "sf.acme.type.v1.Block", PayloadCompression: PayloadCompressionZstd}
+
+	tests := []struct {
+		name     string
+		line     string
+		init     *InitLine
+		expected Line
+		err      string
+	}{
+		{
+			name:     "init 3.0",
+			line:     "FIRE INIT 3.0 sf.acme.type.v1.Block",
+			expected: init30,
+		},
+		{
+			name:     "init 3.1 with compression",
+			line:     "FIRE INIT 3.1 sf.acme.type.v1.Block zstd\n",
+			expected: init31Zstd,
+		},
+		{
+			name: "init unsupported version",
+			line: "FIRE INIT 2.3 sf.acme.type.v1.Block",
+			err:  `unsupported FIRE INIT protocol version "2.3"`,
+		},
+		{
+			name: "init unsupported compression",
+			line: "FIRE INIT 3.1 sf.acme.type.v1.Block gzip",
+			err:  `unsupported FIRE INIT payload compression "gzip"`,
+		},
+		{
+			name: "init truncated",
+			line: "FIRE INIT 3.0",
+			err:  "expected 2 or 3 fields, got 1",
+		},
+		{
+			name: "block 3.0",
+			line: "FIRE BLOCK 12 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init30,
+			expected: &BlockLine{
+				Number: 12, Hash: "0c", PrevNumber: 11, PrevHash: "0b", FinalNumber: 10,
+				TimestampNanos: 1700000000000000000, Payload: payload,
+			},
+		},
+		{
+			name: "block 3.0 without parent",
+			line: "FIRE BLOCK 0 00 0  0 1700000000000000000 " + encoded,
+			init: init30,
+			expected: &BlockLine{
+				Number: 0, Hash: "00", TimestampNanos: 1700000000000000000, Payload: payload,
+			},
+		},
+		{
+			name: "block 3.1 full block",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			expected: &BlockLine{
+				Number: 12, Hash: "0c", PrevNumber: 11, PrevHash: "0b", FinalNumber: 10,
+				TimestampNanos: 1700000000000000000, Payload: payload,
+			},
+		},
+		{
+			name: "block 3.1 flash block",
+			line: "FIRE BLOCK 12 2 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			expected: &BlockLine{
+				Number: 12, FlashIndex: 2, Hash: "0c", PrevNumber: 11, PrevHash: "0b", FinalNumber: 10,
+				TimestampNanos: 1700000000000000000, Payload: payload,
+			},
+		},
+		{
+			name: "block 3.1 final flash block",
+			line: "FIRE BLOCK 12 1004 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			expected: &BlockLine{
+				Number: 12, FlashIndex: 1004, Hash: "0c", PrevNumber: 11, PrevHash: "0b", FinalNumber: 10,
+				TimestampNanos: 1700000000000000000, Payload: payload,
+			},
+		},
+		{
+			name: "block compressed payload",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10 1700000000000000000 " + compressed,
+			init: init31Zstd,
+			expected: &BlockLine{
+				Number: 12, Hash: "0c", PrevNumber: 11, PrevHash: "0b", FinalNumber: 10,
+				TimestampNanos: 1700000000000000000, Payload: payload,
+			},
+		},
+		{
+			name: "block uncompressed payload announced compressed",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31Zstd,
+			err:  "invalid zstd payload",
+		},
+		{
+			name: "block before init",
+			line: "FIRE BLOCK 12 0c 11 0b 10 1700000000000000000 " + encoded,
+			err:  "received FIRE BLOCK line before FIRE INIT",
+		},
+		{
+			name: "block 3.1 line on 3.0 stream",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init30,
+			err:  "expected 7 fields for protocol 3.0, got 8",
+		},
+		{
+			name: "block 3.0 line on 3.1 stream",
+			line: "FIRE BLOCK 12 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			err:  "expected 8 fields for protocol 3.1, got 7",
+		},
+		{
+			name: "block truncated",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10",
+			init: init31,
+			err:  "expected 8 fields for protocol 3.1, got 6",
+		},
+		{
+			name: "block truncated payload",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10 1700000000000000000 " + encoded[:len(encoded)-3],
+			init: init31,
+			err:  "invalid base64 payload",
+		},
+		{
+			name: "block negative flash index",
+			line: "FIRE BLOCK 12 -1 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			err:  "invalid flash block index -1",
+		},
+		{
+			name: "block invalid number",
+			line: "FIRE BLOCK twelve 0 0c 11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			err:  `invalid block number "twelve"`,
+		},
+		{
+			name: "block empty hash",
+			line: "FIRE BLOCK 12 0  11 0b 10 1700000000000000000 " + encoded,
+			init: init31,
+			err:  "invalid block hash",
+		},
+		{
+			name: "block invalid timestamp",
+			line: "FIRE BLOCK 12 0 0c 11 0b 10 now " + encoded,
+			init: init31,
+			err:  `invalid timestamp "now"`,
+		},
+		{
+			name:     "signal",
+			line:     "FIRE SIGNAL 1 12 0c 2",
+			expected: &SignalLine{Version: "1", BlockNumber: 12, BlockHash: "0c", CommitmentLevel: 2},
+		},
+		{
+			name: "signal truncated",
+			line: "FIRE SIGNAL 1 12 0c",
+			err:  "expected 4 fields, got 3",
+		},
+		{
+			name: "signal invalid level",
+			line: "FIRE SIGNAL 1 12 0c final",
+			err:  `invalid signal commitment level "final"`,
+		},
+		{
+			name: "unknown kind",
+			line: "FIRE TRX 12",
+			err:  `unknown FIRE line kind "TRX"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, err := ParseLine(test.line, test.init)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(line, test.expected) {
+				t.Errorf("parsed %+v, expected %+v", line, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseLine_NotFireLine(t *testing.T) {
+	for _, line := range []string{"", "INFO processing block", "FIRE", "FIREBLOCK 12"} {
+		if _, err := ParseLine(line, nil); !errors.Is(err, ErrNotFireLine) {
+			t.Errorf("line %q: expected ErrNotFireLine, got %v", line, err)
+		}
+	}
+}
+
+func TestBlockLine_FlashIndex(t *testing.T) {
+	tests := []struct {
+		index      int32
+		flash      bool
+		finalFlash bool
+		effective  int32
+	}{
+		{index: 0, flash: false, finalFlash: false, effective: 0},
+		{index: 3, flash: true, finalFlash: false, effective: 3},
+		{index: 1004, flash: true, finalFlash: true, effective: 4},
+	}
+
+	for _, test := range tests {
+		line := &BlockLine{FlashIndex: test.index}
+		if line.IsFlash() != test.flash || line.IsFinalFlash() != test.finalFlash || line.EffectiveFlashIndex() != test.effective {
+			t.Errorf("index %d: flash %t, final flash %t, effective index %d", test.index, line.IsFlash(), line.IsFinalFlash(), line.EffectiveFlashIndex())
+		}
+	}
+}
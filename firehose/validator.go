@@ -0,0 +1,360 @@
+package firehose
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PayloadHeader is the subset of a decoded block payload that the validator cross-checks
+// against the fields of the `FIRE BLOCK` line carrying it.
+type PayloadHeader struct {
+	Number      uint64
+	Hash        string
+	PrevNumber  uint64
+	PrevHash    string
+	FinalNumber uint64
+
+	// TimestampNanos is only compared with the line timestamp when not 0
+	TimestampNanos int64
+
+	// Transactions identify the transactions of the payload in order, when set the flash
+	// blocks of a height must extend the transactions of the previous ones. TransactionsOffset
+	// is the index in the block of the first one, set on flash blocks only holding the
+	// transactions added since the previous one.
+	Transactions       []string
+	TransactionsOffset uint64
+}
+
+// PayloadDecoder decodes the payload of a `FIRE BLOCK` line into the chain specific block
+// model, returning its header so it can be compared with the line fields.
+type PayloadDecoder func(payload []byte) (*PayloadHeader, error)
+
+// Violation is a single protocol rule broken by the stream.
+type Violation struct {
+	Line    int
+	Rule    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d: [%s] %s", v.Line, v.Rule, v.Message)
+}
+
+const (
+	RuleMalformed      = "malformed"
+	RuleInit           = "init"
+	RuleParentLinkage  = "parent-linkage"
+	RuleDuplicate      = "duplicate"
+	RuleFinalMonotonic = "final-monotonic"
+	RuleFinalAhead     = "final-ahead"
+	RuleFlashSequence  = "flash-sequence"
+	RuleFlashContent   = "flash-content"
+	RulePayload        = "payload"
+	RuleSignal         = "signal"
+)
+
+// Report summarizes a validated stream.
+type Report struct {
+	Version     string
+	Blocks      int
+	Forks       int
+	FlashBlocks int
+	Signals     int
+	Ignored     int
+	LowestNum   uint64
+	HighestNum  uint64
+	Violations  []Violation
+}
+
+func (r *Report) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("version %s, blocks #%d to #%d: %d blocks (%d forks), %d flash blocks, %d signals, %d ignored lines, %d violations",
+		r.Version, r.LowestNum, r.HighestNum, r.Blocks, r.Forks, r.FlashBlocks, r.Signals, r.Ignored, len(r.Violations))
+}
+
+type blockID struct {
+	num  uint64
+	hash string
+}
+
+type flashProgress struct {
+	lastIndex int32
+	final     bool
+
+	// transactions accumulated from the flash blocks of the round, when the decoder sets them
+	transactions []string
+
+	// joined is a round started before the stream, its previous flash blocks are unknown
+	joined bool
+}
+
+// Validator checks the invariants of a Firehose protocol stream line by line:
+//
+//   - `FIRE INIT` comes first and any re-initialization (node restart) keeps the same version;
+//   - every block links to a parent that was seen earlier in the stream (except the ones
+//     before the first full block, the stream of a restarted node starting mid-chain);
+//   - the same full block is never sent twice;
+//   - the final block number never goes backward and is never above the block number;
+//   - flash blocks of a height have sequential indexes and the final one has the highest;
+//   - flash blocks of a height extend the transactions of the previous ones, when the
+//     PayloadDecoder sets them;
+//   - payloads decode and agree with the line fields, when a PayloadDecoder is set;
+//   - signals reference a full block seen earlier in the stream (except the ones below it).
+type Validator struct {
+	decoder PayloadDecoder
+
+	lineNum   int
+	init      *InitLine
+	seen      map[blockID]bool
+	heads     map[uint64]string
+	flashes   map[uint64]*flashProgress
+	lastFinal uint64
+	report    *Report
+}
+
+// NewValidator creates a validator decoding payloads with decoder, which can be nil to
+// skip payload checks.
+func NewValidator(decoder PayloadDecoder) *Validator {
+	return &Validator{
+		decoder: decoder,
+		seen:    map[blockID]bool{},
+		heads:   map[uint64]string{},
+		flashes: map[uint64]*flashProgress{},
+		report:  &Report{},
+	}
+}
+
+// Validate reads the full stream from reader and returns the resulting report.
+func Validate(reader io.Reader, decoder PayloadDecoder) (*Report, error) {
+	validator := NewValidator(decoder)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+
+	for scanner.Scan() {
+		validator.Process(scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return validator.Report(), fmt.Errorf("read stream: %w", err)
+	}
+
+	return validator.Report(), nil
+}
+
+// Report returns the report accumulated so far.
+func (v *Validator) Report() *Report {
+	return v.report
+}
+
+// Process validates the next line of the stream, non Firehose lines are ignored.
+func (v *Validator) Process(rawLine string) {
+	v.lineNum++
+
+	line, err := ParseLine(rawLine, v.init)
+	if err != nil {
+		if errors.Is(err, ErrNotFireLine) {
+			v.report.Ignored++
+			return
+		}
+
+		v.violation(RuleMalformed, "%s", err)
+		return
+	}
+
+	switch l := line.(type) {
+	case *InitLine:
+		v.processInit(l)
+	case *BlockLine:
+		v.processBlock(l)
+	case *SignalLine:
+		v.processSignal(l)
+	}
+}
+
+func (v *Validator) processInit(line *InitLine) {
+	if v.init != nil && v.init.Version != line.Version {
+		v.violation(RuleInit, "protocol version changed from %s to %s on re-initialization", v.init.Version, line.Version)
+	}
+
+	v.init = line
+	v.report.Version = line.Version
+}
+
+func (v *Validator) processBlock(line *BlockLine) {
+	id := blockID{line.Number, line.Hash}
+	first := len(v.seen) == 0
+
+	if line.FinalNumber > line.Number {
+		v.violation(RuleFinalAhead, "block #%d has final block #%d above itself", line.Number, line.FinalNumber)
+	}
+
+	if line.FinalNumber < v.lastFinal {
+		v.violation(RuleFinalMonotonic, "block #%d has final block #%d lower than previously seen final block #%d", line.Number, line.FinalNumber, v.lastFinal)
+	} else {
+		v.lastFinal = line.FinalNumber
+	}
+
+	if !first {
+		switch {
+		case line.PrevHash == "":
+			v.violation(RuleParentLinkage, "block #%d (%s) has no parent", line.Number, line.Hash)
+		case line.PrevNumber >= line.Number:
+			v.violation(RuleParentLinkage, "block #%d (%s) has parent #%d which is not below it", line.Number, line.Hash, line.PrevNumber)
+		case line.PrevNumber >= v.report.LowestNum && !v.seen[blockID{line.PrevNumber, line.PrevHash}]:
+			v.violation(RuleParentLinkage, "block #%d (%s) has parent #%d (%s) which was never seen", line.Number, line.Hash, line.PrevNumber, line.PrevHash)
+		}
+	}
+
+	header := v.checkPayload(line)
+
+	if line.IsFlash() {
+		v.processFlash(line, header)
+		return
+	}
+
+	if v.seen[id] {
+		v.violation(RuleDuplicate, "block #%d (%s) was already sent", line.Number, line.Hash)
+	}
+
+	if previous, found := v.heads[line.Number]; found && previous != line.Hash {
+		v.report.Forks++
+	}
+
+	if first || line.Number < v.report.LowestNum {
+		v.report.LowestNum = line.Number
+	}
+	if line.Number > v.report.HighestNum {
+		v.report.HighestNum = line.Number
+	}
+
+	v.seen[id] = true
+	v.heads[line.Number] = line.Hash
+	v.report.Blocks++
+}
+
+func (v *Validator) processFlash(line *BlockLine, header *PayloadHeader) {
+	v.report.FlashBlocks++
+
+	progress := v.flashes[line.Number]
+	if progress == nil || progress.final {
+		// A new round of flash blocks starts for this height, either because it's the first one
+		// or because the previous round got completed and the height is being re-built (reorg).
+		progress = &flashProgress{}
+		v.flashes[line.Number] = progress
+
+		// The stream of a restarted node resumes the flash blocks of the upcoming height
+		if len(v.seen) == 0 {
+			progress.joined = true
+			if !line.IsFinalFlash() {
+				progress.lastIndex = line.EffectiveFlashIndex() - 1
+			}
+		}
+	}
+
+	index := line.EffectiveFlashIndex()
+	if line.IsFinalFlash() {
+		if index <= progress.lastIndex {
+			v.violation(RuleFlashSequence, "final flash block #%d (%s) has index %d which is not above last flash block index %d", line.Number, line.Hash, index, progress.lastIndex)
+		}
+
+		progress.final = true
+	} else if index != progress.lastIndex+1 {
+		v.violation(RuleFlashSequence, "flash block #%d (%s) has index %d but %d was expected", line.Number, line.Hash, index, progress.lastIndex+1)
+	}
+
+	progress.lastIndex = index
+
+	if header != nil && header.Transactions != nil && !progress.joined {
+		v.checkFlashContent(line, header, progress)
+	}
+}
+
+// checkFlashContent checks that the flash block extends the transactions accumulated from
+// the previous flash blocks of its round.
+func (v *Validator) checkFlashContent(line *BlockLine, header *PayloadHeader, progress *flashProgress) {
+	accumulated := progress.transactions
+	offset := int(header.TransactionsOffset)
+
+	switch {
+	case offset > len(accumulated):
+		v.violation(RuleFlashContent, "flash block #%d (%s) starts at transaction %d but previous flash blocks only have %d", line.Number, line.Hash, offset, len(accumulated))
+		return
+	case offset+len(header.Transactions) < len(accumulated):
+		v.violation(RuleFlashContent, "flash block #%d (%s) ends at transaction %d but previous flash blocks have %d", line.Number, line.Hash, offset+len(header.Transactions), len(accumulated))
+	}
+
+	for i := offset; i < min(len(accumulated), offset+len(header.Transactions)); i++ {
+		if accumulated[i] != header.Transactions[i-offset] {
+			v.violation(RuleFlashContent, "flash block #%d (%s) transaction %d is %s but previous flash blocks have %s", line.Number, line.Hash, i, header.Transactions[i-offset], accumulated[i])
+			break
+		}
+	}
+
+	progress.transactions = append(accumulated[:offset:offset], header.Transactions...)
+}
+
+// checkPayload cross-checks the decoded payload with the line fields, the decoded header is
+// returned, nil when there's no decoder or it can't be decoded.
+func (v *Validator) checkPayload(line *BlockLine) *PayloadHeader {
+	if v.decoder == nil {
+		return nil
+	}
+
+	header, err := v.decoder(line.Payload)
+	if err != nil {
+		v.violation(RulePayload, "block #%d (%s) payload cannot be decoded: %s", line.Number, line.Hash, err)
+		return nil
+	}
+
+	mismatch := func(field string, inLine, inPayload any) {
+		v.violation(RulePayload, "block #%d (%s) payload %s %v differs from line value %v", line.Number, line.Hash, field, inPayload, inLine)
+	}
+
+	if header.Number != line.Number {
+		mismatch("number", line.Number, header.Number)
+	}
+	if header.Hash != line.Hash {
+		mismatch("hash", line.Hash, header.Hash)
+	}
+	if header.PrevNumber != line.PrevNumber {
+		mismatch("previous number", line.PrevNumber, header.PrevNumber)
+	}
+	if header.PrevHash != line.PrevHash {
+		mismatch("previous hash", line.PrevHash, header.PrevHash)
+	}
+	if header.FinalNumber != line.FinalNumber {
+		mismatch("final number", line.FinalNumber, header.FinalNumber)
+	}
+	if header.TimestampNanos != 0 && header.TimestampNanos != line.TimestampNanos {
+		mismatch("timestamp", line.TimestampNanos, header.TimestampNanos)
+	}
+
+	return header
+}
+
+func (v *Validator) processSignal(line *SignalLine) {
+	v.report.Signals++
+
+	// Blocks below the stream were sent before the node restarted
+	if len(v.seen) == 0 || line.BlockNumber < v.report.LowestNum {
+		return
+	}
+
+	if !v.seen[blockID{line.BlockNumber, line.BlockHash}] {
+		v.violation(RuleSignal, "signal for block #%d (%s) which was never sent", line.BlockNumber, line.BlockHash)
+	}
+}
+
+func (v *Validator) violation(rule string, format string, args ...any) {
+	v.report.Violations = append(v.report.Violations, Violation{
+		Line:    v.lineNum,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
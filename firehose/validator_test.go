@@ -0,0 +1,204 @@
+package firehose
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The payloads of the test streams are the JSON encoded PayloadHeader of their line, decoded
+// by decodeTestPayload.
+
+func decodeTestPayload(payload []byte) (*PayloadHeader, error) {
+	header := &PayloadHeader{}
+	if err := json.Unmarshal(payload, header); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// testBlock is a `FIRE BLOCK` line of a 3.1 stream.
+type testBlock struct {
+	num, prevNum, final uint64
+	index               int32
+	hash, prevHash      string
+	transactions        []string
+
+	// payloadHash, when set, is the hash of the payload instead of hash
+	payloadHash string
+}
+
+func (b testBlock) String() string {
+	header := PayloadHeader{
+		Number:       b.num,
+		Hash:         b.hash,
+		PrevNumber:   b.prevNum,
+		PrevHash:     b.prevHash,
+		FinalNumber:  b.final,
+		Transactions: b.transactions,
+	}
+	if b.payloadHash != "" {
+		header.Hash = b.payloadHash
+	}
+
+	payload, err := json.Marshal(header)
+	if err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("FIRE BLOCK %d %d %s %d %s %d %d %s", b.num, b.index, b.hash, b.prevNum, b.prevHash, b.final, 1700000000000000000+b.num, base64.StdEncoding.EncodeToString(payload))
+}
+
+const testInit = "FIRE INIT 3.1 sf.acme.type.v1.Block"
+
+// validStream is a stream without violations, broken by the rule tests.
+func validStream() []string {
+	return []string{
+		testInit,
+		testBlock{num: 0, hash: "00"}.String(),
+		testBlock{num: 1, index: 1, hash: "01", prevNum: 0, prevHash: "00", transactions: []string{"a"}}.String(),
+		testBlock{num: 1, index: 1002, hash: "01", prevNum: 0, prevHash: "00", transactions: []string{"a", "b"}}.String(),
+		testBlock{num: 1, hash: "01", prevNum: 0, prevHash: "00", transactions: []string{"a", "b"}}.String(),
+		"FIRE SIGNAL 1 1 01 1",
+		"INFO some node log",
+		testBlock{num: 2, hash: "02f", prevNum: 1, prevHash: "01", final: 1}.String(),
+		testBlock{num: 2, hash: "02", prevNum: 1, prevHash: "01", final: 1}.String(),
+		testBlock{num: 3, hash: "03", prevNum: 2, prevHash: "02", final: 2}.String(),
+	}
+}
+
+func validate(t *testing.T, lines []string) *Report {
+	t.Helper()
+
+	report, err := Validate(strings.NewReader(strings.Join(lines, "\n")+"\n"), decodeTestPayload)
+	if err != nil {
+		t.Fatalf("validate: %s", err)
+	}
+
+	return report
+}
+
+func TestValidate_ValidStream(t *testing.T) {
+	report := validate(t, validStream())
+
+	for _, violation := range report.Violations {
+		t.Errorf("unexpected violation: %s", violation)
+	}
+
+	expected := Report{Version: "3.1", Blocks: 5, Forks: 1, FlashBlocks: 2, Signals: 1, Ignored: 1, LowestNum: 0, HighestNum: 3}
+	if report.String() != expected.String() {
+		t.Errorf("report is %q, expected %q", report, &expected)
+	}
+}
+
+func TestValidate_Rules(t *testing.T) {
+	tests := []struct {
+		rule string
+
+		// broken returns the broken stream from the valid one
+		broken func(lines []string) []string
+	}{
+		{
+			rule: RuleMalformed,
+			broken: func(lines []string) []string {
+				return append(lines, "FIRE BLOCK 4 0 04 3 03")
+			},
+		},
+		{
+			rule: RuleInit,
+			broken: func(lines []string) []string {
+				return append(lines, "FIRE INIT 3.0 sf.acme.type.v1.Block")
+			},
+		},
+		{
+			rule: RuleParentLinkage,
+			broken: func(lines []string) []string {
+				return append(lines, testBlock{num: 5, hash: "05", prevNum: 4, prevHash: "04", final: 2}.String())
+			},
+		},
+		{
+			rule: RuleDuplicate,
+			broken: func(lines []string) []string {
+				return append(lines, lines[len(lines)-1])
+			},
+		},
+		{
+			rule: RuleFinalMonotonic,
+			broken: func(lines []string) []string {
+				return append(lines, testBlock{num: 4, hash: "04", prevNum: 3, prevHash: "03", final: 1}.String())
+			},
+		},
+		{
+			rule: RuleFinalAhead,
+			broken: func(lines []string) []string {
+				return append(lines, testBlock{num: 4, hash: "04", prevNum: 3, prevHash: "03", final: 5}.String())
+			},
+		},
+		{
+			rule: RuleFlashSequence,
+			broken: func(lines []string) []string {
+				return append(lines,
+					testBlock{num: 4, index: 1, hash: "04", prevNum: 3, prevHash: "03", final: 2}.String(),
+					testBlock{num: 4, index: 3, hash: "04", prevNum: 3, prevHash: "03", final: 2}.String(),
+				)
+			},
+		},
+		{
+			rule: RuleFlashContent,
+			broken: func(lines []string) []string {
+				return append(lines,
+					testBlock{num: 4, index: 1, hash: "04", prevNum: 3, prevHash: "03", final: 2, transactions: []string{"c"}}.String(),
+					testBlock{num: 4, index: 2, hash: "04", prevNum: 3, prevHash: "03", final: 2, transactions: []string{"d", "e"}}.String(),
+				)
+			},
+		},
+		{
+			rule: RulePayload,
+			broken: func(lines []string) []string {
+				return append(lines, testBlock{num: 4, hash: "04", prevNum: 3, prevHash: "03", final: 2, payloadHash: "ff"}.String())
+			},
+		},
+		{
+			rule: RuleSignal,
+			broken: func(lines []string) []string {
+				return append(lines, "FIRE SIGNAL 1 3 ff 1")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			report := validate(t, test.broken(validStream()))
+
+			if len(report.Violations) == 0 {
+				t.Fatalf("expected a %s violation, got none", test.rule)
+			}
+
+			for _, violation := range report.Violations {
+				if violation.Rule != test.rule {
+					t.Errorf("expected only %s violations, got %s", test.rule, violation)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_RestartedStream(t *testing.T) {
+	// A node restarted mid-chain resumes the flash blocks of the upcoming height, and signals
+	// the blocks sent before its restart
+	report := validate(t, []string{
+		testInit,
+		testBlock{num: 11, index: 2, hash: "11", prevNum: 10, prevHash: "10", final: 10, transactions: []string{"a"}}.String(),
+		"FIRE SIGNAL 1 9 09 2",
+		testBlock{num: 11, hash: "11", prevNum: 10, prevHash: "10", final: 10}.String(),
+		"FIRE SIGNAL 1 10 10 2",
+		testBlock{num: 12, hash: "12", prevNum: 11, prevHash: "11", final: 10}.String(),
+	})
+
+	for _, violation := range report.Violations {
+		t.Errorf("unexpected violation: %s", violation)
+	}
+}
@@ -5,6 +5,7 @@ go 1.24.2
 require (
 	github.com/dustin/go-humanize v1.0.1
 	github.com/gin-gonic/gin v1.7.7
+	github.com/klauspost/compress v1.18.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.7.0
 	google.golang.org/protobuf v1.36.6
@@ -15,16 +15,9 @@
 
 ROOT="$( cd "$( dirname "${BASH_SOURCE[0]}" )" && cd .. && pwd )"
 
-ACME_ROOT=${ACME_ROOT:-""}
-if [[ ! -d "$ACME_ROOT" ]]; then
-  echo "To generate 'dummy-blockchain' types correctly, you need to define environment"
-  echo "variable 'ACME_ROOT' and making it point to 'firehose-acme' root directory. It's right"
-  echo "now '$ACME_ROOT' which is either undefined or pointing to a non-existent location."
-  exit 1
-fi
-
-# Protobuf definitions
-PROTO_ACME=${1:-"$ACME_ROOT/proto"}
+# Protobuf definitions, the 'sf.acme.type.v1' model originates from 'firehose-acme' but is now
+# maintained here as the dummy chain extends it (upgrade schedule header fields, etc.)
+PROTO_ACME=${1:-"$ROOT/proto"}
 
 function main() {
   checks
@@ -35,7 +28,7 @@ function main() {
   generate "sf/acme/type/v1/type.proto"
 
   echo "generate.sh - `date` - `whoami`" > ./last_generate.txt
-  echo "firehose-acme/proto revision: `GIT_DIR=$ACME_ROOT/.git git log -n 1 --pretty=format:%h -- proto`" >> ./last_generate.txt
+  echo "dummy-blockchain/proto revision: `git -C "$ROOT" log -n 1 --pretty=format:%h -- proto`" >> ./last_generate.txt
 }
 
 # usage:
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.5
+// 	protoc-gen-go v1.36.6
 // 	protoc        v6.32.1
 // source: sf/acme/type/v1/type.proto
 
@@ -22,16 +22,46 @@ const (
 )
 
 type BlockHeader struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Height        uint64                 `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
-	Hash          string                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
-	PreviousNum   *uint64                `protobuf:"varint,3,opt,name=previous_num,json=previousNum,proto3,oneof" json:"previous_num,omitempty"`
-	PreviousHash  *string                `protobuf:"bytes,4,opt,name=previous_hash,json=previousHash,proto3,oneof" json:"previous_hash,omitempty"`
-	FinalNum      uint64                 `protobuf:"varint,5,opt,name=final_num,json=finalNum,proto3" json:"final_num,omitempty"`
-	FinalHash     string                 `protobuf:"bytes,6,opt,name=final_hash,json=finalHash,proto3" json:"final_hash,omitempty"`
-	Timestamp     int64                  `protobuf:"varint,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Height       uint64                 `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Hash         string                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	PreviousNum  *uint64                `protobuf:"varint,3,opt,name=previous_num,json=previousNum,proto3,oneof" json:"previous_num,omitempty"`
+	PreviousHash *string                `protobuf:"bytes,4,opt,name=previous_hash,json=previousHash,proto3,oneof" json:"previous_hash,omitempty"`
+	FinalNum     uint64                 `protobuf:"varint,5,opt,name=final_num,json=finalNum,proto3" json:"final_num,omitempty"`
+	FinalHash    string                 `protobuf:"bytes,6,opt,name=final_hash,json=finalHash,proto3" json:"final_hash,omitempty"`
+	Timestamp    int64                  `protobuf:"varint,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Amount of protocol upgrades activated at this height, 0 before the first upgrade.
+	ProtocolVersion uint32 `protobuf:"varint,8,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	// Fields added to the header by protocol upgrades, sorted by key.
+	ExtraFields []*Attribute `protobuf:"bytes,9,rep,name=extra_fields,json=extraFields,proto3" json:"extra_fields,omitempty"`
+	// Wall-clock time (Unix nanoseconds) at which the block was produced, only set when the node
+	// tracks it, 0 otherwise. Unlike `timestamp`, it's never derived from the genesis or replayed.
+	PropagationTime int64 `protobuf:"varint,10,opt,name=propagation_time,json=propagationTime,proto3" json:"propagation_time,omitempty"`
+	// Amount of heights skipped between the parent block and this one, no block was ever produced
+	// at these heights.
+	SkippedSlots uint64 `protobuf:"varint,11,opt,name=skipped_slots,json=skippedSlots,proto3" json:"skipped_slots,omitempty"`
+	// Merkle root (RFC 6962) of the block transactions.
+	TransactionsRoot string `protobuf:"bytes,12,opt,name=transactions_root,json=transactionsRoot,proto3" json:"transactions_root,omitempty"`
+	// Commits to the parent block and to the transactions applied on top of it.
+	StateRoot string `protobuf:"bytes,13,opt,name=state_root,json=stateRoot,proto3" json:"state_root,omitempty"`
+	// Address of the node that produced the block.
+	Proposer string `protobuf:"bytes,14,opt,name=proposer,proto3" json:"proposer,omitempty"`
+	GasUsed  uint64 `protobuf:"varint,15,opt,name=gas_used,json=gasUsed,proto3" json:"gas_used,omitempty"`
+	GasLimit uint64 `protobuf:"varint,16,opt,name=gas_limit,json=gasLimit,proto3" json:"gas_limit,omitempty"`
+	// Exact size in bytes of this `Block` message.
+	Size      uint64 `protobuf:"varint,17,opt,name=size,proto3" json:"size,omitempty"`
+	ExtraData []byte `protobuf:"bytes,18,opt,name=extra_data,json=extraData,proto3" json:"extra_data,omitempty"`
+	// Ed25519 public key of the block producer, `proposer` is derived from it.
+	ProducerKey []byte `protobuf:"bytes,19,opt,name=producer_key,json=producerKey,proto3" json:"producer_key,omitempty"`
+	// Ed25519 signature of the block hash by `producer_key`, the hash covers all the other header
+	// fields but `propagation_time`.
+	Signature []byte `protobuf:"bytes,20,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Index in the block of the first transaction held, only set on flash blocks holding the
+	// transactions added since the previous flash block, the header still committing to all the
+	// transactions of the block so far.
+	TransactionsOffset uint64 `protobuf:"varint,21,opt,name=transactions_offset,json=transactionsOffset,proto3" json:"transactions_offset,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *BlockHeader) Reset() {
@@ -113,6 +143,104 @@ func (x *BlockHeader) GetTimestamp() int64 {
 	return 0
 }
 
+func (x *BlockHeader) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetExtraFields() []*Attribute {
+	if x != nil {
+		return x.ExtraFields
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetPropagationTime() int64 {
+	if x != nil {
+		return x.PropagationTime
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetSkippedSlots() uint64 {
+	if x != nil {
+		return x.SkippedSlots
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetTransactionsRoot() string {
+	if x != nil {
+		return x.TransactionsRoot
+	}
+	return ""
+}
+
+func (x *BlockHeader) GetStateRoot() string {
+	if x != nil {
+		return x.StateRoot
+	}
+	return ""
+}
+
+func (x *BlockHeader) GetProposer() string {
+	if x != nil {
+		return x.Proposer
+	}
+	return ""
+}
+
+func (x *BlockHeader) GetGasUsed() uint64 {
+	if x != nil {
+		return x.GasUsed
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetGasLimit() uint64 {
+	if x != nil {
+		return x.GasLimit
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetExtraData() []byte {
+	if x != nil {
+		return x.ExtraData
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetProducerKey() []byte {
+	if x != nil {
+		return x.ProducerKey
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetTransactionsOffset() uint64 {
+	if x != nil {
+		return x.TransactionsOffset
+	}
+	return 0
+}
+
 type Block struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Header        *BlockHeader           `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
@@ -423,70 +551,60 @@ func (x *BigInt) GetBytes() []byte {
 
 var File_sf_acme_type_v1_type_proto protoreflect.FileDescriptor
 
-var file_sf_acme_type_v1_type_proto_rawDesc = string([]byte{
-	0x0a, 0x1a, 0x73, 0x66, 0x2f, 0x61, 0x63, 0x6d, 0x65, 0x2f, 0x74, 0x79, 0x70, 0x65, 0x2f, 0x76,
-	0x31, 0x2f, 0x74, 0x79, 0x70, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f, 0x73, 0x66,
-	0x2e, 0x61, 0x63, 0x6d, 0x65, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x2e, 0x76, 0x31, 0x22, 0x88, 0x02,
-	0x0a, 0x0b, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x16, 0x0a,
-	0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x68,
-	0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x61, 0x73, 0x68, 0x12, 0x26, 0x0a, 0x0c, 0x70, 0x72, 0x65,
-	0x76, 0x69, 0x6f, 0x75, 0x73, 0x5f, 0x6e, 0x75, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x48,
-	0x00, 0x52, 0x0b, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x4e, 0x75, 0x6d, 0x88, 0x01,
-	0x01, 0x12, 0x28, 0x0a, 0x0d, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x5f, 0x68, 0x61,
-	0x73, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x48, 0x01, 0x52, 0x0c, 0x70, 0x72, 0x65, 0x76,
-	0x69, 0x6f, 0x75, 0x73, 0x48, 0x61, 0x73, 0x68, 0x88, 0x01, 0x01, 0x12, 0x1b, 0x0a, 0x09, 0x66,
-	0x69, 0x6e, 0x61, 0x6c, 0x5f, 0x6e, 0x75, 0x6d, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08,
-	0x66, 0x69, 0x6e, 0x61, 0x6c, 0x4e, 0x75, 0x6d, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x69, 0x6e, 0x61,
-	0x6c, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x66, 0x69,
-	0x6e, 0x61, 0x6c, 0x48, 0x61, 0x73, 0x68, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73,
-	0x74, 0x61, 0x6d, 0x70, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65,
-	0x73, 0x74, 0x61, 0x6d, 0x70, 0x42, 0x0f, 0x0a, 0x0d, 0x5f, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f,
-	0x75, 0x73, 0x5f, 0x6e, 0x75, 0x6d, 0x42, 0x10, 0x0a, 0x0e, 0x5f, 0x70, 0x72, 0x65, 0x76, 0x69,
-	0x6f, 0x75, 0x73, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x22, 0x7f, 0x0a, 0x05, 0x42, 0x6c, 0x6f, 0x63,
-	0x6b, 0x12, 0x34, 0x0a, 0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x1c, 0x2e, 0x73, 0x66, 0x2e, 0x61, 0x63, 0x6d, 0x65, 0x2e, 0x74, 0x79, 0x70, 0x65,
-	0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x52,
-	0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x40, 0x0a, 0x0c, 0x74, 0x72, 0x61, 0x6e, 0x73,
-	0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1c, 0x2e,
-	0x73, 0x66, 0x2e, 0x61, 0x63, 0x6d, 0x65, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x2e, 0x76, 0x31, 0x2e,
-	0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0c, 0x74, 0x72, 0x61,
-	0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x22, 0xa3, 0x02, 0x0a, 0x0b, 0x54, 0x72,
-	0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70,
-	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a,
-	0x04, 0x68, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x61, 0x73,
-	0x68, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63,
-	0x65, 0x69, 0x76, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x63,
-	0x65, 0x69, 0x76, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x09, 0x20,
-	0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x2f, 0x0a, 0x06, 0x61, 0x6d, 0x6f,
-	0x75, 0x6e, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x73, 0x66, 0x2e, 0x61,
-	0x63, 0x6d, 0x65, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x69, 0x67, 0x49,
-	0x6e, 0x74, 0x52, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x29, 0x0a, 0x03, 0x66, 0x65,
-	0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x73, 0x66, 0x2e, 0x61, 0x63, 0x6d,
-	0x65, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x69, 0x67, 0x49, 0x6e, 0x74,
-	0x52, 0x03, 0x66, 0x65, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73,
-	0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12,
-	0x2e, 0x0a, 0x06, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32,
-	0x16, 0x2e, 0x73, 0x66, 0x2e, 0x61, 0x63, 0x6d, 0x65, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x2e, 0x76,
-	0x31, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x06, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x22,
-	0x57, 0x0a, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x3a, 0x0a, 0x0a,
-	0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b,
-	0x32, 0x1a, 0x2e, 0x73, 0x66, 0x2e, 0x61, 0x63, 0x6d, 0x65, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x2e,
-	0x76, 0x31, 0x2e, 0x41, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x52, 0x0a, 0x61, 0x74,
-	0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x73, 0x22, 0x33, 0x0a, 0x09, 0x41, 0x74, 0x74, 0x72,
-	0x69, 0x62, 0x75, 0x74, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x1e, 0x0a,
-	0x06, 0x42, 0x69, 0x67, 0x49, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x42, 0x42, 0x5a,
-	0x40, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x74, 0x72, 0x65,
-	0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2f, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f,
-	0x73, 0x65, 0x2d, 0x61, 0x63, 0x6d, 0x65, 0x2f, 0x70, 0x62, 0x2f, 0x73, 0x66, 0x2f, 0x61, 0x63,
-	0x6d, 0x65, 0x2f, 0x74, 0x79, 0x70, 0x65, 0x2f, 0x76, 0x31, 0x3b, 0x70, 0x62, 0x61, 0x63, 0x6d,
-	0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
-})
+const file_sf_acme_type_v1_type_proto_rawDesc = "" +
+	"\n" +
+	"\x1asf/acme/type/v1/type.proto\x12\x0fsf.acme.type.v1\"\x87\x06\n" +
+	"\vBlockHeader\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x04R\x06height\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\tR\x04hash\x12&\n" +
+	"\fprevious_num\x18\x03 \x01(\x04H\x00R\vpreviousNum\x88\x01\x01\x12(\n" +
+	"\rprevious_hash\x18\x04 \x01(\tH\x01R\fpreviousHash\x88\x01\x01\x12\x1b\n" +
+	"\tfinal_num\x18\x05 \x01(\x04R\bfinalNum\x12\x1d\n" +
+	"\n" +
+	"final_hash\x18\x06 \x01(\tR\tfinalHash\x12\x1c\n" +
+	"\ttimestamp\x18\a \x01(\x03R\ttimestamp\x12)\n" +
+	"\x10protocol_version\x18\b \x01(\rR\x0fprotocolVersion\x12=\n" +
+	"\fextra_fields\x18\t \x03(\v2\x1a.sf.acme.type.v1.AttributeR\vextraFields\x12)\n" +
+	"\x10propagation_time\x18\n" +
+	" \x01(\x03R\x0fpropagationTime\x12#\n" +
+	"\rskipped_slots\x18\v \x01(\x04R\fskippedSlots\x12+\n" +
+	"\x11transactions_root\x18\f \x01(\tR\x10transactionsRoot\x12\x1d\n" +
+	"\n" +
+	"state_root\x18\r \x01(\tR\tstateRoot\x12\x1a\n" +
+	"\bproposer\x18\x0e \x01(\tR\bproposer\x12\x19\n" +
+	"\bgas_used\x18\x0f \x01(\x04R\agasUsed\x12\x1b\n" +
+	"\tgas_limit\x18\x10 \x01(\x04R\bgasLimit\x12\x12\n" +
+	"\x04size\x18\x11 \x01(\x04R\x04size\x12\x1d\n" +
+	"\n" +
+	"extra_data\x18\x12 \x01(\fR\textraData\x12!\n" +
+	"\fproducer_key\x18\x13 \x01(\fR\vproducerKey\x12\x1c\n" +
+	"\tsignature\x18\x14 \x01(\fR\tsignature\x12/\n" +
+	"\x13transactions_offset\x18\x15 \x01(\x04R\x12transactionsOffsetB\x0f\n" +
+	"\r_previous_numB\x10\n" +
+	"\x0e_previous_hash\"\x7f\n" +
+	"\x05Block\x124\n" +
+	"\x06header\x18\x01 \x01(\v2\x1c.sf.acme.type.v1.BlockHeaderR\x06header\x12@\n" +
+	"\ftransactions\x18\x02 \x03(\v2\x1c.sf.acme.type.v1.TransactionR\ftransactions\"\xa3\x02\n" +
+	"\vTransaction\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\tR\x04hash\x12\x16\n" +
+	"\x06sender\x18\x03 \x01(\tR\x06sender\x12\x1a\n" +
+	"\breceiver\x18\x04 \x01(\tR\breceiver\x12\x12\n" +
+	"\x04data\x18\t \x01(\fR\x04data\x12/\n" +
+	"\x06amount\x18\x05 \x01(\v2\x17.sf.acme.type.v1.BigIntR\x06amount\x12)\n" +
+	"\x03fee\x18\x06 \x01(\v2\x17.sf.acme.type.v1.BigIntR\x03fee\x12\x18\n" +
+	"\asuccess\x18\a \x01(\bR\asuccess\x12.\n" +
+	"\x06events\x18\b \x03(\v2\x16.sf.acme.type.v1.EventR\x06events\"W\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12:\n" +
+	"\n" +
+	"attributes\x18\x02 \x03(\v2\x1a.sf.acme.type.v1.AttributeR\n" +
+	"attributes\"3\n" +
+	"\tAttribute\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\x1e\n" +
+	"\x06BigInt\x12\x14\n" +
+	"\x05bytes\x18\x01 \x01(\fR\x05bytesBBZ@github.com/streamingfast/firehose-acme/pb/sf/acme/type/v1;pbacmeb\x06proto3"
 
 var (
 	file_sf_acme_type_v1_type_proto_rawDescOnce sync.Once
@@ -510,17 +628,18 @@ var file_sf_acme_type_v1_type_proto_goTypes = []any{
 	(*BigInt)(nil),      // 5: sf.acme.type.v1.BigInt
 }
 var file_sf_acme_type_v1_type_proto_depIdxs = []int32{
-	0, // 0: sf.acme.type.v1.Block.header:type_name -> sf.acme.type.v1.BlockHeader
-	2, // 1: sf.acme.type.v1.Block.transactions:type_name -> sf.acme.type.v1.Transaction
-	5, // 2: sf.acme.type.v1.Transaction.amount:type_name -> sf.acme.type.v1.BigInt
-	5, // 3: sf.acme.type.v1.Transaction.fee:type_name -> sf.acme.type.v1.BigInt
-	3, // 4: sf.acme.type.v1.Transaction.events:type_name -> sf.acme.type.v1.Event
-	4, // 5: sf.acme.type.v1.Event.attributes:type_name -> sf.acme.type.v1.Attribute
-	6, // [6:6] is the sub-list for method output_type
-	6, // [6:6] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+	4, // 0: sf.acme.type.v1.BlockHeader.extra_fields:type_name -> sf.acme.type.v1.Attribute
+	0, // 1: sf.acme.type.v1.Block.header:type_name -> sf.acme.type.v1.BlockHeader
+	2, // 2: sf.acme.type.v1.Block.transactions:type_name -> sf.acme.type.v1.Transaction
+	5, // 3: sf.acme.type.v1.Transaction.amount:type_name -> sf.acme.type.v1.BigInt
+	5, // 4: sf.acme.type.v1.Transaction.fee:type_name -> sf.acme.type.v1.BigInt
+	3, // 5: sf.acme.type.v1.Transaction.events:type_name -> sf.acme.type.v1.Event
+	4, // 6: sf.acme.type.v1.Event.attributes:type_name -> sf.acme.type.v1.Attribute
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_sf_acme_type_v1_type_proto_init() }
@@ -0,0 +1,141 @@
+package tracer
+
+import (
+	"errors"
+	"fmt"
+
+	pbacme "github.com/streamingfast/dummy-blockchain/pb/sf/acme/type/v1"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+// ErrCallOrder is matched by the errors of the tracers called out of order, like a transaction
+// started outside of a block.
+var ErrCallOrder = errors.New("tracer called out of order")
+
+// acmeBlockBuilder assembles the `sf.acme.type.v1.Block` Protobuf model out of the tracer
+// callbacks, it's shared by the tracers emitting blocks in this format.
+type acmeBlockBuilder struct {
+	activeBlock *pbacme.Block
+	activeTrx   *pbacme.Transaction
+}
+
+func (b *acmeBlockBuilder) startBlock(header *types.BlockHeader) error {
+	if b.activeBlock != nil {
+		return fmt.Errorf("%w: block #%d started while block #%d is active", ErrCallOrder, header.Height, b.activeBlock.Header.Height)
+	}
+
+	b.activeBlock = &pbacme.Block{
+		Header: &pbacme.BlockHeader{
+			Height:          header.Height,
+			Hash:            header.Hash,
+			FinalNum:        header.FinalNum,
+			FinalHash:       header.FinalHash,
+			Timestamp:       header.Timestamp.UnixNano(),
+			ProtocolVersion: header.ProtocolVersion,
+			SkippedSlots:    header.SkippedSlots,
+
+			TransactionsRoot: header.TransactionsRoot,
+			StateRoot:        header.StateRoot,
+			Proposer:         header.Proposer,
+			GasUsed:          header.GasUsed,
+			GasLimit:         header.GasLimit,
+			Size:             header.Size,
+			ExtraData:        header.ExtraData,
+			ProducerKey:      header.ProducerKey,
+			Signature:        header.Signature,
+
+			TransactionsOffset: header.TransactionsOffset,
+		},
+	}
+
+	if len(header.ExtraFields) > 0 {
+		b.activeBlock.Header.ExtraFields = make([]*pbacme.Attribute, len(header.ExtraFields))
+		for i, field := range header.ExtraFields {
+			b.activeBlock.Header.ExtraFields[i] = &pbacme.Attribute{Key: field.Key, Value: field.Value}
+		}
+	}
+
+	if header.PropagationTime != nil {
+		b.activeBlock.Header.PropagationTime = header.PropagationTime.UnixNano()
+	}
+
+	if header.PrevHash != nil && header.PrevNum != nil {
+		b.activeBlock.Header.PreviousNum = header.PrevNum
+		b.activeBlock.Header.PreviousHash = header.PrevHash
+	}
+
+	return nil
+}
+
+// endBlock returns the block built so far and resets the builder for the next one.
+func (b *acmeBlockBuilder) endBlock() (*pbacme.Block, error) {
+	if b.activeBlock == nil {
+		return nil, fmt.Errorf("%w: block ended without an active block", ErrCallOrder)
+	}
+	if b.activeTrx != nil {
+		return nil, fmt.Errorf("%w: block #%d ended while transaction %s is active", ErrCallOrder, b.activeBlock.Header.Height, b.activeTrx.Hash)
+	}
+
+	block := b.activeBlock
+	b.activeBlock = nil
+
+	return block, nil
+}
+
+func (b *acmeBlockBuilder) startTrx(trx *types.Transaction) error {
+	if b.activeBlock == nil {
+		return fmt.Errorf("%w: transaction %s started without an active block", ErrCallOrder, trx.Hash)
+	}
+	if b.activeTrx != nil {
+		return fmt.Errorf("%w: transaction %s started while transaction %s is active", ErrCallOrder, trx.Hash, b.activeTrx.Hash)
+	}
+
+	b.activeTrx = &pbacme.Transaction{
+		Type:     trx.Type,
+		Hash:     trx.Hash,
+		Sender:   trx.Sender,
+		Receiver: trx.Receiver,
+		Data:     trx.Data,
+		Amount:   &pbacme.BigInt{Bytes: trx.Amount.Bytes()},
+		Fee:      &pbacme.BigInt{Bytes: trx.Fee.Bytes()},
+	}
+
+	return nil
+}
+
+func (b *acmeBlockBuilder) addEvent(trxHash string, event *types.Event) error {
+	if b.activeTrx == nil {
+		return fmt.Errorf("%w: event of transaction %s added without an active transaction", ErrCallOrder, trxHash)
+	}
+
+	pbEvent := &pbacme.Event{
+		Type: event.Type,
+	}
+
+	if len(event.Attributes) > 0 {
+		pbEvent.Attributes = make([]*pbacme.Attribute, len(event.Attributes))
+		for i, attr := range event.Attributes {
+			pbEvent.Attributes[i] = &pbacme.Attribute{
+				Key:   attr.Key,
+				Value: attr.Value,
+			}
+		}
+	}
+
+	b.activeTrx.Events = append(b.activeTrx.Events, pbEvent)
+
+	return nil
+}
+
+func (b *acmeBlockBuilder) endTrx(trx *types.Transaction) error {
+	if b.activeTrx == nil {
+		return fmt.Errorf("%w: transaction %s ended without an active transaction", ErrCallOrder, trx.Hash)
+	}
+
+	b.activeTrx.Success = trx.Success
+
+	b.activeBlock.Transactions = append(b.activeBlock.Transactions, b.activeTrx)
+	b.activeTrx = nil
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package tracer
+
+import (
+	"crypto/ed25519"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	pbacme "github.com/streamingfast/dummy-blockchain/pb/sf/acme/type/v1"
+	"github.com/streamingfast/dummy-blockchain/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// buildAcmeBlock builds the Protobuf model of block the way the tracers do.
+func buildAcmeBlock(t *testing.T, block *types.Block) *pbacme.Block {
+	t.Helper()
+
+	var builder acmeBlockBuilder
+	if err := builder.startBlock(block.Header); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range block.Transactions {
+		trx := &block.Transactions[i]
+		if err := builder.startTrx(trx); err != nil {
+			t.Fatal(err)
+		}
+		for j := range trx.Events {
+			if err := builder.addEvent(trx.Hash, &trx.Events[j]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := builder.endTrx(trx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	acmeBlock, err := builder.endBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return acmeBlock
+}
+
+func TestAcmeBlock_ProtoSize(t *testing.T) {
+	zero, height := uint64(0), uint64(math.MaxUint64)
+	emptyHash, hash := "", types.MakeHash(1)
+	propagationTime := time.Unix(0, 1700000000123456789)
+	epoch := time.Unix(0, 0)
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := types.Transaction{
+		Type:     "transfer",
+		Hash:     types.MakeHash("trx"),
+		Sender:   "0xa",
+		Receiver: "0xb",
+		Amount:   big.NewInt(1),
+		Fee:      big.NewInt(1),
+	}
+
+	tests := []struct {
+		name  string
+		block *types.Block
+	}{
+		{"empty header", &types.Block{Header: &types.BlockHeader{}}},
+		{"genesis", types.GenesisBlock(&types.Genesis{Height: 10, Hash: hash, Time: propagationTime})},
+		{"zero parent", &types.Block{Header: &types.BlockHeader{Height: 1, PrevNum: &zero, PrevHash: &emptyHash}}},
+		{"parent", &types.Block{Header: &types.BlockHeader{Height: height, PrevNum: &height, PrevHash: &hash, FinalNum: height - 1, FinalHash: hash}}},
+		{"timestamp before epoch", &types.Block{Header: &types.BlockHeader{Timestamp: time.Unix(-1, 0)}}},
+		{"extra fields", &types.Block{Header: &types.BlockHeader{
+			ProtocolVersion: 3,
+			ExtraFields:     []types.Attribute{{Key: "base_fee", Value: "7"}, {Key: "", Value: ""}, {Key: "ünïcode", Value: "✓"}},
+		}}},
+		{"propagation time", &types.Block{Header: &types.BlockHeader{PropagationTime: &propagationTime}}},
+		{"zero propagation time", &types.Block{Header: &types.BlockHeader{PropagationTime: &epoch}}},
+		{"sealed fields", &types.Block{Header: &types.BlockHeader{
+			SkippedSlots:       2,
+			TransactionsRoot:   hash,
+			StateRoot:          hash,
+			Proposer:           "0x1234",
+			GasUsed:            21_000,
+			GasLimit:           math.MaxUint64,
+			Size:               1 << 40,
+			ExtraData:          []byte{0, 1, 2},
+			ProducerKey:        key.Public().(ed25519.PublicKey),
+			Signature:          make([]byte, ed25519.SignatureSize),
+			TransactionsOffset: 300,
+		}}},
+		{"transactions", &types.Block{
+			Header: &types.BlockHeader{Height: 1},
+			Transactions: []types.Transaction{
+				transfer,
+				{Type: "transfer", Amount: new(big.Int), Fee: new(big.Int)},
+				{
+					Type:     "contract_call",
+					Hash:     hash,
+					Sender:   "0xa",
+					Receiver: "0xb",
+					Data:     make([]byte, 300),
+					Amount:   new(big.Int).Lsh(big.NewInt(1), 200),
+					Fee:      big.NewInt(math.MaxInt64),
+					Success:  true,
+					Events: []types.Event{
+						{Type: "transfer"},
+						{Type: "log", Attributes: []types.Attribute{{Key: "topic", Value: hash}, {Key: "data", Value: string(make([]byte, 200))}}},
+					},
+				},
+			},
+		}},
+		{"sealed signed block", func() *types.Block {
+			block := &types.Block{Header: &types.BlockHeader{Height: 12, PrevNum: &zero, PrevHash: &hash, GasLimit: 30_000_000}, Transactions: []types.Transaction{transfer, transfer}}
+			block.Seal(key)
+			return block
+		}()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := proto.Size(buildAcmeBlock(t, test.block))
+			if size := test.block.ProtoSize(); size != expected {
+				t.Errorf("ProtoSize is %d, proto.Size of the tracer block is %d", size, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tracer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ChaosKind is a corruption of the Firehose output injected by the chaos mode, each one
+// breaking an invariant a Firehose reader must enforce.
+type ChaosKind string
+
+const (
+	// ChaosBadPrevHash links a block to a parent hash that was never emitted.
+	ChaosBadPrevHash ChaosKind = "bad-prev-hash"
+
+	// ChaosFinalBackwards emits a final block number lower than a previously emitted one.
+	ChaosFinalBackwards ChaosKind = "final-backwards"
+
+	// ChaosDuplicateHeight emits the same block line twice.
+	ChaosDuplicateHeight ChaosKind = "duplicate-height"
+
+	// ChaosTruncatedPayload cuts the base64 payload of the block line in the middle.
+	ChaosTruncatedPayload ChaosKind = "truncated-payload"
+
+	// ChaosGarbagePayload replaces the payload of the block line by non base64 characters.
+	ChaosGarbagePayload ChaosKind = "garbage-payload"
+
+	// ChaosFlashIndexOrder emits a flash block with an out of order index, it applies to
+	// flash blocks only (protocol 3.1).
+	ChaosFlashIndexOrder ChaosKind = "flash-index-order"
+
+	// ChaosUnknownSignal emits a signal for a block hash that was never emitted.
+	ChaosUnknownSignal ChaosKind = "unknown-signal"
+)
+
+var chaosKinds = []ChaosKind{
+	ChaosBadPrevHash,
+	ChaosFinalBackwards,
+	ChaosDuplicateHeight,
+	ChaosTruncatedPayload,
+	ChaosGarbagePayload,
+	ChaosFlashIndexOrder,
+	ChaosUnknownSignal,
+}
+
+// ChaosTrigger decides when a chaos kind is injected, at random with Probability for each
+// eligible line and/or on schedule, at the heights multiple of Every and at the listed
+// Heights. A scheduled kind is injected once per height even when several lines have it
+// (forks and flash blocks).
+type ChaosTrigger struct {
+	Probability float64
+	Every       uint64
+	Heights     []uint64
+}
+
+// Chaos injects corruptions in the output of a FirehoseTracer so that readers can be tested
+// against bad input. The zero value injects nothing.
+type Chaos struct {
+	triggers map[ChaosKind]ChaosTrigger
+	random   *rand.Rand
+
+	// Last height each scheduled kind was injected at
+	scheduled map[ChaosKind]uint64
+}
+
+// NewChaos creates a chaos injecting each kind of triggers, random injections being drawn
+// from seed.
+func NewChaos(triggers map[ChaosKind]ChaosTrigger, seed uint64) *Chaos {
+	return &Chaos{
+		triggers:  triggers,
+		random:    rand.New(rand.NewPCG(seed, seed)),
+		scheduled: make(map[ChaosKind]uint64),
+	}
+}
+
+// ParseChaos parses a comma-separated list of `<kind>=<trigger>`, the trigger being either a
+// probability (e.g. `0.01`), `every:<n>` to inject at heights multiple of n or
+// `at:<height>[:<height>...]` to inject at the listed heights. An empty spec returns nil.
+func ParseChaos(spec string, seed uint64) (*Chaos, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	triggers := make(map[ChaosKind]ChaosTrigger)
+	for _, entry := range strings.Split(spec, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		kind := ChaosKind(name)
+		if !slices.Contains(chaosKinds, kind) {
+			return nil, fmt.Errorf("unknown chaos kind %q, valid values are %s", name, joinChaosKinds())
+		}
+
+		if !found {
+			return nil, fmt.Errorf("chaos kind %q requires a trigger, either a probability, every:<n> or at:<height>[:<height>...]", name)
+		}
+
+		trigger, err := parseChaosTrigger(value)
+		if err != nil {
+			return nil, fmt.Errorf("chaos kind %q: %w", name, err)
+		}
+		triggers[kind] = trigger
+	}
+
+	return NewChaos(triggers, seed), nil
+}
+
+func parseChaosTrigger(in string) (ChaosTrigger, error) {
+	switch {
+	case strings.HasPrefix(in, "every:"):
+		every, err := strconv.ParseUint(strings.TrimPrefix(in, "every:"), 10, 64)
+		if err != nil || every == 0 {
+			return ChaosTrigger{}, fmt.Errorf("'every' requires a height interval greater than 0, got %q", in)
+		}
+		return ChaosTrigger{Every: every}, nil
+
+	case strings.HasPrefix(in, "at:"):
+		var heights []uint64
+		for _, value := range strings.Split(strings.TrimPrefix(in, "at:"), ":") {
+			height, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return ChaosTrigger{}, fmt.Errorf("'at' requires ':' separated heights, got %q", in)
+			}
+			heights = append(heights, height)
+		}
+		return ChaosTrigger{Heights: heights}, nil
+	}
+
+	probability, err := strconv.ParseFloat(in, 64)
+	if err != nil || probability <= 0 || probability > 1 {
+		return ChaosTrigger{}, fmt.Errorf("expected a probability in ]0, 1], every:<n> or at:<height>[:<height>...], got %q", in)
+	}
+
+	return ChaosTrigger{Probability: probability}, nil
+}
+
+func joinChaosKinds() string {
+	names := make([]string, len(chaosKinds))
+	for i, kind := range chaosKinds {
+		names[i] = string(kind)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// inject returns whether kind is injected in the line of the block at height, logging it.
+func (c *Chaos) inject(kind ChaosKind, height uint64) bool {
+	if c == nil || !c.triggered(kind, height) {
+		return false
+	}
+
+	logrus.WithField("kind", kind).WithField("height", height).Warn("chaos: injecting corrupted firehose output")
+	return true
+}
+
+func (c *Chaos) triggered(kind ChaosKind, height uint64) bool {
+	trigger, found := c.triggers[kind]
+	if !found {
+		return false
+	}
+
+	if (trigger.Every > 0 && height%trigger.Every == 0) || slices.Contains(trigger.Heights, height) {
+		if last, injected := c.scheduled[kind]; !injected || last != height {
+			c.scheduled[kind] = height
+			return true
+		}
+	}
+
+	return trigger.Probability > 0 && c.random.Float64() < trigger.Probability
+}
+
+// randomHash returns a hash that was never emitted.
+func (c *Chaos) randomHash() string {
+	hash := make([]byte, 32)
+	for i := range hash {
+		hash[i] = byte(c.random.Uint32())
+	}
+
+	return hex.EncodeToString(hash)
+}
@@ -1,10 +1,13 @@
 package tracer
 
 import (
+	"bufio"
 	"encoding/base64"
 	"fmt"
-	"time"
+	"io"
+	"os"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/sirupsen/logrus"
 	pbacme "github.com/streamingfast/dummy-blockchain/pb/sf/acme/type/v1"
 	"github.com/streamingfast/dummy-blockchain/types"
@@ -13,11 +16,64 @@ import (
 
 var _ Tracer = &FirehoseTracer{}
 
+// PayloadCompression is the codec applied to the block payload before it's base64 encoded
+// in the `FIRE BLOCK` line. When not none, the codec is announced as an extra field of the
+// `FIRE INIT` line, so it must only be used with a reader supporting it.
+type PayloadCompression string
+
+const (
+	PayloadCompressionNone PayloadCompression = "none"
+	PayloadCompressionZstd PayloadCompression = "zstd"
+)
+
+func ParsePayloadCompression(in string) (PayloadCompression, error) {
+	switch PayloadCompression(in) {
+	case "", PayloadCompressionNone:
+		return PayloadCompressionNone, nil
+	case PayloadCompressionZstd:
+		return PayloadCompressionZstd, nil
+	}
+
+	return "", fmt.Errorf("unknown payload compression %q, valid values are none and zstd", in)
+}
+
 type FirehoseTracer struct {
-	activeBlock           *pbacme.Block
-	activeTrx             *pbacme.Transaction
+	out                   *bufio.Writer
+	compression           PayloadCompression
+	zstdEncoder           *zstd.Encoder
+	builder               acmeBlockBuilder
 	withFlashBlocks       bool
 	activeBlockFlashIndex int32
+	chaos                 *Chaos
+	lastFinalNum          uint64
+
+	// Buffers re-used from one block to the other so that big blocks do not
+	// allocate their full size again each time they are printed.
+	payloadBuffer    []byte
+	compressedBuffer []byte
+}
+
+// NewFirehoseTracer creates a tracer printing Firehose protocol lines to out, block payloads
+// being compressed with the given codec. The zero value FirehoseTracer is also valid and
+// prints uncompressed payloads to standard output.
+func NewFirehoseTracer(out io.Writer, compression PayloadCompression) *FirehoseTracer {
+	return &FirehoseTracer{
+		out:         bufio.NewWriterSize(out, 64*1024),
+		compression: compression,
+	}
+}
+
+// SetChaos makes the tracer inject the corruptions of chaos in its output, nil disables it.
+func (t *FirehoseTracer) SetChaos(chaos *Chaos) {
+	t.chaos = chaos
+}
+
+func (t *FirehoseTracer) writer() *bufio.Writer {
+	if t.out == nil {
+		t.out = bufio.NewWriterSize(os.Stdout, 64*1024)
+	}
+
+	return t.out
 }
 
 // Initialize implements Tracer.
@@ -25,17 +81,63 @@ func (t *FirehoseTracer) Initialize(version string) error {
 	if version == "3.1" {
 		t.withFlashBlocks = true
 	}
-	fmt.Printf("FIRE INIT %s %s\n", version, new(pbacme.Block).ProtoReflect().Descriptor().FullName())
-	return nil
+
+	out := t.writer()
+	fmt.Fprintf(out, "FIRE INIT %s %s", version, new(pbacme.Block).ProtoReflect().Descriptor().FullName())
+
+	switch t.compression {
+	case "", PayloadCompressionNone:
+	case PayloadCompressionZstd:
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("new zstd encoder: %w", err)
+		}
+
+		t.zstdEncoder = encoder
+		fmt.Fprintf(out, " %s", t.compression)
+	default:
+		return fmt.Errorf("unknown payload compression %q", t.compression)
+	}
+
+	out.WriteByte('\n')
+	return out.Flush()
 }
 
 // OnBlockEnd implements Tracer.
-func (t *FirehoseTracer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) {
-	if t.activeBlock == nil {
-		panic(fmt.Errorf("no active block, something is wrong in the tracer call order"))
+func (t *FirehoseTracer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) error {
+	return t.endBlock(0)
+}
+
+// OnFlashBlockEnd implements Tracer.
+func (t *FirehoseTracer) OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, flashBlockIndex int32) error {
+	return t.endBlock(flashBlockIndex)
+}
+
+func (t *FirehoseTracer) endBlock(flashBlockIndex int32) error {
+	block, err := t.builder.endBlock()
+	if err != nil {
+		return err
 	}
+	header := block.Header
 
-	header := t.activeBlock.Header
+	// Chaos corrupting the block itself applies to full blocks, flash blocks have their own
+	fullBlock := flashBlockIndex == 0
+	if fullBlock && header.PreviousHash != nil && t.chaos.inject(ChaosBadPrevHash, header.Height) {
+		badHash := t.chaos.randomHash()
+		header.PreviousHash = &badHash
+	}
+	if fullBlock && t.lastFinalNum > 0 && t.chaos.inject(ChaosFinalBackwards, header.Height) {
+		header.FinalNum = t.lastFinalNum - 1
+	}
+	t.lastFinalNum = max(t.lastFinalNum, header.FinalNum)
+
+	if t.withFlashBlocks && !fullBlock && t.chaos.inject(ChaosFlashIndexOrder, header.Height) {
+		if flashBlockIndex >= 1000 {
+			flashBlockIndex = 1000 // final with index 0, never above the previous ones
+		} else {
+			flashBlockIndex++
+		}
+	}
 
 	previousNum := uint64(0)
 	if header.PreviousNum != nil {
@@ -47,156 +149,117 @@ func (t *FirehoseTracer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.Bl
 		previousHash = *header.PreviousHash
 	}
 
-	blockPayload, err := proto.Marshal(t.activeBlock)
+	blockPayload, err := proto.MarshalOptions{}.MarshalAppend(t.payloadBuffer[:0], block)
 	if err != nil {
-		panic(fmt.Errorf("unable to marshal block: %w", err))
+		return fmt.Errorf("unable to marshal block: %w", err)
 	}
+	t.payloadBuffer = blockPayload
 
 	logrus.WithField("proto_size", len(blockPayload)).Debug("marshalled block to proto")
 
-	t.printBlock(header, previousNum, previousHash, base64.StdEncoding.EncodeToString(blockPayload), 0)
+	if t.zstdEncoder != nil {
+		blockPayload = t.zstdEncoder.EncodeAll(blockPayload, t.compressedBuffer[:0])
+		t.compressedBuffer = blockPayload
+	}
+
+	if err := t.printBlock(header, previousNum, previousHash, blockPayload, flashBlockIndex); err != nil {
+		return fmt.Errorf("unable to print block: %w", err)
+	}
+
+	if fullBlock && t.chaos.inject(ChaosDuplicateHeight, header.Height) {
+		if err := t.printBlock(header, previousNum, previousHash, blockPayload, flashBlockIndex); err != nil {
+			return fmt.Errorf("unable to print block: %w", err)
+		}
+	}
 
-	t.activeBlock = nil
-	t.activeTrx = nil
+	return nil
 }
 
-func (t *FirehoseTracer) printBlock(header *pbacme.BlockHeader, prevNum uint64, prevHash string, blockPayload string, flashBlockIndex int32) {
-	now := time.Now()
+// printBlock writes the `FIRE BLOCK` line, the payload being base64 encoded straight into
+// the output instead of being first converted to a (potentially huge) string.
+func (t *FirehoseTracer) printBlock(header *pbacme.BlockHeader, prevNum uint64, prevHash string, blockPayload []byte, flashBlockIndex int32) error {
+	out := t.writer()
+
 	if t.withFlashBlocks {
-		fmt.Printf("FIRE BLOCK %d %d %s %d %s %d %d %s\n",
+		fmt.Fprintf(out, "FIRE BLOCK %d %d %s %d %s %d %d ",
 			header.Height,
 			flashBlockIndex,
 			header.Hash,
 			prevNum,
 			prevHash,
 			header.FinalNum,
-			now.UnixNano(), //override timestamp so we can see the real time of block propagation through substreams stack
-			blockPayload,
+			header.Timestamp,
 		)
 	} else {
-		fmt.Printf("FIRE BLOCK %d %s %d %s %d %d %s\n",
+		fmt.Fprintf(out, "FIRE BLOCK %d %s %d %s %d %d ",
 			header.Height,
 			header.Hash,
 			prevNum,
 			prevHash,
 			header.FinalNum,
-			now.UnixNano(), //override timestamp so we can see the real time of block propagation through substreams stack
-			blockPayload,
+			header.Timestamp,
 		)
 	}
-}
-
-// OnFlashBlockEnd implements Tracer.
-func (t *FirehoseTracer) OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, flashBlockIndex int32) {
-	if t.activeBlock == nil {
-		panic(fmt.Errorf("no active block, something is wrong in the tracer call order"))
-	}
-
-	header := t.activeBlock.Header
-
-	previousNum := uint64(0)
-	if header.PreviousNum != nil {
-		previousNum = *header.PreviousNum
-	}
 
-	previousHash := ""
-	if header.PreviousHash != nil {
-		previousHash = *header.PreviousHash
-	}
+	switch {
+	case flashBlockIndex == 0 && t.chaos.inject(ChaosTruncatedPayload, header.Height):
+		// An odd length is never valid base64, whatever the payload
+		encoded := base64.StdEncoding.EncodeToString(blockPayload)
+		out.WriteString(encoded[:len(encoded)/2|1])
+	case flashBlockIndex == 0 && t.chaos.inject(ChaosGarbagePayload, header.Height):
+		out.WriteString("!garbage!" + t.chaos.randomHash())
+	default:
+		encoder := base64.NewEncoder(base64.StdEncoding, out)
+		if _, err := encoder.Write(blockPayload); err != nil {
+			return err
+		}
 
-	blockPayload, err := proto.Marshal(t.activeBlock)
-	if err != nil {
-		panic(fmt.Errorf("unable to marshal block: %w", err))
+		if err := encoder.Close(); err != nil {
+			return err
+		}
 	}
-	t.printBlock(header, previousNum, previousHash, base64.StdEncoding.EncodeToString(blockPayload), flashBlockIndex)
 
-	t.activeBlock = nil
-	t.activeTrx = nil
+	out.WriteByte('\n')
+	return out.Flush()
 }
 
 // OnFlashBlockStart implements Tracer.
-func (t *FirehoseTracer) OnFlashBlockStart(header *types.BlockHeader) {
-	t.OnBlockStart(header)
+func (t *FirehoseTracer) OnFlashBlockStart(header *types.BlockHeader) error {
+	return t.OnBlockStart(header)
 }
 
 // OnBlockStart implements Tracer.
-func (t *FirehoseTracer) OnBlockStart(header *types.BlockHeader) {
-	if t.activeBlock != nil {
-		panic(fmt.Errorf("block already started, something is wrong in the tracer call order"))
-	}
-
-	t.activeBlock = &pbacme.Block{
-		Header: &pbacme.BlockHeader{
-			Height:    header.Height,
-			Hash:      header.Hash,
-			FinalNum:  header.FinalNum,
-			FinalHash: header.FinalHash,
-			Timestamp: header.Timestamp.UnixNano(),
-		},
-	}
+func (t *FirehoseTracer) OnBlockStart(header *types.BlockHeader) error {
+	return t.builder.startBlock(header)
+}
 
-	if header.PrevHash != nil && header.PrevNum != nil {
-		t.activeBlock.Header.PreviousNum = header.PrevNum
-		t.activeBlock.Header.PreviousHash = header.PrevHash
+// OnCommitmentSignal implements Tracer.
+func (t *FirehoseTracer) OnCommitmentSignal(sig *types.Signal) error {
+	blockID := sig.BlockID
+	if t.chaos.inject(ChaosUnknownSignal, sig.BlockNumber) {
+		blockID = t.chaos.randomHash()
 	}
-}
 
-func (t *FirehoseTracer) OnCommitmentSignal(sig *types.Signal) {
-	fmt.Printf("FIRE SIGNAL 1 %d %s %d\n",
+	out := t.writer()
+	fmt.Fprintf(out, "FIRE SIGNAL 1 %d %s %d\n",
 		sig.BlockNumber,
-		sig.BlockID,
+		blockID,
 		sig.CommitmentLevel,
 	)
+	return out.Flush()
 }
 
 // OnTrxStart implements Tracer.
-func (t *FirehoseTracer) OnTrxStart(trx *types.Transaction) {
-	if t.activeTrx != nil {
-		panic(fmt.Errorf("transaction already started, something is wrong in the tracer call order"))
-	}
-
-	t.activeTrx = &pbacme.Transaction{
-		Type:     trx.Type,
-		Hash:     trx.Hash,
-		Sender:   trx.Sender,
-		Receiver: trx.Receiver,
-		Data:     trx.Data,
-		Amount:   &pbacme.BigInt{Bytes: trx.Amount.Bytes()},
-		Fee:      &pbacme.BigInt{Bytes: trx.Fee.Bytes()},
-	}
+func (t *FirehoseTracer) OnTrxStart(trx *types.Transaction) error {
+	return t.builder.startTrx(trx)
 }
 
 // OnTrxEvent implements Tracer.
-func (t *FirehoseTracer) OnTrxEvent(trxHash string, event *types.Event) {
-	if t.activeTrx == nil {
-		panic(fmt.Errorf("no active transaction, something is wrong in the tracer call order"))
-	}
-
-	pbEvent := &pbacme.Event{
-		Type: event.Type,
-	}
-
-	if len(event.Attributes) > 0 {
-		pbEvent.Attributes = make([]*pbacme.Attribute, len(event.Attributes))
-		for i, attr := range event.Attributes {
-			pbEvent.Attributes[i] = &pbacme.Attribute{
-				Key:   attr.Key,
-				Value: attr.Value,
-			}
-		}
-	}
-
-	t.activeTrx.Events = append(t.activeTrx.Events, pbEvent)
+func (t *FirehoseTracer) OnTrxEvent(trxHash string, event *types.Event) error {
+	return t.builder.addEvent(trxHash, event)
 }
 
 // OnTrxEnd implements Tracer.
-func (t *FirehoseTracer) OnTrxEnd(trx *types.Transaction) {
-	if t.activeTrx == nil {
-		panic(fmt.Errorf("no active transaction, something is wrong in the tracer call order"))
-	}
-
-	t.activeTrx.Success = trx.Success
-
-	t.activeBlock.Transactions = append(t.activeBlock.Transactions, t.activeTrx)
-	t.activeTrx = nil
+func (t *FirehoseTracer) OnTrxEnd(trx *types.Transaction) error {
+	return t.builder.endTrx(trx)
 }
@@ -0,0 +1,111 @@
+package tracer_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/dustin/go-humanize"
+	"github.com/streamingfast/dummy-blockchain/core"
+	"github.com/streamingfast/dummy-blockchain/tracer"
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+func TestFirehoseTracer_CallOrder(t *testing.T) {
+	block := core.NewSampleBlock(1, 4*humanize.KiByte)
+	trx := &block.Transactions[0]
+
+	tests := []struct {
+		name  string
+		calls func(tracer.Tracer) error
+	}{
+		{"block ended without start", func(blockTracer tracer.Tracer) error {
+			return blockTracer.OnBlockEnd(block, block.Header)
+		}},
+		{"block started twice", func(blockTracer tracer.Tracer) error {
+			return errors.Join(blockTracer.OnBlockStart(block.Header), blockTracer.OnBlockStart(block.Header))
+		}},
+		{"transaction outside of a block", func(blockTracer tracer.Tracer) error {
+			return blockTracer.OnTrxStart(trx)
+		}},
+		{"event outside of a transaction", func(blockTracer tracer.Tracer) error {
+			return errors.Join(blockTracer.OnBlockStart(block.Header), blockTracer.OnTrxEvent(trx.Hash, &types.Event{Type: "log"}))
+		}},
+		{"transaction ended without start", func(blockTracer tracer.Tracer) error {
+			return errors.Join(blockTracer.OnBlockStart(block.Header), blockTracer.OnTrxEnd(trx))
+		}},
+		{"block ended within a transaction", func(blockTracer tracer.Tracer) error {
+			return errors.Join(blockTracer.OnBlockStart(block.Header), blockTracer.OnTrxStart(trx), blockTracer.OnBlockEnd(block, block.Header))
+		}},
+		{"block traced within a block", func(blockTracer tracer.Tracer) error {
+			return errors.Join(blockTracer.OnBlockStart(block.Header), tracer.TraceBlock(blockTracer, block, block.Header))
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blockTracer := tracer.NewFirehoseTracer(io.Discard, tracer.PayloadCompressionNone)
+			if err := blockTracer.Initialize("3.0"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := test.calls(blockTracer); !errors.Is(err, tracer.ErrCallOrder) {
+				t.Errorf("expected a call order error, got %v", err)
+			}
+		})
+	}
+
+	// A block traced in order has no error
+	blockTracer := tracer.NewFirehoseTracer(io.Discard, tracer.PayloadCompressionNone)
+	if err := blockTracer.Initialize("3.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.TraceBlock(blockTracer, block, block.Header); err != nil {
+		t.Errorf("trace block: %s", err)
+	}
+}
+
+// BenchmarkFirehoseTracer_OnBlockEnd measures the encoding of a full block, from its start to
+// its `FIRE BLOCK` line, the payload being marshalled, compressed and base64 encoded when the
+// block ends.
+func BenchmarkFirehoseTracer_OnBlockEnd(b *testing.B) {
+	sizes := []struct {
+		name  string
+		bytes int
+	}{
+		{"1MiB", 1 * humanize.MiByte},
+		{"10MiB", 10 * humanize.MiByte},
+		{"100MiB", 100 * humanize.MiByte},
+	}
+
+	for _, size := range sizes {
+		b.Run("size="+size.name, func(b *testing.B) {
+			block := core.NewSampleBlock(1, size.bytes)
+
+			for _, compression := range []tracer.PayloadCompression{tracer.PayloadCompressionNone, tracer.PayloadCompressionZstd} {
+				b.Run(fmt.Sprintf("compression=%s", compression), func(b *testing.B) {
+					blockTracer := tracer.NewFirehoseTracer(io.Discard, compression)
+					if err := blockTracer.Initialize("3.0"); err != nil {
+						b.Fatal(err)
+					}
+
+					// Warm-up so that re-used buffers are sized
+					if err := tracer.TraceBlock(blockTracer, block, block.Header); err != nil {
+						b.Fatal(err)
+					}
+
+					b.SetBytes(int64(size.bytes))
+					b.ReportAllocs()
+					b.ResetTimer()
+
+					for range b.N {
+						if err := tracer.TraceBlock(blockTracer, block, block.Header); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package tracer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	pbacme "github.com/streamingfast/dummy-blockchain/pb/sf/acme/type/v1"
+	"github.com/streamingfast/dummy-blockchain/types"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ Tracer = &MergedBlocksTracer{}
+
+// MergedBlocksBundleSize is the amount of heights contained in a merged blocks file.
+const MergedBlocksBundleSize = 100
+
+// The merged blocks files are `dbin` containers of `sf.bstream.v1.Block` messages, the
+// format read by the Firehose `bstream` library: a header made of the magic bytes, the
+// format version and the content type, followed by length-prefixed messages.
+const (
+	dbinMagic       = "dbin"
+	dbinVersion     = 1
+	dbinContentType = "type.googleapis.com/sf.bstream.v1.Block"
+)
+
+// MergedBlocksTracer writes Firehose merged blocks files (`<base>.dbin.zst`, 100 blocks
+// each) to a local directory, like the Firehose merger would. A bundle is written once all
+// its heights are irreversible and only contains the canonical blocks, forked ones are
+// dropped. Flash blocks are ignored, only full blocks end up in merged blocks.
+type MergedBlocksTracer struct {
+	dir     string
+	builder acmeBlockBuilder
+
+	// pending holds the traced blocks not yet written keyed by hash, the canonical ones are
+	// found by walking the parent links from the final block.
+	pending    map[string]*mergedBlock
+	nextBundle uint64
+	started    bool
+}
+
+type mergedBlock struct {
+	number     uint64
+	parentHash string
+	message    []byte
+}
+
+func NewMergedBlocksTracer(dir string) *MergedBlocksTracer {
+	return &MergedBlocksTracer{
+		dir:     dir,
+		pending: make(map[string]*mergedBlock),
+	}
+}
+
+// Initialize implements Tracer.
+func (t *MergedBlocksTracer) Initialize(version string) error {
+	return os.MkdirAll(t.dir, 0755)
+}
+
+// OnBlockStart implements Tracer.
+func (t *MergedBlocksTracer) OnBlockStart(header *types.BlockHeader) error {
+	return t.builder.startBlock(header)
+}
+
+// OnFlashBlockStart implements Tracer.
+func (t *MergedBlocksTracer) OnFlashBlockStart(header *types.BlockHeader) error {
+	return t.builder.startBlock(header)
+}
+
+// OnTrxStart implements Tracer.
+func (t *MergedBlocksTracer) OnTrxStart(trx *types.Transaction) error {
+	return t.builder.startTrx(trx)
+}
+
+// OnTrxEvent implements Tracer.
+func (t *MergedBlocksTracer) OnTrxEvent(trxHash string, event *types.Event) error {
+	return t.builder.addEvent(trxHash, event)
+}
+
+// OnTrxEnd implements Tracer.
+func (t *MergedBlocksTracer) OnTrxEnd(trx *types.Transaction) error {
+	return t.builder.endTrx(trx)
+}
+
+// OnCommitmentSignal implements Tracer.
+func (t *MergedBlocksTracer) OnCommitmentSignal(sig *types.Signal) error {
+	return nil
+}
+
+// OnFlashBlockEnd implements Tracer.
+func (t *MergedBlocksTracer) OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, idx int32) error {
+	_, err := t.builder.endBlock()
+	return err
+}
+
+// OnBlockEnd implements Tracer.
+func (t *MergedBlocksTracer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) error {
+	block, err := t.builder.endBlock()
+	if err != nil {
+		return err
+	}
+
+	if !t.started {
+		t.started = true
+		t.nextBundle = bundleBase(block.Header.Height)
+
+		// A bundle is only complete when it starts at its boundary or at the genesis block
+		if block.Header.Height != t.nextBundle && block.Header.PreviousNum != nil {
+			t.nextBundle += MergedBlocksBundleSize
+			logrus.
+				WithField("block", block.Header.Height).
+				WithField("first_bundle", t.nextBundle).
+				Warn("first traced block is in the middle of a merged blocks bundle, skipping it")
+		}
+	}
+
+	if block.Header.Height < t.nextBundle {
+		return nil
+	}
+
+	message, err := marshalBstreamBlock(block)
+	if err != nil {
+		return fmt.Errorf("unable to marshal bstream block: %w", err)
+	}
+
+	t.pending[block.Header.Hash] = &mergedBlock{
+		number:     block.Header.Height,
+		parentHash: block.Header.GetPreviousHash(),
+		message:    message,
+	}
+
+	if err := t.writeIrreversibleBundles(block.Header.FinalNum, block.Header.FinalHash); err != nil {
+		return fmt.Errorf("unable to write merged blocks: %w", err)
+	}
+
+	return nil
+}
+
+// writeIrreversibleBundles writes all the bundles whose heights are all below or at the
+// final block.
+func (t *MergedBlocksTracer) writeIrreversibleBundles(finalNum uint64, finalHash string) error {
+	for finalNum >= t.nextBundle+MergedBlocksBundleSize-1 {
+		if _, found := t.pending[finalHash]; !found {
+			// Final block was not traced by us (restart before the first bundle), nothing to
+			// anchor the canonical chain on yet.
+			return nil
+		}
+
+		var canonical []*mergedBlock
+		for hash := finalHash; ; {
+			block, found := t.pending[hash]
+			if !found || block.number < t.nextBundle {
+				break
+			}
+
+			if block.number < t.nextBundle+MergedBlocksBundleSize {
+				canonical = append(canonical, block)
+			}
+			hash = block.parentHash
+		}
+		slices.Reverse(canonical)
+
+		if err := t.writeBundle(t.nextBundle, canonical); err != nil {
+			return err
+		}
+
+		t.nextBundle += MergedBlocksBundleSize
+		for hash, block := range t.pending {
+			if block.number < t.nextBundle {
+				delete(t.pending, hash)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *MergedBlocksTracer) writeBundle(base uint64, blocks []*mergedBlock) error {
+	filename := filepath.Join(t.dir, MergedBlocksFilename(base))
+
+	// Written to a temporary file first so that readers never see a partial bundle
+	tmpFilename := filename + ".tmp"
+	if err := writeDbinFile(tmpFilename, blocks); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return err
+	}
+
+	logrus.WithField("file", filename).WithField("blocks", len(blocks)).Debug("wrote merged blocks bundle")
+	return nil
+}
+
+func writeDbinFile(filename string, blocks []*mergedBlock) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder, err := zstd.NewWriter(file)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriterSize(encoder, 64*1024)
+	out.WriteString(dbinMagic)
+	out.WriteByte(dbinVersion)
+	out.Write(binary.BigEndian.AppendUint16(nil, uint16(len(dbinContentType))))
+	out.WriteString(dbinContentType)
+
+	for _, block := range blocks {
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(len(block.message))))
+		out.Write(block.message)
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// MergedBlocksFilename returns the name of the merged blocks file starting at base.
+func MergedBlocksFilename(base uint64) string {
+	return fmt.Sprintf("%010d.dbin.zst", base)
+}
+
+func bundleBase(height uint64) uint64 {
+	return height - height%MergedBlocksBundleSize
+}
+
+// marshalBstreamBlock encodes the `sf.bstream.v1.Block` message wrapping the block, the
+// bstream module not being a dependency of this project, it's encoded by hand.
+func marshalBstreamBlock(block *pbacme.Block) ([]byte, error) {
+	payload, err := proto.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := block.Header
+
+	var anyMessage []byte
+	anyMessage = protowire.AppendTag(anyMessage, 1, protowire.BytesType)
+	anyMessage = protowire.AppendString(anyMessage, "type.googleapis.com/"+string(block.ProtoReflect().Descriptor().FullName()))
+	anyMessage = protowire.AppendTag(anyMessage, 2, protowire.BytesType)
+	anyMessage = protowire.AppendBytes(anyMessage, payload)
+
+	var timestamp []byte
+	if seconds := header.Timestamp / 1e9; seconds != 0 {
+		timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+		timestamp = protowire.AppendVarint(timestamp, uint64(seconds))
+	}
+	if nanos := header.Timestamp % 1e9; nanos != 0 {
+		timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+		timestamp = protowire.AppendVarint(timestamp, uint64(nanos))
+	}
+
+	var out []byte
+	out = appendUint64Field(out, 1, header.Height)
+	out = appendStringField(out, 2, header.Hash)
+	out = appendStringField(out, 3, header.GetPreviousHash())
+	out = protowire.AppendTag(out, 4, protowire.BytesType)
+	out = protowire.AppendBytes(out, timestamp)
+	out = appendUint64Field(out, 5, header.FinalNum)
+	out = appendUint64Field(out, 10, header.GetPreviousNum())
+	out = protowire.AppendTag(out, 11, protowire.BytesType)
+	out = protowire.AppendBytes(out, anyMessage)
+
+	return out, nil
+}
+
+func appendUint64Field(out []byte, num protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return out
+	}
+
+	out = protowire.AppendTag(out, num, protowire.VarintType)
+	return protowire.AppendVarint(out, value)
+}
+
+func appendStringField(out []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return out
+	}
+
+	out = protowire.AppendTag(out, num, protowire.BytesType)
+	return protowire.AppendString(out, value)
+}
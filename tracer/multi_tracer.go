@@ -0,0 +1,110 @@
+package tracer
+
+import (
+	"github.com/streamingfast/dummy-blockchain/types"
+)
+
+var _ Tracer = MultiTracer{}
+
+// MultiTracer forwards every callback to each of its tracers, in order, stopping at the
+// first error.
+type MultiTracer []Tracer
+
+// Initialize implements Tracer.
+func (t MultiTracer) Initialize(version string) error {
+	for _, tracer := range t {
+		if err := tracer.Initialize(version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnBlockStart implements Tracer.
+func (t MultiTracer) OnBlockStart(header *types.BlockHeader) error {
+	for _, tracer := range t {
+		if err := tracer.OnBlockStart(header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnFlashBlockStart implements Tracer.
+func (t MultiTracer) OnFlashBlockStart(header *types.BlockHeader) error {
+	for _, tracer := range t {
+		if err := tracer.OnFlashBlockStart(header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnCommitmentSignal implements Tracer.
+func (t MultiTracer) OnCommitmentSignal(sig *types.Signal) error {
+	for _, tracer := range t {
+		if err := tracer.OnCommitmentSignal(sig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnTrxStart implements Tracer.
+func (t MultiTracer) OnTrxStart(trx *types.Transaction) error {
+	for _, tracer := range t {
+		if err := tracer.OnTrxStart(trx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnTrxEvent implements Tracer.
+func (t MultiTracer) OnTrxEvent(trxHash string, event *types.Event) error {
+	for _, tracer := range t {
+		if err := tracer.OnTrxEvent(trxHash, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnTrxEnd implements Tracer.
+func (t MultiTracer) OnTrxEnd(trx *types.Transaction) error {
+	for _, tracer := range t {
+		if err := tracer.OnTrxEnd(trx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnBlockEnd implements Tracer.
+func (t MultiTracer) OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) error {
+	for _, tracer := range t {
+		if err := tracer.OnBlockEnd(blk, finalBlockHeader); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OnFlashBlockEnd implements Tracer.
+func (t MultiTracer) OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, idx int32) error {
+	for _, tracer := range t {
+		if err := tracer.OnFlashBlockEnd(blk, finalBlockHeader, idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -4,22 +4,72 @@ import (
 	"github.com/streamingfast/dummy-blockchain/types"
 )
 
+// Tracer receives the callbacks of the blocks executed by the node. A callback returns an
+// error when the tracer can't go on, like when it's called out of order (ErrCallOrder) or
+// fails to write its output, the node then stops.
 type Tracer interface {
 	Initialize(version string) error
 
-	OnBlockStart(header *types.BlockHeader)
+	OnBlockStart(header *types.BlockHeader) error
 
-	OnFlashBlockStart(header *types.BlockHeader)
+	OnFlashBlockStart(header *types.BlockHeader) error
 
-	OnCommitmentSignal(sig *types.Signal)
+	OnCommitmentSignal(sig *types.Signal) error
 
-	OnTrxStart(trx *types.Transaction)
+	OnTrxStart(trx *types.Transaction) error
 
-	OnTrxEvent(trxHash string, event *types.Event)
+	OnTrxEvent(trxHash string, event *types.Event) error
 
-	OnTrxEnd(trx *types.Transaction)
+	OnTrxEnd(trx *types.Transaction) error
 
-	OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader)
+	OnBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader) error
 
-	OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, idx int32)
+	OnFlashBlockEnd(blk *types.Block, finalBlockHeader *types.BlockHeader, idx int32) error
+}
+
+// TraceBlock drives the tracer callbacks for a full block, in the order a node executing
+// it would call them, stopping at the first error.
+func TraceBlock(tracer Tracer, block *types.Block, finalBlockHeader *types.BlockHeader) error {
+	if err := tracer.OnBlockStart(block.Header); err != nil {
+		return err
+	}
+
+	if err := traceTransactions(tracer, block.Transactions); err != nil {
+		return err
+	}
+
+	return tracer.OnBlockEnd(block, finalBlockHeader)
+}
+
+// TraceFlashBlock drives the tracer callbacks for a flash block, stopping at the first error.
+func TraceFlashBlock(tracer Tracer, flashBlock *types.FlashBlock, finalBlockHeader *types.BlockHeader) error {
+	if err := tracer.OnFlashBlockStart(flashBlock.Block.Header); err != nil {
+		return err
+	}
+
+	if err := traceTransactions(tracer, flashBlock.Block.Transactions); err != nil {
+		return err
+	}
+
+	return tracer.OnFlashBlockEnd(flashBlock.Block, finalBlockHeader, flashBlock.Index)
+}
+
+func traceTransactions(tracer Tracer, transactions []types.Transaction) error {
+	for _, trx := range transactions {
+		if err := tracer.OnTrxStart(&trx); err != nil {
+			return err
+		}
+
+		for _, event := range trx.Events {
+			if err := tracer.OnTrxEvent(trx.Hash, &event); err != nil {
+				return err
+			}
+		}
+
+		if err := tracer.OnTrxEnd(&trx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,34 @@
+package types
+
+import "fmt"
+
+// AccumulateFlashBlock returns the transactions of the block at the height of flash once it's
+// applied on top of transactions, the ones accumulated from the previous flash blocks of that
+// height (none for the first one). The flash block holds either all the transactions so far or,
+// when it's a delta one, the ones from its TransactionsOffset on. It must extend transactions
+// and its header must commit to the accumulated transactions.
+func AccumulateFlashBlock(transactions []Transaction, flash *Block) ([]Transaction, error) {
+	header := flash.Header
+	offset := int(header.TransactionsOffset)
+	if offset > len(transactions) {
+		return nil, fmt.Errorf("%w #%d: flash block starts at transaction %d but only %d were received", ErrInvalidBlock, header.Height, offset, len(transactions))
+	}
+
+	if offset+len(flash.Transactions) < len(transactions) {
+		return nil, fmt.Errorf("%w #%d: flash block ends at transaction %d but %d were already received", ErrInvalidBlock, header.Height, offset+len(flash.Transactions), len(transactions))
+	}
+
+	// The transactions already received must be the same in the flash block
+	for i := offset; i < len(transactions); i++ {
+		if transactions[i].LeafHash() != flash.Transactions[i-offset].LeafHash() {
+			return nil, fmt.Errorf("%w #%d: flash block transaction %d differs from the one already received", ErrInvalidBlock, header.Height, i)
+		}
+	}
+
+	accumulated := append(transactions[:offset:offset], flash.Transactions...)
+	if err := header.verifyTransactions(accumulated); err != nil {
+		return nil, err
+	}
+
+	return accumulated, nil
+}
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"time"
+)
+
+// DefaultGenesisHash is the hash of the genesis block when none is configured.
+const DefaultGenesisHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// Genesis describes the first block of the chain and the initial state it sets, it's read
+// from the genesis file given to `init` and persisted in the store.
+type Genesis struct {
+	Height uint64    `json:"height"`
+	Hash   string    `json:"hash"`
+	Time   time.Time `json:"time"`
+
+	// Alloc maps account addresses to their initial balance, balances are JSON numbers of
+	// arbitrary precision. Each allocation is a transaction of the genesis block.
+	Alloc map[string]*big.Int `json:"alloc,omitempty"`
+
+	// Upgrades is the protocol upgrade schedule of the chain.
+	Upgrades []Upgrade `json:"upgrades,omitempty"`
+}
+
+// NewGenesis returns the default genesis at height 0 and the given time, without alloc.
+func NewGenesis(genesisTime time.Time) *Genesis {
+	return &Genesis{
+		Hash: DefaultGenesisHash,
+		Time: genesisTime,
+	}
+}
+
+// ReadGenesisFile reads a genesis JSON file, the hash defaults to DefaultGenesisHash and
+// the time to defaultTime when not set.
+func ReadGenesisFile(path string, defaultTime time.Time) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	genesis := &Genesis{}
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("decode genesis file %q: %w", path, err)
+	}
+
+	if genesis.Hash == "" {
+		genesis.Hash = DefaultGenesisHash
+	}
+
+	if genesis.Time.IsZero() {
+		genesis.Time = defaultTime
+	}
+
+	for address, balance := range genesis.Alloc {
+		if balance == nil || balance.Sign() < 0 {
+			return nil, fmt.Errorf("genesis alloc of account %q must be a positive number", address)
+		}
+	}
+
+	// Only the upgrades are validated here, the base rules come from the node configuration
+	if _, err := NewSchedule(genesis.Height, Rules{BlockRate: 1}, genesis.Upgrades); err != nil {
+		return nil, fmt.Errorf("genesis upgrades: %w", err)
+	}
+
+	return genesis, nil
+}
+
+// GenesisBlock returns the block at the genesis height, holding one `genesis_alloc`
+// transaction per allocated account, sorted by address.
+func GenesisBlock(genesis *Genesis) *Block {
+	header := &BlockHeader{
+		Height:    genesis.Height,
+		Hash:      genesis.Hash,
+		FinalNum:  genesis.Height,
+		FinalHash: genesis.Hash,
+		Timestamp: genesis.Time,
+	}
+
+	var transactions []Transaction
+	if len(genesis.Alloc) > 0 {
+		addresses := make([]string, 0, len(genesis.Alloc))
+		for address := range genesis.Alloc {
+			addresses = append(addresses, address)
+		}
+		slices.Sort(addresses)
+
+		transactions = make([]Transaction, len(addresses))
+		for i, address := range addresses {
+			balance := genesis.Alloc[address]
+			transactions[i] = Transaction{
+				Type:     "genesis_alloc",
+				Hash:     MakeHash(fmt.Sprintf("genesis_alloc:%s", address)),
+				Receiver: address,
+				Amount:   balance,
+				Fee:      new(big.Int),
+				Success:  true,
+				Events: []Event{
+					{Type: "genesis_alloc", Attributes: []Attribute{{Key: "account", Value: address}, {Key: "amount", Value: balance.String()}}},
+				},
+			}
+		}
+	}
+
+	return &Block{
+		Header:       header,
+		Transactions: transactions,
+	}
+}
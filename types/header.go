@@ -0,0 +1,252 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Gas used by transactions, it doesn't depend on the transaction data so that the gas used by
+// a block is known from its amount of transactions.
+const (
+	TransactionGas = 21_000
+	EventGas       = 375
+)
+
+// ErrInvalidBlock is matched by the errors of Block.Verify.
+var ErrInvalidBlock = errors.New("invalid block")
+
+// sealedHash and sealedSignature stand for the hashes, roots and signature of a header yet to
+// be sealed, they have a fixed length once sealed.
+var (
+	sealedHash      = strings.Repeat("0", 2*sha256.Size)
+	sealedSignature = make([]byte, ed25519.SignatureSize)
+)
+
+// Gas returns the gas used by the transaction.
+func (t *Transaction) Gas() uint64 {
+	return TransactionGas + EventGas*uint64(len(t.Events))
+}
+
+// GasUsed returns the gas used by transactions.
+func GasUsed(transactions []Transaction) uint64 {
+	gas := uint64(0)
+	for i := range transactions {
+		gas += transactions[i].Gas()
+	}
+
+	return gas
+}
+
+// Seal sets the header fields committing to the block content: the transactions root, the
+// gas used, the state root, the size and finally the hash computed over all of them. When key
+// is not nil, the block is signed by it and its producer key and proposer are set. The block
+// must not be modified afterwards.
+//
+// The chain has no real state, the state root commits to the parent block (and through its
+// hash, to the parent state) and to the transactions applied on top of it.
+func (b *Block) Seal(key ed25519.PrivateKey) {
+	b.seal(key, 0)
+}
+
+// SealFlashDelta seals the block like Seal, then only keeps its transactions from offset on,
+// making it a delta flash block: its header commits to all the transactions, the ones before
+// offset being held by the previous flash blocks.
+func (b *Block) SealFlashDelta(key ed25519.PrivateKey, offset int) {
+	b.seal(key, offset)
+}
+
+func (b *Block) seal(key ed25519.PrivateKey, offset int) {
+	header := b.Header
+	header.TransactionsRoot = TransactionsRoot(b.Transactions)
+	header.GasUsed = GasUsed(b.Transactions)
+	header.StateRoot = header.computeStateRoot()
+
+	header.TransactionsOffset = uint64(offset)
+	b.Transactions = b.Transactions[offset:]
+
+	header.ProducerKey, header.Signature = nil, nil
+	if key != nil {
+		header.ProducerKey = key.Public().(ed25519.PublicKey)
+		header.Proposer = ProducerAddress(header.ProducerKey)
+		header.Signature = sealedSignature
+	}
+
+	// The size includes its own field, it's stable after at most a few rounds
+	header.Hash = sealedHash
+	for size := uint64(b.ProtoSize()); size != header.Size; size = uint64(b.ProtoSize()) {
+		header.Size = size
+	}
+
+	header.Hash = header.ComputeHash()
+	if key != nil {
+		header.Signature = ed25519.Sign(key, header.hashBytes())
+	}
+}
+
+// ProducerAddress returns the address of the producer of key, the last 20 bytes of its
+// SHA-256 hash.
+func ProducerAddress(key ed25519.PublicKey) string {
+	hash := sha256.Sum256(key)
+	return "0x" + hex.EncodeToString(hash[sha256.Size-20:])
+}
+
+// VerifySignature checks that the header is signed by key, unlike Block.Verify it fails
+// on headers that are not signed. It's how a consumer trusting a producer key (the store
+// one is in `/status`) detects blocks forged by another producer.
+func (h *BlockHeader) VerifySignature(key ed25519.PublicKey) error {
+	if len(h.Signature) == 0 {
+		return fmt.Errorf("%w #%d: block is not signed", ErrInvalidBlock, h.Height)
+	}
+
+	if !key.Equal(ed25519.PublicKey(h.ProducerKey)) {
+		return fmt.Errorf("%w #%d: signed by producer %s, expected %s", ErrInvalidBlock, h.Height, ProducerAddress(h.ProducerKey), ProducerAddress(key))
+	}
+
+	return h.verifySignature()
+}
+
+// Verify checks that the header of the block commits to its content, a block that is not
+// sealed is invalid. The transactions root and
+// gas used of delta flash blocks cover transactions they don't hold, they are checked by
+// AccumulateFlashBlock instead.
+func (b *Block) Verify() error {
+	header := b.Header
+	if header == nil {
+		return fmt.Errorf("%w: no header", ErrInvalidBlock)
+	}
+
+	if header.TransactionsRoot == "" {
+		return fmt.Errorf("%w #%d: no transactions root, the block is not sealed", ErrInvalidBlock, header.Height)
+	}
+
+	if header.TransactionsOffset == 0 {
+		if err := header.verifyTransactions(b.Transactions); err != nil {
+			return err
+		}
+	}
+
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("%w #%d: gas used %d is above the gas limit %d", ErrInvalidBlock, header.Height, header.GasUsed, header.GasLimit)
+	}
+
+	if root := header.computeStateRoot(); root != header.StateRoot {
+		return fmt.Errorf("%w #%d: state root is %s, expected %s", ErrInvalidBlock, header.Height, header.StateRoot, root)
+	}
+
+	if size := uint64(b.ProtoSize()); size != header.Size {
+		return fmt.Errorf("%w #%d: size is %d but the block is %d bytes", ErrInvalidBlock, header.Height, header.Size, size)
+	}
+
+	if hash := header.ComputeHash(); hash != header.Hash {
+		return fmt.Errorf("%w #%d: hash is %s but the header hashes to %s", ErrInvalidBlock, header.Height, header.Hash, hash)
+	}
+
+	if len(header.ProducerKey) == 0 && len(header.Signature) == 0 {
+		return nil
+	}
+
+	if address := ProducerAddress(header.ProducerKey); address != header.Proposer {
+		return fmt.Errorf("%w #%d: proposer is %s but the producer key address is %s", ErrInvalidBlock, header.Height, header.Proposer, address)
+	}
+
+	return header.verifySignature()
+}
+
+// verifyTransactions checks that the header commits to transactions.
+func (h *BlockHeader) verifyTransactions(transactions []Transaction) error {
+	if root := TransactionsRoot(transactions); root != h.TransactionsRoot {
+		return fmt.Errorf("%w #%d: transactions root is %s but transactions hash to %s", ErrInvalidBlock, h.Height, h.TransactionsRoot, root)
+	}
+
+	if gas := GasUsed(transactions); gas != h.GasUsed {
+		return fmt.Errorf("%w #%d: gas used is %d but transactions use %d", ErrInvalidBlock, h.Height, h.GasUsed, gas)
+	}
+
+	return nil
+}
+
+func (h *BlockHeader) verifySignature() error {
+	if len(h.ProducerKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w #%d: producer key is %d bytes, expected %d", ErrInvalidBlock, h.Height, len(h.ProducerKey), ed25519.PublicKeySize)
+	}
+
+	if !ed25519.Verify(h.ProducerKey, h.hashBytes(), h.Signature) {
+		return fmt.Errorf("%w #%d: invalid signature", ErrInvalidBlock, h.Height)
+	}
+
+	return nil
+}
+
+// hashBytes returns the hash decoded, nil if it's not hex encoded.
+func (h *BlockHeader) hashBytes() []byte {
+	hash, err := hex.DecodeString(h.Hash)
+	if err != nil {
+		return nil
+	}
+
+	return hash
+}
+
+// ComputeHash returns the hash of the header, computed over all of its fields but the hash
+// itself, the signature of the hash and the propagation time, which is observed by the node
+// and not part of consensus.
+func (h *BlockHeader) ComputeHash() string {
+	hasher := sha256.New()
+
+	writeUint64(hasher, h.Height)
+	writeBool(hasher, h.PrevNum != nil && h.PrevHash != nil)
+	if h.PrevNum != nil && h.PrevHash != nil {
+		writeUint64(hasher, *h.PrevNum)
+		writeString(hasher, *h.PrevHash)
+	}
+	writeUint64(hasher, h.FinalNum)
+	writeString(hasher, h.FinalHash)
+	writeUint64(hasher, uint64(h.Timestamp.UnixNano()))
+	writeUint64(hasher, uint64(h.ProtocolVersion))
+	writeAttributes(hasher, h.ExtraFields)
+	writeUint64(hasher, h.SkippedSlots)
+	writeString(hasher, h.TransactionsRoot)
+	writeString(hasher, h.StateRoot)
+	writeString(hasher, h.Proposer)
+	writeUint64(hasher, h.GasUsed)
+	writeUint64(hasher, h.GasLimit)
+	writeUint64(hasher, h.Size)
+	writeBytes(hasher, h.ExtraData)
+	writeBytes(hasher, h.ProducerKey)
+	writeUint64(hasher, h.TransactionsOffset)
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// SealedProtoSize returns what ProtoSize will be once the header is sealed with gasUsed and
+// size, the hashes and roots having a fixed length, as the signature when the header has a
+// producer key.
+func (h *BlockHeader) SealedProtoSize(gasUsed uint64, size uint64) int {
+	sealed := *h
+	if len(sealed.ProducerKey) > 0 {
+		sealed.Signature = sealedSignature
+	}
+	sealed.Hash = sealedHash
+	sealed.TransactionsRoot = sealedHash
+	sealed.StateRoot = sealedHash
+	sealed.GasUsed = gasUsed
+	sealed.Size = size
+
+	return sealed.ProtoSize()
+}
+
+func (h *BlockHeader) computeStateRoot() string {
+	hasher := sha256.New()
+	if h.PrevHash != nil {
+		writeString(hasher, *h.PrevHash)
+	} else {
+		writeString(hasher, "")
+	}
+	writeString(hasher, h.TransactionsRoot)
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,137 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// newTestBlock returns a block at height with a few transactions, not sealed.
+func newTestBlock(height uint64) *Block {
+	prevNum, prevHash := height-1, MakeHash(height-1)
+
+	transactions := make([]Transaction, 3)
+	for i := range transactions {
+		transactions[i] = Transaction{
+			Type:     "transfer",
+			Hash:     MakeHash(i),
+			Sender:   "0xa",
+			Receiver: "0xb",
+			Amount:   big.NewInt(int64(i + 1)),
+			Fee:      big.NewInt(1),
+			Success:  true,
+		}
+	}
+
+	return &Block{
+		Header: &BlockHeader{
+			Height:    height,
+			PrevNum:   &prevNum,
+			PrevHash:  &prevHash,
+			Timestamp: time.Date(2024, 1, 1, 0, 0, int(height), 0, time.UTC),
+			GasLimit:  1_000_000,
+		},
+		Transactions: transactions,
+	}
+}
+
+func TestBlock_SealSigned(t *testing.T) {
+	key := newTestKey(t)
+	block := newTestBlock(12)
+	block.Seal(key)
+
+	if err := block.Verify(); err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+
+	if err := block.Header.VerifySignature(key.Public().(ed25519.PublicKey)); err != nil {
+		t.Fatalf("verify signature: %s", err)
+	}
+
+	if proposer := ProducerAddress(key.Public().(ed25519.PublicKey)); block.Header.Proposer != proposer {
+		t.Errorf("proposer is %s, expected %s", block.Header.Proposer, proposer)
+	}
+}
+
+func TestBlock_SealUnsigned(t *testing.T) {
+	block := newTestBlock(12)
+	block.Seal(nil)
+
+	if err := block.Verify(); err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+
+	// A consumer trusting a key rejects it
+	if err := block.Header.VerifySignature(newTestKey(t).Public().(ed25519.PublicKey)); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("verify signature of an unsigned block returned %v, expected ErrInvalidBlock", err)
+	}
+}
+
+func TestBlock_VerifyTampered(t *testing.T) {
+	key := newTestKey(t)
+
+	tests := []struct {
+		name   string
+		tamper func(block *Block)
+	}{
+		{"not sealed", func(block *Block) { block.Header.TransactionsRoot = "" }},
+		{"transaction", func(block *Block) { block.Transactions[1].Amount = big.NewInt(1000) }},
+		{"removed transaction", func(block *Block) { block.Transactions = block.Transactions[:2] }},
+		{"gas used", func(block *Block) { block.Header.GasUsed++ }},
+		{"state root", func(block *Block) { block.Header.StateRoot = MakeHash("state") }},
+		{"size", func(block *Block) { block.Header.Size++ }},
+		{"header field", func(block *Block) { block.Header.FinalNum = 11 }},
+		{"hash", func(block *Block) { block.Header.Hash = MakeHash("forged") }},
+		{"signature", func(block *Block) { block.Header.Signature[0] ^= 0xff }},
+		{"stripped signature", func(block *Block) { block.Header.Signature = nil }},
+		{"proposer", func(block *Block) { block.Header.Proposer = "0x00" }},
+		{"producer key", func(block *Block) {
+			// Re-signed by another key, without updating the proposer
+			other := newTestKey(t)
+			block.Header.ProducerKey = other.Public().(ed25519.PublicKey)
+			block.Header.Hash = block.Header.ComputeHash()
+			block.Header.Signature = ed25519.Sign(other, block.Header.hashBytes())
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := newTestBlock(12)
+			block.Seal(key)
+			test.tamper(block)
+
+			if err := block.Verify(); !errors.Is(err, ErrInvalidBlock) {
+				t.Errorf("verify returned %v, expected ErrInvalidBlock", err)
+			}
+		})
+	}
+}
+
+func TestBlockHeader_VerifySignatureForged(t *testing.T) {
+	trusted := newTestKey(t)
+
+	// A block sealed by another producer is valid on its own, but not signed by the trusted key
+	block := newTestBlock(12)
+	block.Seal(newTestKey(t))
+
+	if err := block.Verify(); err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+
+	if err := block.Header.VerifySignature(trusted.Public().(ed25519.PublicKey)); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("verify signature of a forged block returned %v, expected ErrInvalidBlock", err)
+	}
+}
@@ -0,0 +1,221 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"math/bits"
+)
+
+// Merkle trees follow RFC 6962 (Certificate Transparency): leaves and inner nodes are hashed
+// with a different prefix byte so that one can't be passed for the other, and a tree of n
+// leaves is split after the largest power of two smaller than n.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// TransactionsRoot returns the hex encoded Merkle root of the transactions, the hash of
+// nothing when there are none.
+func TransactionsRoot(transactions []Transaction) string {
+	leaves := make([][sha256.Size]byte, len(transactions))
+	for i := range transactions {
+		leaves[i] = transactions[i].LeafHash()
+	}
+
+	root := merkleRoot(leaves)
+	return hex.EncodeToString(root[:])
+}
+
+// LeafHash returns the hash of the transaction as a leaf of the transactions Merkle tree,
+// it covers all of its fields.
+func (t *Transaction) LeafHash() [sha256.Size]byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{merkleLeafPrefix})
+
+	writeString(hasher, t.Type)
+	writeString(hasher, t.Hash)
+	writeString(hasher, t.Sender)
+	writeString(hasher, t.Receiver)
+	writeBytes(hasher, t.Data)
+	writeBytes(hasher, bigIntBytes(t.Amount))
+	writeBytes(hasher, bigIntBytes(t.Fee))
+	writeBool(hasher, t.Success)
+
+	writeUint64(hasher, uint64(len(t.Events)))
+	for _, event := range t.Events {
+		writeString(hasher, event.Type)
+		writeAttributes(hasher, event.Attributes)
+	}
+
+	return [sha256.Size]byte(hasher.Sum(nil))
+}
+
+// ErrInvalidProof is matched by the errors of VerifyTransactionProof.
+var ErrInvalidProof = errors.New("invalid proof")
+
+// TransactionProof is a Merkle inclusion proof of the transaction at Index in the
+// transactions root of a block having Count transactions.
+type TransactionProof struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+
+	// Path are the hex encoded sibling hashes from the leaf up to the root (the RFC 6962
+	// audit path), empty when the block has a single transaction.
+	Path []string `json:"path"`
+}
+
+// NewTransactionProof returns the inclusion proof of the transaction at index.
+func NewTransactionProof(transactions []Transaction, index int) (*TransactionProof, error) {
+	if index < 0 || index >= len(transactions) {
+		return nil, fmt.Errorf("transaction index %d out of range, the block has %d transactions", index, len(transactions))
+	}
+
+	leaves := make([][sha256.Size]byte, len(transactions))
+	for i := range transactions {
+		leaves[i] = transactions[i].LeafHash()
+	}
+
+	path := merklePath(index, leaves)
+	proof := &TransactionProof{Index: index, Count: len(transactions), Path: make([]string, len(path))}
+	for i, hash := range path {
+		proof.Path[i] = hex.EncodeToString(hash[:])
+	}
+
+	return proof, nil
+}
+
+// VerifyTransactionProof checks that proof proves trx is included in the transactions root
+// of header, the returned error matches ErrInvalidProof when it doesn't.
+func VerifyTransactionProof(header *BlockHeader, trx *Transaction, proof *TransactionProof) error {
+	if header.TransactionsRoot == "" {
+		return fmt.Errorf("%w: block #%d header has no transactions root", ErrInvalidProof, header.Height)
+	}
+
+	if proof.Index < 0 || proof.Index >= proof.Count {
+		return fmt.Errorf("%w: index %d out of range of %d transactions", ErrInvalidProof, proof.Index, proof.Count)
+	}
+
+	// RFC 9162 section 2.1.3.2, the index and last index tell on which side each sibling is
+	index, last := uint64(proof.Index), uint64(proof.Count-1)
+	hash := trx.LeafHash()
+
+	for i, encoded := range proof.Path {
+		sibling, err := hex.DecodeString(encoded)
+		if err != nil || len(sibling) != sha256.Size {
+			return fmt.Errorf("%w: path hash %d is not a hex encoded SHA-256 hash", ErrInvalidProof, i)
+		}
+
+		if last == 0 {
+			return fmt.Errorf("%w: path is longer than the tree height", ErrInvalidProof)
+		}
+
+		if index%2 == 1 || index == last {
+			hash = merkleNode([sha256.Size]byte(sibling), hash)
+			for index%2 == 0 && index != 0 {
+				index >>= 1
+				last >>= 1
+			}
+		} else {
+			hash = merkleNode(hash, [sha256.Size]byte(sibling))
+		}
+
+		index >>= 1
+		last >>= 1
+	}
+
+	if last != 0 {
+		return fmt.Errorf("%w: path is shorter than the tree height", ErrInvalidProof)
+	}
+
+	if root := hex.EncodeToString(hash[:]); root != header.TransactionsRoot {
+		return fmt.Errorf("%w: proof leads to root %s, block #%d transactions root is %s", ErrInvalidProof, root, header.Height, header.TransactionsRoot)
+	}
+
+	return nil
+}
+
+func merkleRoot(leaves [][sha256.Size]byte) [sha256.Size]byte {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+
+	split := merkleSplit(len(leaves))
+	return merkleNode(merkleRoot(leaves[:split]), merkleRoot(leaves[split:]))
+}
+
+// merklePath returns the audit path of the leaf at index, from the leaf up.
+func merklePath(index int, leaves [][sha256.Size]byte) [][sha256.Size]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+
+	split := merkleSplit(len(leaves))
+	if index < split {
+		return append(merklePath(index, leaves[:split]), merkleRoot(leaves[split:]))
+	}
+
+	return append(merklePath(index-split, leaves[split:]), merkleRoot(leaves[:split]))
+}
+
+// merkleSplit returns the largest power of two smaller than count, count being at least 2.
+func merkleSplit(count int) int {
+	return 1 << (bits.Len(uint(count-1)) - 1)
+}
+
+func merkleNode(left, right [sha256.Size]byte) [sha256.Size]byte {
+	var content [1 + 2*sha256.Size]byte
+	content[0] = merkleNodePrefix
+	copy(content[1:], left[:])
+	copy(content[1+sha256.Size:], right[:])
+
+	return sha256.Sum256(content[:])
+}
+
+// The functions below write values to a hash unambiguously, variable length values being
+// prefixed by their length.
+
+func writeUint64(hasher hash.Hash, value uint64) {
+	hasher.Write(binary.BigEndian.AppendUint64(nil, value))
+}
+
+func writeBool(hasher hash.Hash, value bool) {
+	if value {
+		hasher.Write([]byte{1})
+	} else {
+		hasher.Write([]byte{0})
+	}
+}
+
+func writeBytes(hasher hash.Hash, value []byte) {
+	writeUint64(hasher, uint64(len(value)))
+	hasher.Write(value)
+}
+
+func writeString(hasher hash.Hash, value string) {
+	writeUint64(hasher, uint64(len(value)))
+	hasher.Write([]byte(value))
+}
+
+func writeAttributes(hasher hash.Hash, attributes []Attribute) {
+	writeUint64(hasher, uint64(len(attributes)))
+	for _, attribute := range attributes {
+		writeString(hasher, attribute.Key)
+		writeString(hasher, attribute.Value)
+	}
+}
+
+func bigIntBytes(value *big.Int) []byte {
+	if value == nil {
+		return nil
+	}
+
+	return value.Bytes()
+}
@@ -0,0 +1,176 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// RFC 6962 test vectors, as used by the Certificate Transparency implementations: the roots
+// of the trees made of the first 1 to 8 leaves.
+var (
+	rfc6962Leaves = []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"}
+	rfc6962Roots  = []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	rfc6962EmptyRoot = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestMerkleRoot_RFC6962(t *testing.T) {
+	leaves := make([][sha256.Size]byte, len(rfc6962Leaves))
+	for i, encoded := range rfc6962Leaves {
+		data, err := hex.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+	}
+
+	for size, expected := range rfc6962Roots {
+		root := merkleRoot(leaves[:size+1])
+		if encoded := hex.EncodeToString(root[:]); encoded != expected {
+			t.Errorf("root of %d leaves is %s, expected %s", size+1, encoded, expected)
+		}
+	}
+
+	if root := TransactionsRoot(nil); root != rfc6962EmptyRoot {
+		t.Errorf("root without transactions is %s, expected %s", root, rfc6962EmptyRoot)
+	}
+}
+
+func newTestTransactions(count int) []Transaction {
+	transactions := make([]Transaction, count)
+	for i := range transactions {
+		transactions[i] = Transaction{Type: "transfer", Hash: MakeHash(i), Sender: "0xa", Receiver: "0xb"}
+	}
+
+	return transactions
+}
+
+// auditPathSides returns on which side the siblings of the audit path of the leaf at index
+// are, from the leaf up, true for the right side. It follows the tree recursively, as
+// merklePath does, to check the index arithmetic of VerifyTransactionProof against.
+func auditPathSides(index int, count int) []bool {
+	if count <= 1 {
+		return nil
+	}
+
+	split := merkleSplit(count)
+	if index < split {
+		return append(auditPathSides(index, split), true)
+	}
+
+	return append(auditPathSides(index-split, count-split), false)
+}
+
+func TestTransactionProof_RoundTrip(t *testing.T) {
+	for count := 1; count <= 17; count++ {
+		transactions := newTestTransactions(count)
+		header := &BlockHeader{Height: 1, TransactionsRoot: TransactionsRoot(transactions)}
+
+		for index := range count {
+			proof, err := NewTransactionProof(transactions, index)
+			if err != nil {
+				t.Fatalf("proof of transaction %d/%d: %s", index, count, err)
+			}
+
+			if len(proof.Path) != len(auditPathSides(index, count)) {
+				t.Errorf("proof of transaction %d/%d has %d hashes, expected %d", index, count, len(proof.Path), len(auditPathSides(index, count)))
+			}
+
+			if err := VerifyTransactionProof(header, &transactions[index], proof); err != nil {
+				t.Errorf("verify proof of transaction %d/%d: %s", index, count, err)
+			}
+		}
+	}
+}
+
+func TestTransactionProof_OutOfRange(t *testing.T) {
+	transactions := newTestTransactions(3)
+	for _, index := range []int{-1, 3} {
+		if _, err := NewTransactionProof(transactions, index); err == nil {
+			t.Errorf("proof of transaction %d/3 didn't fail", index)
+		}
+	}
+}
+
+func TestTransactionProof_Tampered(t *testing.T) {
+	for count := 1; count <= 17; count++ {
+		transactions := newTestTransactions(count)
+		header := &BlockHeader{Height: 1, TransactionsRoot: TransactionsRoot(transactions)}
+
+		for index := range count {
+			proof, err := NewTransactionProof(transactions, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rejects := func(name string, header *BlockHeader, trx *Transaction, proof *TransactionProof) {
+				t.Helper()
+
+				if err := VerifyTransactionProof(header, trx, proof); !errors.Is(err, ErrInvalidProof) {
+					t.Errorf("proof of transaction %d/%d with %s: verify returned %v, expected ErrInvalidProof", index, count, name, err)
+				}
+			}
+
+			tampered := transactions[index]
+			tampered.Receiver = "0xc"
+			rejects("tampered transaction", header, &tampered, proof)
+
+			if count > 1 {
+				rejects("another transaction", header, &transactions[(index+1)%count], proof)
+			}
+
+			for i := range proof.Path {
+				path := slices.Clone(proof.Path)
+				sibling, _ := hex.DecodeString(path[i])
+				sibling[0] ^= 0xff
+				path[i] = hex.EncodeToString(sibling)
+				rejects(fmt.Sprintf("tampered sibling %d", i), header, &transactions[index], &TransactionProof{Index: index, Count: count, Path: path})
+			}
+
+			if len(proof.Path) > 0 {
+				rejects("truncated path", header, &transactions[index], &TransactionProof{Index: index, Count: count, Path: proof.Path[:len(proof.Path)-1]})
+				rejects("invalid sibling", header, &transactions[index], &TransactionProof{Index: index, Count: count, Path: append([]string{"zz"}, proof.Path[1:]...)})
+				rejects("extended path", header, &transactions[index], &TransactionProof{Index: index, Count: count, Path: append(slices.Clone(proof.Path), proof.Path...)})
+			}
+			rejects("extra sibling", header, &transactions[index], &TransactionProof{Index: index, Count: count, Path: append(slices.Clone(proof.Path), header.TransactionsRoot)})
+
+			rejects("negative index", header, &transactions[index], &TransactionProof{Index: -1, Count: count, Path: proof.Path})
+			rejects("index out of range", header, &transactions[index], &TransactionProof{Index: count, Count: count, Path: proof.Path})
+			rejects("no transactions root", &BlockHeader{Height: 1}, &transactions[index], proof)
+
+			// The root doesn't commit to the tree size, a proof only holds for another index or
+			// size when the siblings are on the same sides, a tampered one fails otherwise
+			sides := auditPathSides(index, count)
+			for otherCount := 1; otherCount <= 2*count+1; otherCount++ {
+				for otherIndex := range otherCount {
+					if otherIndex == index && otherCount == count {
+						continue
+					}
+
+					other := &TransactionProof{Index: otherIndex, Count: otherCount, Path: proof.Path}
+					err := VerifyTransactionProof(header, &transactions[index], other)
+
+					if slices.Equal(sides, auditPathSides(otherIndex, otherCount)) {
+						if err != nil {
+							t.Errorf("proof of transaction %d/%d as %d/%d, on the same path: %s", index, count, otherIndex, otherCount, err)
+						}
+					} else if !errors.Is(err, ErrInvalidProof) {
+						t.Errorf("proof of transaction %d/%d tampered as %d/%d: verify returned %v, expected ErrInvalidProof", index, count, otherIndex, otherCount, err)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package types
+
+import (
+	"math/big"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The functions below compute the exact size of the `sf.acme.type.v1` Protobuf models built
+// by the tracer from our types, they must be kept in sync with the fields set there. Field
+// numbers are those of the `.proto` definitions.
+
+// ProtoSize returns the exact size in bytes of the block once converted into its
+// `sf.acme.type.v1.Block` Protobuf model, i.e. proto.Size of the tracer's block.
+func (b *Block) ProtoSize() int {
+	sizer := NewBlockSizer(b.Header)
+	for i := range b.Transactions {
+		sizer.Add(&b.Transactions[i])
+	}
+
+	return sizer.Size()
+}
+
+// BlockSizer tracks the exact Protobuf size of a block as transactions are added to it,
+// without having to re-compute the size of the transactions already added.
+type BlockSizer struct {
+	size int
+}
+
+// NewSealedBlockSizer is NewBlockSizer for a header yet to be sealed with gasUsed and size,
+// see BlockHeader.SealedProtoSize.
+func NewSealedBlockSizer(header *BlockHeader, gasUsed uint64, size uint64) *BlockSizer {
+	return &BlockSizer{size: sizeOfMessageField(1, header.SealedProtoSize(gasUsed, size))}
+}
+
+func NewBlockSizer(header *BlockHeader) *BlockSizer {
+	sizer := &BlockSizer{}
+	if header != nil {
+		sizer.size = sizeOfMessageField(1, header.ProtoSize())
+	}
+
+	return sizer
+}
+
+// Add accounts for the transaction being appended to the block and returns the new size.
+func (s *BlockSizer) Add(trx *Transaction) int {
+	s.size += trx.ProtoFieldSize()
+	return s.size
+}
+
+// Size returns the block size with all the transactions added so far.
+func (s *BlockSizer) Size() int {
+	return s.size
+}
+
+// ProtoSize returns the exact size of the `sf.acme.type.v1.BlockHeader` message.
+func (h *BlockHeader) ProtoSize() int {
+	size := sizeOfUint64Field(1, h.Height)
+	size += sizeOfStringField(2, h.Hash)
+	if h.PrevNum != nil && h.PrevHash != nil {
+		// Proto3 optional fields are always encoded when set, even to their zero value
+		size += protowire.SizeTag(3) + protowire.SizeVarint(*h.PrevNum)
+		size += protowire.SizeTag(4) + protowire.SizeBytes(len(*h.PrevHash))
+	}
+	size += sizeOfUint64Field(5, h.FinalNum)
+	size += sizeOfStringField(6, h.FinalHash)
+	size += sizeOfUint64Field(7, uint64(h.Timestamp.UnixNano()))
+	size += sizeOfUint64Field(8, uint64(h.ProtocolVersion))
+	for _, field := range h.ExtraFields {
+		size += sizeOfMessageField(9, sizeOfAttribute(field))
+	}
+	if h.PropagationTime != nil {
+		size += sizeOfUint64Field(10, uint64(h.PropagationTime.UnixNano()))
+	}
+	size += sizeOfUint64Field(11, h.SkippedSlots)
+	size += sizeOfStringField(12, h.TransactionsRoot)
+	size += sizeOfStringField(13, h.StateRoot)
+	size += sizeOfStringField(14, h.Proposer)
+	size += sizeOfUint64Field(15, h.GasUsed)
+	size += sizeOfUint64Field(16, h.GasLimit)
+	size += sizeOfUint64Field(17, h.Size)
+	size += sizeOfBytesField(18, len(h.ExtraData))
+	size += sizeOfBytesField(19, len(h.ProducerKey))
+	size += sizeOfBytesField(20, len(h.Signature))
+	size += sizeOfUint64Field(21, h.TransactionsOffset)
+
+	return size
+}
+
+// ProtoSize returns the exact size of the `sf.acme.type.v1.Transaction` message.
+func (t *Transaction) ProtoSize() int {
+	return t.protoSizeWithoutData() + sizeOfBytesField(9, len(t.Data))
+}
+
+// ProtoFieldSize returns the size the transaction adds to its block, that is the size of
+// the message plus the field tag and length prefix of the `transactions` repeated field.
+func (t *Transaction) ProtoFieldSize() int {
+	return sizeOfMessageField(2, t.ProtoSize())
+}
+
+// ProtoFieldSizeWithData returns what ProtoFieldSize would be if the transaction data was
+// dataLength bytes long, without having to allocate the data.
+func (t *Transaction) ProtoFieldSizeWithData(dataLength int) int {
+	return sizeOfMessageField(2, t.protoSizeWithoutData()+sizeOfBytesField(9, dataLength))
+}
+
+func (t *Transaction) protoSizeWithoutData() int {
+	size := sizeOfStringField(1, t.Type)
+	size += sizeOfStringField(2, t.Hash)
+	size += sizeOfStringField(3, t.Sender)
+	size += sizeOfStringField(4, t.Receiver)
+	// Amount and fee messages are always set by the tracer, even when the value is zero
+	size += sizeOfMessageField(5, sizeOfBigInt(t.Amount))
+	size += sizeOfMessageField(6, sizeOfBigInt(t.Fee))
+	if t.Success {
+		size += protowire.SizeTag(7) + 1
+	}
+
+	for i := range t.Events {
+		size += sizeOfMessageField(8, t.Events[i].ProtoSize())
+	}
+
+	return size
+}
+
+// ProtoSize returns the exact size of the `sf.acme.type.v1.Event` message.
+func (e *Event) ProtoSize() int {
+	size := sizeOfStringField(1, e.Type)
+	for _, attribute := range e.Attributes {
+		size += sizeOfMessageField(2, sizeOfAttribute(attribute))
+	}
+
+	return size
+}
+
+// sizeOfAttribute returns the size of the `sf.acme.type.v1.Attribute` message
+func sizeOfAttribute(attribute Attribute) int {
+	return sizeOfStringField(1, attribute.Key) + sizeOfStringField(2, attribute.Value)
+}
+
+// sizeOfBigInt returns the size of the `sf.acme.type.v1.BigInt` message for the value
+func sizeOfBigInt(value *big.Int) int {
+	if value == nil {
+		return 0
+	}
+
+	return sizeOfBytesField(1, (value.BitLen()+7)/8)
+}
+
+func sizeOfUint64Field(num protowire.Number, value uint64) int {
+	if value == 0 {
+		return 0
+	}
+
+	return protowire.SizeTag(num) + protowire.SizeVarint(value)
+}
+
+func sizeOfStringField(num protowire.Number, value string) int {
+	return sizeOfBytesField(num, len(value))
+}
+
+func sizeOfBytesField(num protowire.Number, length int) int {
+	if length == 0 {
+		return 0
+	}
+
+	return protowire.SizeTag(num) + protowire.SizeBytes(length)
+}
+
+func sizeOfMessageField(num protowire.Number, size int) int {
+	return protowire.SizeTag(num) + protowire.SizeBytes(size)
+}
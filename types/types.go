@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
-	"math/bits"
 	"time"
 )
 
@@ -40,21 +39,6 @@ func MakeFakeHash(blockHeight uint64, txIndex int) string {
 	return fmt.Sprintf("%x", hash)
 }
 
-func GenesisBlock(hash string, height uint64, genesisTime time.Time) *Block {
-	header := &BlockHeader{
-		Height:    height,
-		Hash:      hash,
-		FinalNum:  height,
-		FinalHash: hash,
-		Timestamp: genesisTime,
-	}
-
-	return &Block{
-		Header:       header,
-		Transactions: nil,
-	}
-}
-
 type BlockHeader struct {
 	Height    uint64    `json:"height"`
 	Hash      string    `json:"hash"`
@@ -63,6 +47,44 @@ type BlockHeader struct {
 	FinalNum  uint64    `json:"final_num"`
 	FinalHash string    `json:"final_hash"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// ProtocolVersion is the amount of protocol upgrades activated at this height.
+	ProtocolVersion uint32      `json:"protocol_version,omitempty"`
+	ExtraFields     []Attribute `json:"extra_fields,omitempty"`
+
+	// PropagationTime is the wall-clock time at which the block was produced, only set when
+	// the node tracks it, whatever the timestamp mode.
+	PropagationTime *time.Time `json:"propagation_time,omitempty"`
+
+	// SkippedSlots is the amount of heights skipped between the parent block and this one,
+	// no block was ever produced at these heights.
+	SkippedSlots uint64 `json:"skipped_slots,omitempty"`
+
+	// The fields below commit to the block content, they are set when the block is sealed
+	// (see Block.Seal).
+
+	// TransactionsRoot is the Merkle root of the block transactions (see TransactionsRoot).
+	TransactionsRoot string `json:"transactions_root,omitempty"`
+	// StateRoot commits to the state of the chain after the block, see Block.Seal.
+	StateRoot string `json:"state_root,omitempty"`
+	// Proposer is the address of the node that produced the block.
+	Proposer string `json:"proposer,omitempty"`
+	GasUsed  uint64 `json:"gas_used,omitempty"`
+	GasLimit uint64 `json:"gas_limit,omitempty"`
+	// Size is the exact size of the block in its `sf.acme.type.v1.Block` Protobuf model.
+	Size      uint64 `json:"size,omitempty"`
+	ExtraData []byte `json:"extra_data,omitempty"`
+
+	// ProducerKey is the Ed25519 public key of the block producer, Proposer is derived from it
+	// (see ProducerAddress). Signature is the signature of the hash by this key, both are empty
+	// on blocks that are not signed.
+	ProducerKey []byte `json:"producer_key,omitempty"`
+	Signature   []byte `json:"signature,omitempty"`
+
+	// TransactionsOffset is the index in the block of the first transaction held, it's only
+	// set on delta flash blocks, holding the transactions added since the previous flash block
+	// while the header commits to all of the transactions so far (see AccumulateFlashBlock).
+	TransactionsOffset uint64 `json:"transactions_offset,omitempty"`
 }
 
 type Block struct {
@@ -72,74 +94,20 @@ type Block struct {
 
 type FlashBlock struct {
 	*Block
-	Index int32
+	Index int32 `json:"index"`
 }
 
+// Signal tells the commitment level a block reached, levels are numbered from 1 in the
+// order of the commitment pipeline.
 type Signal struct {
-	BlockID         string
-	BlockNumber     uint64
-	CommitmentLevel int32
+	BlockID         string `json:"block_id"`
+	BlockNumber     uint64 `json:"block_number"`
+	CommitmentLevel int32  `json:"commitment_level"`
 }
 
-// ApproximatedSize computes an approximation of how big the block would be
-// once converted into a Protobuf Block model
-func (b *Block) ApproximatedSize() int {
-	size := 0
-
-	// BlockHeader size approximation
-	if b.Header != nil {
-		size += protoSizeOfVarint(int(b.Header.Height)) // Height (uint64)
-		size += protoSizeOfString(b.Header.Hash)
-		if b.Header.PrevNum != nil {
-			size += protoSizeOfVarint(int(*b.Header.PrevNum)) // PrevNum (uint64)
-		}
-		if b.Header.PrevHash != nil {
-			size += protoSizeOfString(*b.Header.PrevHash)
-		}
-		size += protoSizeOfVarint(int(b.Header.FinalNum)) // FinalNum (uint64)
-		size += protoSizeOfString(b.Header.FinalHash)
-		size += protoSizeOfVarint(int(b.Header.Timestamp.UnixNano())) // Timestamp (int64 for protobuf)
-	}
-
-	// Transactions size approximation
-	for _, tx := range b.Transactions {
-		size += protoSizeOfString(tx.Type)
-		size += protoSizeOfString(tx.Hash)
-		size += protoSizeOfString(tx.Sender)
-		size += protoSizeOfString(tx.Receiver)
-		size += protoSizeOfBytes(tx.Data)
-		size += protoSizeOfBigInt(tx.Amount)
-		size += protoSizeOfBigInt(tx.Fee)
-		size += 1 // Success bool
-
-		// Events size approximation
-		for _, event := range tx.Events {
-			size += protoSizeOfString(event.Type)
-
-			// Attributes size approximation
-			for _, attr := range event.Attributes {
-				size += protoSizeOfString(attr.Key)
-				size += protoSizeOfString(attr.Value)
-			}
-		}
-	}
-
-	// Add protobuf field tag overhead (1 byte per field approximately)
-	numFields := 0
-	if b.Header != nil {
-		numFields += 7 // header fields
-	}
-	numFields += len(b.Transactions) * 8 // transaction fields
-	for _, tx := range b.Transactions {
-		numFields += len(tx.Events) * 2 // event fields
-		for _, event := range tx.Events {
-			numFields += len(event.Attributes) * 2 // attribute fields
-		}
-	}
-	size += numFields
-
-	return size
-}
+// CommitmentDropped is the commitment level of the signal of a block reorged out after it
+// was confirmed.
+const CommitmentDropped int32 = -1
 
 type Transaction struct {
 	Type     string   `json:"type"`
@@ -162,60 +130,3 @@ type Attribute struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
-
-// protoSizeOfString calculates the protobuf size of a string field
-func protoSizeOfString(s string) int {
-	if len(s) == 0 {
-		return 0
-	}
-	// String length + varint encoding of length
-	return len(s) + protoSizeOfVarint(len(s))
-}
-
-// protoSizeOfBytes calculates the protobuf size of a bytes field
-func protoSizeOfBytes(b []byte) int {
-	if len(b) == 0 {
-		return 0
-	}
-	// Bytes length + varint encoding of length
-	return len(b) + protoSizeOfVarint(len(b))
-}
-
-const (
-	_BYTE_COUNT_PER_WORD = _BIT_COUNT_PER_WORD / 8 // word size in bytes
-	_BIT_COUNT_PER_WORD  = bits.UintSize           // word size in bits
-)
-
-// protoSizeOfBigInt calculates the protobuf size of a big.Int as bytes
-func protoSizeOfBigInt(bi *big.Int) int {
-	if bi == nil {
-		return 0
-	}
-
-	byteCount := bi.BitLen() * _BYTE_COUNT_PER_WORD
-	if byteCount == 0 {
-		return 0
-	}
-
-	return byteCount + protoSizeOfVarint(byteCount)
-}
-
-// protoSizeOfVarint calculates the size of a varint encoding of an integer
-func protoSizeOfVarint(x int) int {
-	if x < 0 {
-		return 10 // negative numbers take 10 bytes
-	}
-	if x < (1 << 7) {
-		return 1
-	}
-	if x < (1 << 14) {
-		return 2
-	}
-	if x < (1 << 21) {
-		return 3
-	}
-	if x < (1 << 28) {
-		return 4
-	}
-	return 5
-}
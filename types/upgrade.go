@@ -0,0 +1,209 @@
+package types
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultFinalityInterval is the default amount of heights between two final blocks, a block
+// becomes final when its height is a multiple of it.
+const DefaultFinalityInterval = 10
+
+// Upgrade is a protocol upgrade activating behaviour changes from Height on. Unset fields
+// keep the value of the previous upgrade (or of the node's configuration before any).
+type Upgrade struct {
+	Name   string `json:"name,omitempty"`
+	Height uint64 `json:"height"`
+
+	// FlashBlocks enables or disables the production of flash blocks.
+	FlashBlocks *bool `json:"flash_blocks,omitempty"`
+
+	// FinalityInterval changes the amount of heights between two final blocks.
+	FinalityInterval *uint64 `json:"finality_interval,omitempty"`
+
+	// BlockRate changes the block production rate (per minute).
+	BlockRate *int `json:"block_rate,omitempty"`
+
+	// TransactionTypes are added to the types of the generated transactions.
+	TransactionTypes []string `json:"transaction_types,omitempty"`
+
+	// HeaderFields are added to (or replace the value of) the block header extra fields.
+	HeaderFields map[string]string `json:"header_fields,omitempty"`
+}
+
+// Rules are the protocol behaviours in effect at a given height.
+type Rules struct {
+	// ProtocolVersion is the amount of upgrades activated so far.
+	ProtocolVersion  uint32
+	UpgradeName      string
+	FlashBlocks      bool
+	FinalityInterval uint64
+	BlockRate        int
+
+	// TransactionTypes are the transaction types added by upgrades so far.
+	TransactionTypes []string
+
+	// HeaderFields are the header extra fields set by upgrades so far, sorted by key.
+	HeaderFields []Attribute
+}
+
+// BlockInterval returns the duration between two blocks.
+func (r *Rules) BlockInterval() time.Duration {
+	return time.Minute / time.Duration(r.BlockRate)
+}
+
+// IsFinal returns whether the block at height becomes the final block when produced.
+func (r *Rules) IsFinal(height uint64) bool {
+	return height%r.FinalityInterval == 0
+}
+
+// Schedule resolves the Rules in effect at any height out of the base rules and the
+// upgrades activating from the genesis height on.
+type Schedule struct {
+	heights []uint64
+	rules   []*Rules
+}
+
+// NewSchedule returns the schedule applying upgrades on top of base, upgrades must be at
+// distinct heights above the genesis height, they are applied in height order.
+func NewSchedule(genesisHeight uint64, base Rules, upgrades []Upgrade) (*Schedule, error) {
+	if base.FinalityInterval == 0 {
+		base.FinalityInterval = DefaultFinalityInterval
+	}
+
+	if base.BlockRate < 1 {
+		return nil, fmt.Errorf("block rate must be greater than 0")
+	}
+
+	upgrades = slices.Clone(upgrades)
+	slices.SortStableFunc(upgrades, func(a, b Upgrade) int { return cmp.Compare(a.Height, b.Height) })
+
+	schedule := &Schedule{
+		heights: []uint64{genesisHeight},
+		rules:   []*Rules{&base},
+	}
+
+	headerFields := map[string]string{}
+	for _, field := range base.HeaderFields {
+		headerFields[field.Key] = field.Value
+	}
+
+	current := base
+	for i, upgrade := range upgrades {
+		name := upgrade.Name
+		if name == "" {
+			name = fmt.Sprintf("upgrade-%d", i+1)
+		}
+
+		if upgrade.Height <= genesisHeight {
+			return nil, fmt.Errorf("upgrade %q height %d must be above genesis height %d", name, upgrade.Height, genesisHeight)
+		}
+
+		if i > 0 && upgrade.Height == upgrades[i-1].Height {
+			return nil, fmt.Errorf("upgrade %q is at the same height %d as the previous one", name, upgrade.Height)
+		}
+
+		next := current
+		next.ProtocolVersion++
+		next.UpgradeName = name
+
+		if upgrade.FlashBlocks != nil {
+			next.FlashBlocks = *upgrade.FlashBlocks
+		}
+
+		if upgrade.FinalityInterval != nil {
+			if *upgrade.FinalityInterval == 0 {
+				return nil, fmt.Errorf("upgrade %q finality interval must be greater than 0", name)
+			}
+			next.FinalityInterval = *upgrade.FinalityInterval
+		}
+
+		if upgrade.BlockRate != nil {
+			if *upgrade.BlockRate < 1 {
+				return nil, fmt.Errorf("upgrade %q block rate must be greater than 0", name)
+			}
+			next.BlockRate = *upgrade.BlockRate
+		}
+
+		if len(upgrade.TransactionTypes) > 0 {
+			next.TransactionTypes = append(slices.Clone(current.TransactionTypes), upgrade.TransactionTypes...)
+		}
+
+		if len(upgrade.HeaderFields) > 0 {
+			for key, value := range upgrade.HeaderFields {
+				headerFields[key] = value
+			}
+
+			next.HeaderFields = make([]Attribute, 0, len(headerFields))
+			for key, value := range headerFields {
+				next.HeaderFields = append(next.HeaderFields, Attribute{Key: key, Value: value})
+			}
+			slices.SortFunc(next.HeaderFields, func(a, b Attribute) int { return strings.Compare(a.Key, b.Key) })
+		}
+
+		schedule.heights = append(schedule.heights, upgrade.Height)
+		schedule.rules = append(schedule.rules, &next)
+		current = next
+	}
+
+	return schedule, nil
+}
+
+// Rules returns the rules in effect at height, the returned value must not be modified.
+func (s *Schedule) Rules(height uint64) *Rules {
+	i, found := slices.BinarySearch(s.heights, height)
+	if !found {
+		i--
+	}
+
+	return s.rules[max(i, 0)]
+}
+
+// Timestamp returns the timestamp of the block at height, the block interval of each
+// upgrade applying from its activation height on.
+func (s *Schedule) Timestamp(genesisTime time.Time, height uint64) time.Time {
+	timestamp := genesisTime
+	for i, from := range s.heights {
+		if height <= from {
+			break
+		}
+
+		to := height
+		if i+1 < len(s.heights) {
+			to = min(to, s.heights[i+1])
+		}
+
+		timestamp = timestamp.Add(s.rules[i].BlockInterval() * time.Duration(to-from))
+	}
+
+	return timestamp
+}
+
+// HasFlashBlocks returns whether flash blocks are enabled at any height.
+func (s *Schedule) HasFlashBlocks() bool {
+	return slices.ContainsFunc(s.rules, func(rules *Rules) bool { return rules.FlashBlocks })
+}
+
+// ReadUpgrades reads upgrades from in, either inline JSON (starting with `[`) or the path
+// of a JSON file, holding an array of Upgrade.
+func ReadUpgrades(in string) ([]Upgrade, error) {
+	data := []byte(in)
+	if !strings.HasPrefix(strings.TrimSpace(in), "[") {
+		var err error
+		if data, err = os.ReadFile(in); err != nil {
+			return nil, err
+		}
+	}
+
+	var upgrades []Upgrade
+	if err := json.Unmarshal(data, &upgrades); err != nil {
+		return nil, fmt.Errorf("decode upgrades: %w", err)
+	}
+
+	return upgrades, nil
+}